@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const defaultPageSize = 100
+
+// EnrichedEvent is an event with links to its promoter's website and logo,
+// where known, and the labels of its facet values, when requested.
+type EnrichedEvent struct {
+	*models.Event
+	PromoterWebsiteURL *string           `json:"promoter_website_url,omitempty"`
+	PromoterLogoURL    *string           `json:"promoter_logo_url,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+}
+
+// EnrichedWork is a work with links to its promoter's website and logo.
+type EnrichedWork struct {
+	*models.Work
+	PromoterWebsiteURL *string `json:"promoter_website_url,omitempty"`
+	PromoterLogoURL    *string `json:"promoter_logo_url,omitempty"`
+}
+
+// SearchParams are the criteria for a search, of which at least a BBox or
+// Query is required.
+type SearchParams struct {
+	// BBox is in British National Grid (EPSG:27700)
+	BBox  *models.BBox
+	Query string
+	// Facets may use '*' as a wildcard, as per a search
+	Facets models.Facets
+	// Window replaces the default window of events active within the next 7
+	// days; only MaxDaysAhead, MaxDaysBehind and AsAt are used.
+	Window *models.TemporalFilters
+
+	// Labels includes the label of each facet value in each result, or of
+	// every code with RefData.
+	Labels bool
+	// FacetCounts includes the counts of each facet value over every match.
+	FacetCounts bool
+	// Limit and Offset select a page of the results, ordered by object
+	// reference, where a zero Limit is all of them.
+	Limit  int
+	Offset int
+}
+
+func (params *SearchParams) values() url.Values {
+	values := url.Values{}
+	if params == nil {
+		return values
+	}
+
+	if params.BBox != nil {
+		values.Set("bbox", formatBBox(params.BBox))
+	}
+	if params.Query != "" {
+		values.Set("q", params.Query)
+	}
+	for param, filter := range params.Facets {
+		for _, value := range filter.Include {
+			values.Add(param, value)
+		}
+		for _, value := range filter.Exclude {
+			values.Add(param+"__not", value)
+		}
+	}
+	addWindow(values, params.Window)
+
+	if params.Labels {
+		values.Set("labels", "true")
+	}
+	if params.FacetCounts {
+		values.Set("facet_counts", "true")
+	}
+	if params.Limit > 0 {
+		values.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.Offset > 0 {
+		values.Set("offset", strconv.Itoa(params.Offset))
+	}
+	return values
+}
+
+func formatBBox(bbox *models.BBox) string {
+	coords := make([]string, 0, 4)
+	for _, coord := range []float64{bbox.MinX, bbox.MinY, bbox.MaxX, bbox.MaxY} {
+		coords = append(coords, strconv.FormatFloat(coord, 'f', -1, 64))
+	}
+	return strings.Join(coords, ",")
+}
+
+func addWindow(values url.Values, window *models.TemporalFilters) {
+	if window == nil {
+		return
+	}
+	values.Set("max_days_ahead", strconv.Itoa(window.MaxDaysAhead))
+	values.Set("max_days_behind", strconv.Itoa(window.MaxDaysBehind))
+	if window.AsAt != nil {
+		values.Set("as_at", window.AsAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// SearchResults are the events matching a search.
+type SearchResults struct {
+	Results []*EnrichedEvent `json:"results"`
+	// Facets are the counts of each facet value, when requested
+	Facets *models.RefData `json:"facets,omitempty"`
+	// Total is the number of matching events, when paged
+	Total       int      `json:"total,omitempty"`
+	Attribution []string `json:"attribution"`
+}
+
+// Search finds the events matching the criteria.
+func (client *Client) Search(ctx context.Context, params *SearchParams) (*SearchResults, error) {
+	var results SearchResults
+	if err := client.get(ctx, "/search", params.values(), &results); err != nil {
+		return nil, errors.Wrap(err, "search failed")
+	}
+	return &results, nil
+}
+
+// SearchAll iterates over every event matching the criteria, fetching a page
+// of params.Limit (or 100) events at a time, starting from params.Offset.
+func (client *Client) SearchAll(ctx context.Context, params *SearchParams) iter.Seq2[*EnrichedEvent, error] {
+	return func(yield func(*EnrichedEvent, error) bool) {
+		var page SearchParams
+		if params != nil {
+			page = *params
+		}
+		if page.Limit == 0 {
+			page.Limit = defaultPageSize
+		}
+
+		for {
+			results, err := client.Search(ctx, &page)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, event := range results.Results {
+				if !yield(event, nil) {
+					return
+				}
+			}
+
+			page.Offset += len(results.Results)
+			if len(results.Results) < page.Limit || page.Offset >= results.Total {
+				return
+			}
+		}
+	}
+}
+
+// WorkResults are the events matching a search, with permits grouped into
+// works, and other events by street.
+type WorkResults struct {
+	Works       []*EnrichedWork  `json:"works"`
+	Streets     []*models.Street `json:"streets"`
+	Facets      *models.RefData  `json:"facets,omitempty"`
+	Attribution []string         `json:"attribution"`
+}
+
+// SearchWorks finds the events matching the criteria, grouped by work. Paging
+// is not supported.
+func (client *Client) SearchWorks(ctx context.Context, params *SearchParams) (*WorkResults, error) {
+	values := params.values()
+	values.Set("group_by", "work")
+
+	var results WorkResults
+	if err := client.get(ctx, "/search", values, &results); err != nil {
+		return nil, errors.Wrap(err, "search failed")
+	}
+	return &results, nil
+}
+
+// RefDataResults are the counts of each facet value.
+type RefDataResults struct {
+	RefData models.RefData `json:"refdata"`
+	// Labels of every code, keyed by facet then code, when requested
+	Labels      map[string]map[string]*models.CodeLabel `json:"labels,omitempty"`
+	Attribution []string                                `json:"attribution"`
+}
+
+// RefData counts each facet value over every event, or, given a BBox or
+// Query, over the events matching the criteria. Paging is not supported.
+func (client *Client) RefData(ctx context.Context, params *SearchParams) (*RefDataResults, error) {
+	values := params.values()
+	values.Del("facet_counts")
+	values.Del("limit")
+	values.Del("offset")
+
+	var results RefDataResults
+	if err := client.get(ctx, "/refdata", values, &results); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch reference data")
+	}
+	return &results, nil
+}
+
+// Object looks up the latest event of an object, or nil if there is none.
+func (client *Client) Object(ctx context.Context, objectReference string) (*EnrichedEvent, error) {
+	var response struct {
+		Result *EnrichedEvent `json:"result"`
+	}
+	err := client.get(ctx, "/objects/"+url.PathEscape(objectReference), nil, &response)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up object")
+	}
+	return response.Result, nil
+}
+
+// Work looks up the permits raised against a work, or nil if there are none.
+func (client *Client) Work(ctx context.Context, workReferenceNumber string) (*EnrichedWork, error) {
+	var response struct {
+		Result *EnrichedWork `json:"result"`
+	}
+	err := client.get(ctx, "/works/"+url.PathEscape(workReferenceNumber), nil, &response)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up work")
+	}
+	return response.Result, nil
+}
+
+// Street finds the most recent 100 events on a street, within the window (or
+// the default, if nil).
+func (client *Client) Street(ctx context.Context, usrn string, window *models.TemporalFilters) ([]*EnrichedEvent, error) {
+	events, err := client.events(ctx, "/streets/"+url.PathEscape(usrn), window)
+	return events, errors.Wrap(err, "failed to look up street")
+}
+
+// PromoterEvents finds the most recent 100 events of a promoter, by SWA code,
+// within the window (or the default, if nil).
+func (client *Client) PromoterEvents(ctx context.Context, swaCode string, window *models.TemporalFilters) ([]*EnrichedEvent, error) {
+	events, err := client.events(ctx, "/promoters/"+url.PathEscape(swaCode)+"/events", window)
+	return events, errors.Wrap(err, "failed to look up promoter events")
+}
+
+func (client *Client) events(ctx context.Context, path string, window *models.TemporalFilters) ([]*EnrichedEvent, error) {
+	values := url.Values{}
+	addWindow(values, window)
+
+	var response struct {
+		Results []*EnrichedEvent `json:"results"`
+	}
+	if err := client.get(ctx, path, values, &response); err != nil {
+		return nil, err
+	}
+	return response.Results, nil
+}
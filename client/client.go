@@ -0,0 +1,184 @@
+// Package client is a typed Go client for the relay API, which retries
+// requests that fail transiently, such as when rate limited or while the
+// server restarts.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	basePath       = "/v1/street-manager-relay"
+	userAgent      = "street-manager-relay-client"
+	defaultRetries = 3
+	defaultBackoff = 250 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// Client calls the API of a relay server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	apiKey     string
+}
+
+type Option func(client *Client)
+
+// WithHTTPClient sets the HTTP client used to make requests, e.g. to set a
+// timeout or transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithAPIKey sets the key sent with each request, as issued by the relay's
+// operator.
+func WithAPIKey(apiKey string) Option {
+	return func(client *Client) {
+		client.apiKey = apiKey
+	}
+}
+
+// WithRetries sets how many times a request is retried after a transient
+// failure, and the delay before the first retry, which doubles for each after
+// (unless the server asks to retry after a given time).
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.retries = retries
+		client.backoff = backoff
+	}
+}
+
+// New creates a client for the server at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid base URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Newf("invalid base URL %q: must be an absolute http(s) URL", baseURL)
+	}
+
+	client := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client, nil
+}
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode int
+	Message    string
+
+	retryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("relay API returned %d: %s", err.StatusCode, err.Message)
+}
+
+// isNotFound reports whether the API responded 404 Not Found.
+func isNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// get fetches a JSON response into out, retrying transient failures.
+func (client *Client) get(ctx context.Context, path string, params url.Values, out any) error {
+	endpoint := client.baseURL + basePath + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = client.try(ctx, endpoint, out)
+		if err == nil || !retry || attempt >= client.retries {
+			return err
+		}
+
+		timer := time.NewTimer(client.delay(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), "request cancelled while waiting to retry")
+		case <-timer.C:
+		}
+	}
+}
+
+// try makes a single request, reporting whether a failure is worth retrying:
+// network errors, rate limiting and server errors are, but not bad requests.
+func (client *Client) try(ctx context.Context, endpoint string, out any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if client.apiKey != "" {
+		req.Header.Set("X-API-Key", client.apiKey)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		var netErr net.Error
+		retry := ctx.Err() == nil && (errors.As(err, &netErr) || errors.Is(err, net.ErrClosed))
+		return retry, errors.Wrap(err, "request failed")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			apiErr.Message = body.Error
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			apiErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+
+		retry := resp.StatusCode == http.StatusTooManyRequests ||
+			(resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented)
+		return retry, apiErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, errors.Wrap(err, "failed to decode response")
+	}
+	return false, nil
+}
+
+// delay is how long to wait before retrying, as the server asks, or else
+// backing off exponentially.
+func (client *Client) delay(attempt int, err error) time.Duration {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return min(apiErr.retryAfter, maxBackoff)
+	}
+	return min(client.backoff<<attempt, maxBackoff)
+}
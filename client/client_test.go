@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestSearchParamsValues(t *testing.T) {
+	asAt := time.Date(2025, 6, 1, 9, 30, 0, 0, time.FixedZone("BST", 3600))
+	facets := make(models.Facets)
+	facets.Add("work_status_ref", "in_progress")
+	facets.Add("work_status_ref", "!planned")
+
+	tests := []struct {
+		name     string
+		params   *SearchParams
+		expected string
+	}{
+		{
+			name:     "None",
+			params:   nil,
+			expected: "",
+		},
+		{
+			name:     "BBox and query",
+			params:   &SearchParams{BBox: &models.BBox{MinX: 530000, MinY: 180000.5, MaxX: 531000, MaxY: 181000}, Query: "high st"},
+			expected: "bbox=530000%2C180000.5%2C531000%2C181000&q=high+st",
+		},
+		{
+			name:     "Facets with exclusions",
+			params:   &SearchParams{Query: "x", Facets: facets},
+			expected: "q=x&work_status_ref=in_progress&work_status_ref__not=planned",
+		},
+		{
+			name:     "Window",
+			params:   &SearchParams{Query: "x", Window: &models.TemporalFilters{MaxDaysAhead: 28, AsAt: &asAt}},
+			expected: "as_at=2025-06-01T08%3A30%3A00Z&max_days_ahead=28&max_days_behind=0&q=x",
+		},
+		{
+			name:     "Page and options",
+			params:   &SearchParams{Query: "x", Labels: true, FacetCounts: true, Limit: 10, Offset: 20},
+			expected: "facet_counts=true&labels=true&limit=10&offset=20&q=x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.params.values().Encode(); actual != tt.expected {
+				t.Errorf("got %s, want %s", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int32
+		err      int
+	}{
+		{name: "Succeeds", statuses: []int{http.StatusOK}, attempts: 1},
+		{name: "Retries rate limiting", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, attempts: 2},
+		{name: "Retries server errors", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, attempts: 3},
+		{name: "Gives up", statuses: []int{http.StatusServiceUnavailable}, attempts: 3, err: http.StatusServiceUnavailable},
+		{name: "Does not retry bad requests", statuses: []int{http.StatusBadRequest}, attempts: 1, err: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-API-Key") != "smr_test" {
+					t.Errorf("missing API key header")
+				}
+				status := tt.statuses[min(int(attempts.Add(1))-1, len(tt.statuses)-1)]
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write([]byte(`{"results":[{"event_type":"WORK_START"}],"attribution":["test"]}`))
+				} else {
+					_, _ = w.Write([]byte(`{"error":"failed"}`))
+				}
+			}))
+			defer server.Close()
+
+			client, err := New(server.URL, WithAPIKey("smr_test"), WithRetries(2, time.Millisecond))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			results, err := client.Search(context.Background(), &SearchParams{Query: "x"})
+			if attempts.Load() != tt.attempts {
+				t.Errorf("got %d attempts, want %d", attempts.Load(), tt.attempts)
+			}
+			if tt.err != 0 {
+				var apiErr *Error
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.err || apiErr.Message != "failed" {
+					t.Fatalf("got error %v, want %d", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results.Results) != 1 || results.Results[0].EventType != "WORK_START" {
+				t.Errorf("unexpected results: %+v", results)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidURLs(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "ftp://example.com", "http://"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("expected an error for %q", baseURL)
+		}
+	}
+}
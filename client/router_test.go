@@ -0,0 +1,251 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/routes"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newTestClient runs the real router over a database of a few events, on
+// two streets, returning a client for it.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	repo, err := internal.NewDbRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	start := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second)
+	end := start.Add(72 * time.Hour)
+	events := []*models.Event{
+		{
+			ObjectReference: "P-1", EventType: "WORK_START", USRN: ptr("1001"), StreetName: ptr("HIGH STREET"),
+			WorkReferenceNumber: ptr("W1"), PermitReferenceNumber: ptr("W1-01"), WorkStatusRef: ptr("in_progress"),
+			PromoterSWACode: ptr("7001"), PromoterOrganisation: ptr("Water Co"),
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		},
+		{
+			ObjectReference: "P-2", EventType: "PERMIT_GRANTED", USRN: ptr("1001"), StreetName: ptr("HIGH STREET"),
+			WorkReferenceNumber: ptr("W1"), PermitReferenceNumber: ptr("W1-02"), WorkStatusRef: ptr("planned"),
+			PromoterSWACode: ptr("7001"), PromoterOrganisation: ptr("Water Co"),
+			WorksLocationCoordinates: ptr("POINT(530200 180200)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		},
+		{
+			ObjectReference: "P-3", EventType: "WORK_START", USRN: ptr("1002"), StreetName: ptr("STATION ROAD"),
+			WorkReferenceNumber: ptr("W2"), PermitReferenceNumber: ptr("W2-01"), WorkStatusRef: ptr("in_progress"),
+			PromoterSWACode: ptr("7002"), PromoterOrganisation: ptr("Gas Co"),
+			WorksLocationCoordinates: ptr("POINT(530300 180300)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		},
+	}
+
+	batch, err := repo.BatchUpsert()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for idx, event := range events {
+		event.EventReference = ptr(int64(idx + 1))
+		if _, err := batch.Upsert(event); err != nil {
+			t.Fatalf("unexpected error: %v", batch.Abort(err))
+		}
+	}
+	if err := batch.Done(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	catalogue, err := codelist.GetCatalogue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := gin.New()
+	err = routes.Register(r, &routes.Dependencies{
+		Repo:          repo,
+		Organisations: promoter.Organisations{"7001": {Id: "7001", Name: "Water Co", Url: "https://water.example.com"}},
+		Catalogue:     catalogue,
+		Broker:        stream.NewBroker(10),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client
+}
+
+func permitRefs(events []*EnrichedEvent) []string {
+	refs := make([]string, 0, len(events))
+	for _, event := range events {
+		refs = append(refs, *event.PermitReferenceNumber)
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+func TestSearchAgainstRouter(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	bbox := &models.BBox{MinX: 530000, MinY: 180000, MaxX: 531000, MaxY: 181000}
+
+	inProgress := make(models.Facets)
+	inProgress.Add("work_status_ref", "in_progress")
+	notWaterCo := make(models.Facets)
+	notWaterCo.Add("promoter_organisation", "!Water Co")
+
+	tests := []struct {
+		name     string
+		params   *SearchParams
+		expected []string
+		total    int
+	}{
+		{name: "BBox", params: &SearchParams{BBox: bbox}, expected: []string{"W1-01", "W1-02", "W2-01"}},
+		{name: "Query", params: &SearchParams{Query: "station"}, expected: []string{"W2-01"}},
+		{name: "Facet", params: &SearchParams{BBox: bbox, Facets: inProgress}, expected: []string{"W1-01", "W2-01"}},
+		{name: "Excluded facet", params: &SearchParams{BBox: bbox, Facets: notWaterCo}, expected: []string{"W2-01"}},
+		{name: "Past window", params: &SearchParams{BBox: bbox, Window: &models.TemporalFilters{AsAt: ptr(time.Now().AddDate(0, 0, -30))}}, expected: []string{}},
+		{name: "Page", params: &SearchParams{BBox: bbox, Limit: 2, Offset: 1}, expected: []string{"W1-02", "W2-01"}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := client.Search(ctx, tt.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if refs := permitRefs(results.Results); !slices.Equal(refs, tt.expected) {
+				t.Errorf("got %v, want %v", refs, tt.expected)
+			}
+			if results.Total != tt.total {
+				t.Errorf("got total %d, want %d", results.Total, tt.total)
+			}
+			if len(results.Attribution) == 0 {
+				t.Error("expected attribution")
+			}
+		})
+	}
+
+	t.Run("Enriched", func(t *testing.T) {
+		results, err := client.Search(ctx, &SearchParams{Query: "high", Labels: true, FacetCounts: true, Limit: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		event := results.Results[0]
+		if event.PromoterWebsiteURL == nil || *event.PromoterWebsiteURL != "https://water.example.com" {
+			t.Errorf("expected the promoter website, got %v", event.PromoterWebsiteURL)
+		}
+		if event.Labels["work_status_ref"] == "" {
+			t.Errorf("expected a work status label, got %v", event.Labels)
+		}
+		if (*results.Facets)["work_status_ref"]["planned"] != 1 {
+			t.Errorf("unexpected facet counts: %v", results.Facets)
+		}
+	})
+
+	t.Run("All pages", func(t *testing.T) {
+		var refs []string
+		for event, err := range client.SearchAll(ctx, &SearchParams{BBox: bbox, Limit: 2}) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			refs = append(refs, *event.PermitReferenceNumber)
+		}
+		slices.Sort(refs)
+		if !slices.Equal(refs, []string{"W1-01", "W1-02", "W2-01"}) {
+			t.Errorf("got %v", refs)
+		}
+	})
+
+	t.Run("All pages without params", func(t *testing.T) {
+		for _, err := range client.SearchAll(ctx, nil) {
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+				t.Errorf("expected a bad request, got %v", err)
+			}
+		}
+	})
+
+	t.Run("Bad request", func(t *testing.T) {
+		_, err := client.Search(ctx, &SearchParams{})
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+			t.Errorf("expected a bad request, got %v", err)
+		}
+	})
+}
+
+func TestLookupsAgainstRouter(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	event, err := client.Object(ctx, "P-3")
+	if err != nil || event == nil || *event.PermitReferenceNumber != "W2-01" {
+		t.Errorf("unexpected object %v, %v", event, err)
+	}
+
+	event, err = client.Object(ctx, "P-9")
+	if err != nil || event != nil {
+		t.Errorf("expected no object, got %v, %v", event, err)
+	}
+
+	work, err := client.Work(ctx, "W1")
+	if err != nil || work == nil || len(work.Permits) != 2 || work.PromoterWebsiteURL == nil {
+		t.Errorf("unexpected work %v, %v", work, err)
+	}
+
+	work, err = client.Work(ctx, "W9")
+	if err != nil || work != nil {
+		t.Errorf("expected no work, got %v, %v", work, err)
+	}
+
+	events, err := client.Street(ctx, "1001", nil)
+	if refs := permitRefs(events); err != nil || !slices.Equal(refs, []string{"W1-01", "W1-02"}) {
+		t.Errorf("unexpected street events %v, %v", refs, err)
+	}
+
+	events, err = client.PromoterEvents(ctx, "7002", &models.TemporalFilters{MaxDaysAhead: 7, MaxDaysBehind: 7})
+	if refs := permitRefs(events); err != nil || !slices.Equal(refs, []string{"W2-01"}) {
+		t.Errorf("unexpected promoter events %v, %v", refs, err)
+	}
+
+	works, err := client.SearchWorks(ctx, &SearchParams{Query: "high"})
+	if err != nil || len(works.Works) != 1 || works.Works[0].WorkReferenceNumber != "W1" {
+		t.Errorf("unexpected works %v, %v", works, err)
+	}
+
+	refData, err := client.RefData(ctx, &SearchParams{Query: "station", Labels: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refData.RefData["promoter_organisation"]["Gas Co"] != 1 || refData.RefData["promoter_organisation"]["Water Co"] != 0 {
+		t.Errorf("unexpected refdata %v", refData.RefData)
+	}
+	if len(refData.Labels) == 0 {
+		t.Error("expected labels")
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/apikey"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// CreateAPIKey issues a new key, printing it: it is only stored hashed, so
+// cannot be shown again.
+func CreateAPIKey(dbPath string, name string, ratePerMinute int, burst int) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if ratePerMinute < 1 || burst < 1 {
+		return errors.New("rate and burst must be positive")
+	}
+
+	return withRepo(dbPath, func(repo *internal.DbRepository) error {
+		key, hash, prefix, err := apikey.Generate()
+		if err != nil {
+			return err
+		}
+
+		apiKey := &models.APIKey{Name: name, Prefix: prefix, RatePerMinute: ratePerMinute, Burst: burst}
+		if err := repo.CreateAPIKey(apiKey, hash); err != nil {
+			return err
+		}
+
+		log.Printf("Created API key %d for %s, limited to %d requests a minute in bursts of %d", apiKey.ID, name, ratePerMinute, burst)
+		fmt.Println(key)
+		return nil
+	})
+}
+
+// ListAPIKeys prints every key, without the keys themselves.
+func ListAPIKeys(dbPath string) error {
+	return withRepo(dbPath, func(repo *internal.DbRepository) error {
+		keys, err := repo.APIKeys()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tNAME\tPREFIX\tRATE/MIN\tBURST\tCREATED\tREVOKED")
+		for _, key := range keys {
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s…\t%d\t%d\t%s\t%s\n",
+				key.ID, key.Name, key.Prefix, key.RatePerMinute, key.Burst, key.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+	})
+}
+
+// RevokeAPIKey revokes a key, which servers stop accepting within a minute.
+func RevokeAPIKey(dbPath string, id int64) error {
+	return withRepo(dbPath, func(repo *internal.DbRepository) error {
+		revoked, err := repo.RevokeAPIKey(id)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return errors.Newf("no API key %d, or it is already revoked", id)
+		}
+
+		log.Printf("Revoked API key %d", id)
+		return nil
+	})
+}
+
+func withRepo(dbPath string, fn func(repo *internal.DbRepository) error) error {
+	repo, err := internal.NewDbRepository(dbPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize db repository")
+	}
+	defer func() {
+		if err := repo.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	return fn(repo)
+}
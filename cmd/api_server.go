@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Depado/ginprom"
@@ -14,24 +17,29 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kofalt/go-memoize"
 	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/apikey"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
 	"github.com/rm-hull/street-manager-relay/internal/promoter"
 	"github.com/rm-hull/street-manager-relay/internal/routes"
-	"github.com/tavsec/gin-healthcheck/checks"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/internal/webhook"
 
 	"github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
-
-	healthcheck "github.com/tavsec/gin-healthcheck"
-	hc_config "github.com/tavsec/gin-healthcheck/config"
 )
 
-func ApiServer(dbPath string, port int, debug bool) {
+func ApiServer(dbPath string, port int, debug bool, requireAPIKey bool, allowedOrigins []string, trustedProxies []string) {
 
 	organisations, err := promoter.GetPromoterOrgsMap()
 	if err != nil {
 		log.Fatalf("failed to initialize promoter organisations: %v", err)
 	}
 
+	catalogue, err := codelist.GetCatalogue()
+	if err != nil {
+		log.Fatalf("failed to initialize code list catalogue: %v", err)
+	}
+
 	repo, err := internal.NewDbRepository(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize db repository: %v", err)
@@ -47,6 +55,7 @@ func ApiServer(dbPath string, port int, debug bool) {
 		Debug:       debug,
 		Release:     versioninfo.Revision[:7],
 		Environment: os.Getenv("MODE"),
+		BeforeSend:  scrubAPIKey,
 	})
 	if err != nil {
 		log.Fatalf("sentry.Init: %s", err)
@@ -54,6 +63,19 @@ func ApiServer(dbPath string, port int, debug bool) {
 	defer sentry.Flush(2 * time.Second)
 
 	r := gin.New()
+	// The same proxies are trusted for the client IP (as logged) as for links
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+
+	corsConfig := cors.DefaultConfig()
+	if len(allowedOrigins) > 0 {
+		corsConfig.AllowOrigins = allowedOrigins
+	} else {
+		corsConfig.AllowAllOrigins = true
+	}
+	corsConfig.AddAllowHeaders(apikey.Header, "Authorization")
+	corsConfig.AddExposeHeaders("X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After")
 
 	prometheus := ginprom.New(
 		ginprom.Engine(r),
@@ -62,6 +84,8 @@ func ApiServer(dbPath string, port int, debug bool) {
 	)
 
 	r.Use(
+		// Before anything that records the request, such as Sentry and the logger
+		apikey.StripQueryParam(),
 		sentrygin.New(sentrygin.Options{
 			Repanic:         true,
 			WaitForDelivery: false,
@@ -70,8 +94,8 @@ func ApiServer(dbPath string, port int, debug bool) {
 		gin.Recovery(),
 		gin.LoggerWithWriter(gin.DefaultWriter, "/healthz", "/metrics"),
 		prometheus.Instrument(),
-		compress.Compress(),
-		cors.Default(),
+		compress.Compress(compress.WithExcludeFunc(isStreaming)),
+		cors.New(corsConfig),
 		sentryErrorHandler(),
 	)
 
@@ -80,18 +104,32 @@ func ApiServer(dbPath string, port int, debug bool) {
 		pprof.Register(r)
 	}
 
-	err = healthcheck.New(r, hc_config.DefaultConfig(), []checks.Check{
-		repo.HealthCheck(),
-	})
-	if err != nil {
-		log.Fatalf("failed to initialize healthcheck: %v", err)
-	}
-
 	certManager := internal.NewCertManager(memoize.NewMemoizer(24*time.Hour, 1*time.Hour))
+	broker := stream.NewBroker(100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go webhook.NewWorker(repo).Run(ctx, broker)
+
+	deps := &routes.Dependencies{
+		Repo:           repo,
+		Organisations:  organisations,
+		Catalogue:      catalogue,
+		CertManager:    certManager,
+		Broker:         broker,
+		AllowedOrigins: allowedOrigins,
+		TrustedProxies: trustedProxies,
+	}
+	if requireAPIKey {
+		deps.Authenticator = apikey.NewAuthenticator(repo)
+	} else {
+		log.Println("WARNING: API keys are not required. Do not run without them in production.")
+	}
 
-	r.POST("/v1/street-manager-relay/sns", routes.HandleSNSMessage(repo, certManager))
-	r.GET("/v1/street-manager-relay/search", routes.HandleSearch(repo, organisations))
-	r.GET("/v1/street-manager-relay/refdata", routes.HandleRefData(repo, memoize.NewMemoizer(10*time.Minute, 1*time.Hour)))
+	err = routes.Register(r, deps)
+	if err != nil {
+		log.Fatalf("failed to register routes: %v", err)
+	}
 
 	addr := fmt.Sprintf(":%d", port)
 	log.Printf("Starting HTTP API Server on port %d...", port)
@@ -99,6 +137,21 @@ func ApiServer(dbPath string, port int, debug bool) {
 	log.Fatalf("HTTP API Server failed to start on port %d: %v", port, err)
 }
 
+// isStreaming excludes long-lived responses from compression, which would
+// otherwise buffer them (or, for websockets, prevent the upgrade).
+func isStreaming(c *gin.Context) bool {
+	return strings.HasSuffix(c.Request.URL.Path, "/stream") || strings.HasSuffix(c.Request.URL.Path, "/live")
+}
+
+// scrubAPIKey removes the API key header from requests reported with errors,
+// which, unlike the Authorization header, Sentry doesn't know to leave out.
+func scrubAPIKey(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	if event.Request != nil {
+		delete(event.Request.Headers, http.CanonicalHeaderKey(apikey.Header))
+	}
+	return event
+}
+
 func sentryErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
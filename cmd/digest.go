@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/digest"
+)
+
+// Digest sends the digests for the watch-list, either once covering the
+// preceding 24 hours, or daily at the given time of day (HH:MM).
+func Digest(dbPath string, watchListPath string, at string, dryRun bool) error {
+	watches, err := digest.LoadWatchList(watchListPath)
+	if err != nil {
+		return err
+	}
+
+	repo, err := internal.NewDbRepository(dbPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize db repository")
+	}
+	defer func() {
+		if err := repo.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	var mailer digest.Mailer = &digest.WriterMailer{W: os.Stdout}
+	if !dryRun {
+		if mailer, err = digest.SMTPMailerFromEnv(); err != nil {
+			return err
+		}
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" && !dryRun {
+		return errors.New("SMTP_FROM is not set")
+	}
+
+	digester := &digest.Digester{Store: repo, Mailer: mailer, From: from, Watches: watches}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if at == "" {
+		now := time.Now()
+		return digester.Send(ctx, now.AddDate(0, 0, -1), now)
+	}
+
+	timeOfDay, err := time.Parse("15:04", at)
+	if err != nil {
+		return errors.Wrapf(err, "invalid time of day '%s', expected HH:MM", at)
+	}
+
+	digester.RunDaily(ctx, time.Duration(timeOfDay.Hour())*time.Hour+time.Duration(timeOfDay.Minute())*time.Minute)
+	return nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/gpkg"
+	"github.com/rm-hull/street-manager-relay/internal/tabular"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// ExportFilters restrict which events are exported; each is optional.
+type ExportFilters struct {
+	BBox string
+	// Facets are given as facet=value, as per the search parameters
+	Facets []string
+	From   string
+	To     string
+}
+
+var layerNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Export writes the current state of the events to a new GeoPackage, with a
+// layer for each object type (permit, activity, section 58, etc.), whose
+// geometries are in British National Grid (EPSG:27700).
+func Export(dbPath string, outPath string, filters ExportFilters) error {
+	bbox, facets, from, to, err := filters.parse()
+	if err != nil {
+		return err
+	}
+
+	repo, err := internal.NewDbRepository(dbPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize db repository")
+	}
+	defer func() {
+		if err := repo.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	out, err := gpkg.Create(outPath)
+	if err != nil {
+		return err
+	}
+
+	columns := append([]tabular.Column[models.Event]{{
+		Name:  "object_reference",
+		Type:  "TEXT",
+		Value: func(event *models.Event) string { return event.ObjectReference },
+	}}, tabular.Columns[models.Event]()...)
+
+	gpkgColumns := make([]gpkg.Column, len(columns))
+	for idx, column := range columns {
+		gpkgColumns[idx] = gpkg.Column{Name: column.Name, Type: column.Type}
+	}
+
+	layers := make(map[string]*gpkg.Layer)
+	skipped := 0
+	err = repo.ExportEach(bbox, facets, from, to, func(event *models.Event) error {
+		name := layerName(event.ObjectType)
+		layer, ok := layers[name]
+		if !ok {
+			var err error
+			description := "Street Manager " + strings.ReplaceAll(name, "_", " ") + " events"
+			if layer, err = out.CreateLayer(name, description, gpkg.SRSBritishNationalGrid, gpkgColumns); err != nil {
+				return err
+			}
+			layers[name] = layer
+		}
+
+		g, err := event.Geometry()
+		if err != nil {
+			// Kept, without a geometry, so that the attributes are still available
+			g = nil
+			skipped++
+		}
+
+		values := make([]any, len(columns))
+		for idx, column := range columns {
+			if value := column.Value(event); value != "" {
+				values[idx] = value
+			}
+		}
+		return layer.Insert(g, values...)
+	})
+	if err != nil {
+		_ = out.Abort()
+		_ = os.Remove(outPath)
+		return errors.Wrap(err, "failed to export events")
+	}
+
+	if err := out.Close(); err != nil {
+		_ = os.Remove(outPath)
+		return err
+	}
+
+	for name, layer := range layers {
+		log.Printf("Exported %d features to layer %s", layer.Count(), name)
+	}
+	if skipped > 0 {
+		log.Printf("%d features have no (valid) geometry", skipped)
+	}
+	return nil
+}
+
+func (filters ExportFilters) parse() (bbox *models.BBox, facets *models.Facets, from *time.Time, to *time.Time, err error) {
+	if filters.BBox != "" {
+		if bbox, err = models.BoundingBoxFromCSV(filters.BBox); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	params := make(map[string][]string)
+	for _, facet := range filters.Facets {
+		key, value, ok := strings.Cut(facet, "=")
+		if !ok {
+			return nil, nil, nil, nil, errors.Newf("facet '%s' must be given as facet=value", facet)
+		}
+		params[key] = append(params[key], value)
+	}
+	parsed, err := models.FacetsFromMap(params)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	facets = &parsed
+
+	for _, bound := range []struct {
+		value  string
+		name   string
+		target **time.Time
+	}{{filters.From, "from", &from}, {filters.To, "to", &to}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := models.ParseTimestamp(bound.value)
+		if err != nil {
+			return nil, nil, nil, nil, errors.Wrapf(err, "invalid %s", bound.name)
+		}
+		*bound.target = &t
+	}
+	return bbox, facets, from, to, nil
+}
+
+// layerName is the object type as a table name, e.g. "section_58" for SECTION_58.
+func layerName(objectType *string) string {
+	if objectType == nil {
+		return "other"
+	}
+
+	name := strings.Trim(layerNamePattern.ReplaceAllString(strings.ToLower(*objectType), "_"), "_")
+	switch {
+	case name == "":
+		return "other"
+	case name[0] >= '0' && name[0] <= '9':
+		return "_" + name
+	default:
+		return name
+	}
+}
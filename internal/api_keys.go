@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const apiKeyColumns = `id, name, prefix, rate_per_minute, burst, created_at, revoked_at`
+
+// CreateAPIKey stores a new key, given the hash of the key itself.
+func (repo *DbRepository) CreateAPIKey(key *models.APIKey, keyHash string) error {
+	now := time.Now().UTC()
+	err := repo.db.QueryRow(`
+		INSERT INTO api_keys (name, prefix, key_hash, rate_per_minute, burst, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		key.Name, key.Prefix, keyHash, key.RatePerMinute, key.Burst, now,
+	).Scan(&key.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert API key")
+	}
+
+	key.CreatedAt = now
+	return nil
+}
+
+// APIKeys lists every key, including those revoked.
+func (repo *DbRepository) APIKeys() ([]*models.APIKey, error) {
+	rows, err := repo.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query API keys")
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over rows")
+	}
+	return keys, nil
+}
+
+// FindAPIKey returns the key with the hash, or nil if there is none or it has
+// been revoked.
+func (repo *DbRepository) FindAPIKey(keyHash string) (*models.APIKey, error) {
+	row := repo.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`, keyHash)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return key, err
+}
+
+// RevokeAPIKey revokes a key, returning false if it does not exist or was
+// already revoked.
+func (repo *DbRepository) RevokeAPIKey(id int64) (bool, error) {
+	result, err := repo.db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to revoke API key")
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get rows affected")
+	}
+	return revoked > 0, nil
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.RatePerMinute, &key.Burst, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return nil, errors.Wrap(err, "failed to scan API key")
+	}
+	return &key, nil
+}
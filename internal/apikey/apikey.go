@@ -0,0 +1,253 @@
+// Package apikey authenticates API requests by key, limiting the rate of each
+// key's requests with a token bucket.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/kofalt/go-memoize"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	// Header is the request header the key is given in. It may instead be
+	// given as a bearer token, or as the QueryParam for clients that cannot
+	// set headers, such as browsers' EventSource and WebSocket.
+	Header     = "X-API-Key"
+	QueryParam = "api_key"
+
+	// ContextKey is where the key is set on the gin context
+	ContextKey = "apiKey"
+
+	// Where a key given as the QueryParam is kept once removed from the query
+	queryParamContextKey = "apiKeyQueryParam"
+
+	keyPrefix    = "smr_"
+	prefixLength = len(keyPrefix) + 8
+
+	// How long keys are cached for, and so how long revoking a key takes
+	cacheTTL = time.Minute
+)
+
+var errUnknownKey = errors.New("unknown API key")
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_key_requests_total",
+	Help: "Requests made with each API key, by whether they were allowed or rate limited.",
+}, []string{"key_id", "name", "outcome"})
+
+// Generate creates a new random key, returning it with its hash, which is
+// all that should be stored, and its prefix.
+func Generate() (key string, hash string, prefix string, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", errors.Wrap(err, "failed to generate API key")
+	}
+	key = keyPrefix + hex.EncodeToString(secret)
+	return key, Hash(key), key[:prefixLength], nil
+}
+
+// Hash is the hex SHA-256 of a key. Keys are random, so need no salt or
+// stretching.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store finds keys by their hash, returning nil if there is none or it has
+// been revoked.
+type Store interface {
+	FindAPIKey(hash string) (*models.APIKey, error)
+}
+
+// Authenticator checks the key of each request, and keeps a token bucket for
+// each key. It is safe for concurrent use.
+type Authenticator struct {
+	store Store
+	cache *memoize.Memoizer
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+func NewAuthenticator(store Store) *Authenticator {
+	return &Authenticator{
+		store:   store,
+		cache:   memoize.NewMemoizer(cacheTTL, 10*time.Minute),
+		now:     time.Now,
+		buckets: make(map[int64]*bucket),
+	}
+}
+
+// Middleware rejects requests without a valid key (401), or beyond the key's
+// rate limit (429), setting quota headers on each response: the bucket size
+// (X-RateLimit-Limit), the requests left in it (X-RateLimit-Remaining), the
+// seconds until it is full (X-RateLimit-Reset), and when rejected, the
+// seconds until a request will be allowed (Retry-After).
+func (auth *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFrom(c)
+		if key == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="street-manager-relay"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			return
+		}
+
+		apiKey, err := auth.lookup(key)
+		if errors.Is(err, errUnknownKey) {
+			c.Header("WWW-Authenticate", `Bearer realm="street-manager-relay", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up API key"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API key"})
+			return
+		}
+
+		allowed, q := auth.take(apiKey)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(q.limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(q.remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(seconds(q.reset)))
+
+		id := strconv.FormatInt(apiKey.ID, 10)
+		if !allowed {
+			requests.WithLabelValues(id, apiKey.Name, "rate_limited").Inc()
+			c.Header("Retry-After", strconv.Itoa(seconds(q.retryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+
+		requests.WithLabelValues(id, apiKey.Name, "allowed").Inc()
+		c.Set(ContextKey, apiKey)
+		c.Next()
+	}
+}
+
+// KeyID is the ID of the key the request was made with, or nil when keys are
+// not required.
+func KeyID(c *gin.Context) *int64 {
+	if apiKey, ok := c.Get(ContextKey); ok {
+		return &apiKey.(*models.APIKey).ID
+	}
+	return nil
+}
+
+// StripQueryParam removes a key given as the QueryParam from the request,
+// keeping it for the Middleware, so that it is not written to access logs or
+// reported with errors. It must come before any middleware that records
+// requests.
+func StripQueryParam() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stripQueryParam(c)
+		c.Next()
+	}
+}
+
+// stripQueryParam removes the QueryParam (if it has not already been), so
+// that it is neither rejected as unknown by the handlers, nor echoed back in
+// links, returning its value.
+func stripQueryParam(c *gin.Context) string {
+	if key, ok := c.Get(queryParamContextKey); ok {
+		return key.(string)
+	}
+
+	params := c.Request.URL.Query()
+	key := params.Get(QueryParam)
+	if params.Has(QueryParam) {
+		params.Del(QueryParam)
+		c.Request.URL.RawQuery = params.Encode()
+		c.Request.RequestURI = c.Request.URL.RequestURI()
+	}
+	c.Set(queryParamContextKey, key)
+	return key
+}
+
+// keyFrom reads the key from the request's header, bearer token or (as a last
+// resort) query string.
+func keyFrom(c *gin.Context) string {
+	key := stripQueryParam(c)
+	if header := c.GetHeader(Header); header != "" {
+		return header
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return key
+}
+
+// lookup finds the key, caching it, but not unknown keys, which would let
+// anyone fill the cache.
+func (auth *Authenticator) lookup(key string) (*models.APIKey, error) {
+	hash := Hash(key)
+	apiKey, err, _ := memoize.Call(auth.cache, hash, func() (*models.APIKey, error) {
+		apiKey, err := auth.store.FindAPIKey(hash)
+		if err == nil && apiKey == nil {
+			return nil, errUnknownKey
+		}
+		return apiKey, err
+	})
+	return apiKey, err
+}
+
+// quota is the state of a key's bucket after a request.
+type quota struct {
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// bucket holds tokens, one of which is taken by each request, and which are
+// refilled continuously up to the burst size.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (auth *Authenticator) take(apiKey *models.APIKey) (bool, quota) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	now := auth.now()
+	burst := float64(apiKey.Burst)
+	perSecond := float64(apiKey.RatePerMinute) / 60
+
+	b, ok := auth.buckets[apiKey.ID]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		auth.buckets[apiKey.ID] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	q := quota{limit: apiKey.Burst, remaining: int(b.tokens)}
+	if perSecond > 0 {
+		q.reset = time.Duration((burst - b.tokens) / perSecond * float64(time.Second))
+		q.retryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	return allowed, q
+}
+
+// seconds rounds up, so that clients waiting that long are not rejected again.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(max(d, 0).Seconds()))
+}
@@ -0,0 +1,151 @@
+package apikey
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+type fakeStore map[string]*models.APIKey
+
+func (store fakeStore) FindAPIKey(hash string) (*models.APIKey, error) {
+	if hash == Hash("smr_broken") {
+		return nil, errors.New("database is locked")
+	}
+	return store[hash], nil
+}
+
+func TestGenerate(t *testing.T) {
+	key, hash, prefix, err := Generate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, keyPrefix) || len(key) != len(keyPrefix)+48 {
+		t.Errorf("unexpected key %s", key)
+	}
+	if hash != Hash(key) || len(hash) != 64 {
+		t.Errorf("unexpected hash %s", hash)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != prefixLength {
+		t.Errorf("unexpected prefix %s", prefix)
+	}
+
+	other, _, _, _ := Generate()
+	if other == key {
+		t.Error("expected keys to differ")
+	}
+}
+
+func TestStripQueryParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := NewAuthenticator(fakeStore{Hash("smr_valid"): {ID: 1, Name: "Valid", RatePerMinute: 60, Burst: 2}})
+
+	var logged string
+	r := gin.New()
+	r.Use(StripQueryParam(), func(c *gin.Context) {
+		// As per gin's logger, which reads the query before calling the handlers
+		logged = c.Request.URL.RawQuery
+		c.Next()
+	}, auth.Middleware())
+	r.GET("/search", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Request.RequestURI)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?api_key=smr_valid&q=high", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if logged != "q=high" {
+		t.Errorf("got logged query %s, want q=high", logged)
+	}
+	if w.Body.String() != "/search?q=high" {
+		t.Errorf("got request URI %s, want /search?q=high", w.Body)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	auth := NewAuthenticator(fakeStore{
+		Hash("smr_valid"): {ID: 1, Name: "Valid", RatePerMinute: 60, Burst: 2},
+	})
+	auth.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.GET("/search", auth.Middleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"query": c.Request.URL.RawQuery, "key": c.MustGet(ContextKey).(*models.APIKey).Name})
+	})
+
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		advance time.Duration
+		status  int
+		body    string
+		quota   []string
+	}{
+		{name: "No key", url: "/search", status: http.StatusUnauthorized, body: `{"error":"API key required"}`},
+		{name: "Unknown key", url: "/search", headers: map[string]string{Header: "smr_other"}, status: http.StatusUnauthorized, body: `{"error":"Invalid API key"}`},
+		{name: "Store failure", url: "/search", headers: map[string]string{Header: "smr_broken"}, status: http.StatusInternalServerError},
+		{
+			name: "Header", url: "/search?q=high", headers: map[string]string{Header: "smr_valid"},
+			status: http.StatusOK, body: `{"key":"Valid","query":"q=high"}`, quota: []string{"2", "1", "1"},
+		},
+		{
+			name: "Bearer token, over a query param", url: "/search?api_key=smr_other&q=high", headers: map[string]string{"Authorization": "Bearer smr_valid"},
+			status: http.StatusOK, body: `{"key":"Valid","query":"q=high"}`, quota: []string{"2", "0", "2"},
+		},
+		{
+			name: "Rate limited", url: "/search?api_key=smr_valid",
+			status: http.StatusTooManyRequests, body: `{"error":"Rate limit exceeded"}`, quota: []string{"2", "0", "2", "1"},
+		},
+		{
+			name: "Query param, after a refill", url: "/search?api_key=smr_valid&q=high", advance: 1500 * time.Millisecond,
+			status: http.StatusOK, body: `{"key":"Valid","query":"q=high"}`, quota: []string{"2", "0", "2"},
+		},
+		{
+			name: "Refilled to the burst", url: "/search", headers: map[string]string{Header: "smr_valid"}, advance: time.Hour,
+			status: http.StatusOK, quota: []string{"2", "1", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("got %s, want %s", w.Body, tt.body)
+			}
+
+			quota := []string{w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"), w.Header().Get("X-RateLimit-Reset")}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != "" {
+				quota = append(quota, retryAfter)
+			}
+			if tt.quota == nil {
+				tt.quota = []string{"", "", ""}
+			}
+			if strings.Join(quota, ",") != strings.Join(tt.quota, ",") {
+				t.Errorf("got quota %v, want %v", quota, tt.quota)
+			}
+		})
+	}
+}
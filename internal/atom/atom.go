@@ -0,0 +1,88 @@
+// Package atom writes Atom (RFC 4287) syndication feeds.
+package atom
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const Namespace = "http://www.w3.org/2005/Atom"
+
+type Feed struct {
+	XMLName   xml.Name `xml:"feed"`
+	Namespace string   `xml:"xmlns,attr"`
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Subtitle  string   `xml:"subtitle,omitempty"`
+	Updated   Time     `xml:"updated"`
+	Links     []Link   `xml:"link"`
+	Author    *Person  `xml:"author,omitempty"`
+	Rights    string   `xml:"rights,omitempty"`
+	Generator string   `xml:"generator,omitempty"`
+	Entries   []*Entry `xml:"entry"`
+}
+
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    Time       `xml:"updated"`
+	Links      []Link     `xml:"link"`
+	Categories []Category `xml:"category"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Content    *Text      `xml:"content,omitempty"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type Person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type Text struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+// Time is formatted as an RFC 3339 date-time, as Atom requires.
+type Time time.Time
+
+func (t Time) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(time.Time(t).UTC().Format(time.RFC3339), start)
+}
+
+// NewFeed creates a feed with the Atom namespace set.
+func NewFeed(id string, title string, updated time.Time) *Feed {
+	return &Feed{
+		Namespace: Namespace,
+		ID:        id,
+		Title:     title,
+		Updated:   Time(updated),
+		Entries:   make([]*Entry, 0),
+	}
+}
+
+func (feed *Feed) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write feed")
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return errors.Wrap(err, "failed to encode feed")
+	}
+	return enc.Close()
+}
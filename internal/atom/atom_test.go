@@ -0,0 +1,45 @@
+package atom
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedWrite(t *testing.T) {
+	updated := time.Date(2025, 6, 1, 9, 30, 0, 0, time.FixedZone("BST", 3600))
+	feed := NewFeed("tag:example.com,2025:feed", "Roadworks & closures", updated)
+	feed.Links = []Link{{Href: "https://example.com/feed.atom", Rel: "self", Type: "application/atom+xml"}}
+	feed.Entries = append(feed.Entries, &Entry{
+		ID:         "tag:example.com,2025:event/42",
+		Title:      "PERMIT_GRANTED: High Street",
+		Updated:    Time(updated),
+		Categories: []Category{{Term: "PERMIT_GRANTED"}},
+		Content:    &Text{Type: "text", Body: "Promoter: <Water Co>"},
+	})
+
+	var sb strings.Builder
+	if err := feed.Write(&sb); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := sb.String()
+
+	for _, expected := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<title>Roadworks &amp; closures</title>`,
+		`<updated>2025-06-01T08:30:00Z</updated>`,
+		`<link href="https://example.com/feed.atom" rel="self" type="application/atom+xml"></link>`,
+		`<id>tag:example.com,2025:event/42</id>`,
+		`<category term="PERMIT_GRANTED"></category>`,
+		`<content type="text">Promoter: &lt;Water Co&gt;</content>`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("expected feed to contain %s, got:\n%s", expected, got)
+		}
+	}
+
+	if strings.Contains(got, "<summary") || strings.Contains(got, "<author") {
+		t.Errorf("expected empty optional elements to be omitted, got:\n%s", got)
+	}
+}
@@ -0,0 +1,56 @@
+package codelist
+
+import (
+	_ "embed"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+//go:embed codes.csv
+var codesCSV string
+
+// Catalogue maps facet -> code -> label
+type Catalogue map[string]map[string]*models.CodeLabel
+
+func GetCatalogue() (Catalogue, error) {
+	catalogue := make(Catalogue)
+	reader := strings.NewReader(codesCSV)
+
+	for record := range internal.ParseCSV(reader, true, models.CodeLabelFromCSV) {
+		if record.Error != nil {
+			return nil, errors.Wrap(record.Error, "failed to load code list catalogue")
+		}
+
+		label := record.Value
+		if _, ok := catalogue[label.Facet]; !ok {
+			catalogue[label.Facet] = make(map[string]*models.CodeLabel)
+		}
+		if _, ok := catalogue[label.Facet][label.Code]; ok {
+			return nil, errors.Newf("duplicate code detected: %s/%s", label.Facet, label.Code)
+		}
+		catalogue[label.Facet][label.Code] = label
+	}
+
+	return catalogue, nil
+}
+
+// Labels returns the label for each single-valued facet of the event that has one.
+func (catalogue Catalogue) Labels(event *models.Event) map[string]string {
+	labels := make(map[string]string)
+	for _, facet := range models.FacetRegistry {
+		if facet.Value == nil {
+			continue
+		}
+		value := facet.Value(event)
+		if value == nil {
+			continue
+		}
+		if label, ok := catalogue[facet.Param][*value]; ok {
+			labels[facet.Param] = label.Label
+		}
+	}
+	return labels
+}
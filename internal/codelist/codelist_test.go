@@ -0,0 +1,50 @@
+package codelist
+
+import (
+	"testing"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestGetCatalogue(t *testing.T) {
+	catalogue, err := GetCatalogue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	label, ok := catalogue["work_category_ref"]["paa"]
+	if !ok {
+		t.Fatal("expected a label for work_category_ref/paa")
+	}
+	if label.Label != "Provisional advance authorisation" || label.Description == nil {
+		t.Errorf("unexpected label: %+v", label)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	catalogue, err := GetCatalogue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	roadClosure := "road_closure"
+	unknown := "not_a_code"
+	labels := catalogue.Labels(&models.Event{
+		EventType:                "WORK_START",
+		TrafficManagementTypeRef: &roadClosure,
+		WorkStatusRef:            &unknown,
+	})
+
+	expected := map[string]string{
+		"event_type":                  "Work started",
+		"traffic_management_type_ref": "Road closure",
+	}
+	if len(labels) != len(expected) {
+		t.Fatalf("got %v, want %v", labels, expected)
+	}
+	for facet, label := range expected {
+		if labels[facet] != label {
+			t.Errorf("labels[%s] = %q, want %q", facet, labels[facet], label)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	_ "github.com/mattn/go-sqlite3"
@@ -19,18 +20,29 @@ var createSQL string
 //go:embed sql/search.sql
 var searchSQL string
 
-//go:embed sql/ref_data.sql
-var refDataSQL string
-
 type DbRepository struct {
 	db          *sql.DB
-	searchStmt  *sql.Stmt
 	refDataStmt *sql.Stmt
 }
 
 type Batch struct {
-	tx   *sql.Tx
-	stmt *sql.Stmt
+	tx          *sql.Tx
+	stmt        *sql.Stmt
+	historyStmt *sql.Stmt
+	changes     []*models.Change
+}
+
+// migrations lists columns added since the initial schema, which are applied
+// to pre-existing databases before the (idempotent) create script is run.
+var migrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"events", "object_type", "TEXT"},
+	{"events", "event_reference", "INTEGER"},
+	{"events", "event_time", "TIMESTAMP"},
+	{"webhook_subscriptions", "api_key_id", "INTEGER"},
 }
 
 func NewDbRepository(dbPath string) (*DbRepository, error) {
@@ -48,12 +60,7 @@ func NewDbRepository(dbPath string) (*DbRepository, error) {
 		return nil, errors.Wrap(err, "failed to create database")
 	}
 
-	searchStmt, err := db.Prepare(searchSQL)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to prepare search SQL")
-	}
-
-	refDataStmt, err := db.Prepare(refDataSQL)
+	refDataStmt, err := db.Prepare(refDataQuery())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to prepare ref-data SQL")
 	}
@@ -61,7 +68,6 @@ func NewDbRepository(dbPath string) (*DbRepository, error) {
 	log.Printf("Database initialized successfully: %s", dbPath)
 	return &DbRepository{
 		db:          db,
-		searchStmt:  searchStmt,
 		refDataStmt: refDataStmt,
 	}, nil
 }
@@ -72,10 +78,110 @@ func create(db *sql.DB) error {
 		return errors.Wrap(err, "error checking if table exists")
 	}
 	if exists {
-		return nil
+		if err := migrate(db); err != nil {
+			return errors.Wrap(err, "failed to migrate database")
+		}
 	}
-	_, err = db.Exec(createSQL)
-	return err
+
+	ftsExists, err := tablesExists(db, "events_fts")
+	if err != nil {
+		return errors.Wrap(err, "error checking if table exists")
+	}
+
+	conditionsExist, err := tablesExists(db, "event_permit_conditions")
+	if err != nil {
+		return errors.Wrap(err, "error checking if table exists")
+	}
+
+	if _, err = db.Exec(createSQL); err != nil {
+		return err
+	}
+
+	if exists && !ftsExists {
+		log.Println("Migrating: populating full-text index")
+		_, err = db.Exec(fmt.Sprintf(
+			"INSERT INTO events_fts (rowid, %s) SELECT id, %s FROM events",
+			strings.Join(ftsColumns, ", "), strings.Join(ftsColumns, ", ")))
+		if err != nil {
+			return errors.Wrap(err, "failed to populate full-text index")
+		}
+	}
+
+	if exists && !conditionsExist {
+		log.Println("Migrating: populating permit conditions")
+		tables := map[string]string{
+			"events":        "event_permit_conditions",
+			"event_history": "event_history_permit_conditions",
+		}
+		for source, target := range tables {
+			if err := populatePermitConditions(db, source, target); err != nil {
+				return errors.Wrapf(err, "failed to populate permit conditions for %s", source)
+			}
+		}
+	}
+	return nil
+}
+
+func populatePermitConditions(db *sql.DB, source string, target string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT id, permit_conditions FROM %s WHERE permit_conditions IS NOT NULL", source))
+	if err != nil {
+		return err
+	}
+
+	conditions := make(map[int64][]string)
+	var id int64
+	var permitConditions string
+	for rows.Next() {
+		if err := rows.Scan(&id, &permitConditions); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		conditions[id] = models.ParsePermitConditions(&permitConditions)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for id, codes := range conditions {
+		if err := insertPermitConditions(tx, target, id, codes); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Rollback: %v", rbErr)
+			}
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func migrate(db *sql.DB) error {
+	for _, m := range migrations {
+		// Tables added since are created with the column
+		exists, err := tablesExists(db, m.table)
+		if err != nil {
+			return errors.Wrapf(err, "error checking if table %s exists", m.table)
+		}
+		if !exists {
+			continue
+		}
+
+		exists, err = columnExists(db, m.table, m.column)
+		if err != nil {
+			return errors.Wrapf(err, "error checking if column %s.%s exists", m.table, m.column)
+		}
+		if exists {
+			continue
+		}
+
+		log.Printf("Migrating: adding column %s.%s", m.table, m.column)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return errors.Wrapf(err, "failed to add column %s.%s", m.table, m.column)
+		}
+	}
+	return nil
 }
 
 func tablesExists(db *sql.DB, table string) (bool, error) {
@@ -88,13 +194,59 @@ func tablesExists(db *sql.DB, table string) (bool, error) {
 	return exists, nil
 }
 
-func (repo *DbRepository) RefData() (*models.RefData, error) {
-	refData := make(models.RefData)
+func columnExists(db *sql.DB, table string, column string) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name=?)"
+	err := db.QueryRow(query, table, column).Scan(&exists)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return exists, nil
+}
+
+// refDataQuery counts the distinct values of every refdata facet in the registry.
+func refDataQuery() string {
+	selects := make([]string, 0, len(models.FacetRegistry))
+	for _, facet := range models.FacetRegistry {
+		if !facet.RefData {
+			continue
+		}
+
+		table := "events"
+		if facet.Table != "" {
+			table = "event_" + facet.Table
+		}
+		selects = append(selects, fmt.Sprintf(
+			"SELECT '%s' AS facet, %s AS value, COUNT(*) AS cnt FROM %s GROUP BY %s",
+			facet.Param, facet.Column, table, facet.Column))
+	}
+	return strings.Join(selects, "\nUNION ALL\n")
+}
 
+func (repo *DbRepository) RefData() (*models.RefData, error) {
 	rows, err := repo.refDataStmt.Query()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to execute refData query")
 	}
+	return scanRefData(rows)
+}
+
+// FacetCounts is like RefData, but scoped to the events matching a search.
+func (repo *DbRepository) FacetCounts(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters) (*models.RefData, error) {
+	if bbox == nil && strings.TrimSpace(text) == "" {
+		return nil, errors.New("bounding box or text query is required")
+	}
+
+	query, params := facetCountsQuery(bbox, text, facets, temporalFilters)
+	rows, err := repo.db.Query(query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute facet counts query")
+	}
+	return scanRefData(rows)
+}
+
+func scanRefData(rows *sql.Rows) (*models.RefData, error) {
+	refData := make(models.RefData)
 	defer func() {
 		if err := rows.Close(); err != nil {
 			log.Printf("Error closing rows: %v", err)
@@ -119,18 +271,226 @@ func (repo *DbRepository) RefData() (*models.RefData, error) {
 		}
 		refData[facet][v] = count
 	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over rows")
+	}
 	return &refData, nil
 }
 
-func (repo *DbRepository) Search(bbox *models.BBox, facets *models.Facets, temporalFilters *models.TemporalFilters) ([]*models.Event, error) {
-	if bbox == nil {
-		return nil, errors.New("bounding box is required")
+func (repo *DbRepository) Search(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters) ([]*models.Event, error) {
+	q, err := searchFor(bbox, text, facets, temporalFilters)
+	if err != nil {
+		return nil, err
+	}
+	return repo.query(q)
+}
+
+// SearchPage is as per Search, but returns up to limit (or, if zero, all) of
+// the events from offset, ordered by object reference so that paging is
+// consistent, along with the number matching in all.
+func (repo *DbRepository) SearchPage(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, int, error) {
+	q, err := searchFor(bbox, text, facets, temporalFilters)
+	if err != nil {
+		return nil, 0, err
+	}
+	return repo.page(q.ordered("e.object_reference"), limit, offset)
+}
+
+// SearchCount is as per Search, but only counts the matching events.
+func (repo *DbRepository) SearchCount(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters) (int, error) {
+	q, err := searchFor(bbox, text, facets, temporalFilters)
+	if err != nil {
+		return 0, err
+	}
+	return repo.count(q)
+}
+
+// SearchEach is as per Search, but calls fn with each event as it is read
+// rather than collecting them, so that large results can be streamed.
+func (repo *DbRepository) SearchEach(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters, fn func(event *models.Event) error) error {
+	q, err := searchFor(bbox, text, facets, temporalFilters)
+	if err != nil {
+		return err
+	}
+	return repo.each(q, fn)
+}
+
+// SearchEachByReference is as per SearchEach, but in order of object
+// reference, for when the results are paged after further filtering.
+func (repo *DbRepository) SearchEachByReference(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters, fn func(event *models.Event) error) error {
+	q, err := searchFor(bbox, text, facets, temporalFilters)
+	if err != nil {
+		return err
+	}
+	return repo.each(q.ordered("e.object_reference"), fn)
+}
+
+// ExportEach calls fn with the current state of every event within the
+// bounding box (if any), matching the facets, and active at some point
+// between from and to (if given), ordered by object type and reference.
+func (repo *DbRepository) ExportEach(bbox *models.BBox, facets *models.Facets, from *time.Time, to *time.Time, fn func(event *models.Event) error) error {
+	return repo.each(newSearchQuery(nil).
+		withinBoundingBox(bbox).
+		matchingFacets(facets).
+		activeBetween(from, to).
+		ordered("e.object_type, e.object_reference"), fn)
+}
+
+func searchFor(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters) (*searchQuery, error) {
+	if bbox == nil && strings.TrimSpace(text) == "" {
+		return nil, errors.New("bounding box or text query is required")
+	}
+
+	return newSearchQuery(temporalFilters).
+		withinBoundingBox(bbox).
+		withinTemporalWindow(temporalFilters).
+		matchingText(text).
+		matchingFacets(facets), nil
+}
+
+// FindByObjectReference returns the current state of a single permit, activity
+// or section 58, or nil if it is not known.
+func (repo *DbRepository) FindByObjectReference(objectReference string) (*models.Event, error) {
+	events, err := repo.query(newSearchQuery(nil).
+		where("e.object_reference = ?", objectReference))
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return events[0], nil
+}
+
+// FindByWorkReference returns all the permits raised against a work.
+func (repo *DbRepository) FindByWorkReference(workReferenceNumber string) ([]*models.Event, error) {
+	return repo.query(newSearchQuery(nil).
+		where("e.work_reference_number = ?", workReferenceNumber).
+		ordered("e.object_reference"))
+}
+
+// FindByWorkReferences returns all the permits raised against any of the
+// works, so that several can be looked up at once.
+func (repo *DbRepository) FindByWorkReferences(workReferenceNumbers []string) ([]*models.Event, error) {
+	return repo.findByWorkReferences(workReferenceNumbers, nil)
+}
+
+func (repo *DbRepository) findByWorkReferences(workReferenceNumbers []string, temporalFilters *models.TemporalFilters) ([]*models.Event, error) {
+	return repo.query(newSearchQuery(temporalFilters).
+		where("e.work_reference_number IN (SELECT value FROM json_each(?))", toJSONOrNil(workReferenceNumbers)).
+		ordered("e.work_reference_number, e.object_reference"))
+}
+
+// GroupByWork is as per models.GroupByWork, but each work has all of its
+// permits (as at the time of the temporal filters, if given) rather than only
+// those among the events, so that works only partly matching a search are
+// summarised in full.
+func (repo *DbRepository) GroupByWork(events []*models.Event, temporalFilters *models.TemporalFilters) ([]*models.Work, []*models.Event, error) {
+	works, ungrouped := models.GroupByWork(events)
+	if len(works) == 0 {
+		return works, ungrouped, nil
+	}
+
+	workReferenceNumbers := make([]string, len(works))
+	for idx, work := range works {
+		workReferenceNumbers[idx] = work.WorkReferenceNumber
+	}
+	permits, err := repo.findByWorkReferences(workReferenceNumbers, temporalFilters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	complete, _ := models.GroupByWork(permits)
+	byRef := make(map[string]*models.Work, len(complete))
+	for _, work := range complete {
+		byRef[work.WorkReferenceNumber] = work
+	}
+	for idx, work := range works {
+		if full, ok := byRef[work.WorkReferenceNumber]; ok {
+			works[idx] = full
+		}
+	}
+	return works, ungrouped, nil
+}
+
+// FindByUSRNs is as per FindByUSRN, for events on any of the streets, with up
+// to limit from offset for each street, and without the counts.
+func (repo *DbRepository) FindByUSRNs(usrns []string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, error) {
+	return repo.query(newSearchQuery(temporalFilters).
+		withinTemporalWindow(temporalFilters).
+		where("e.usrn IN (SELECT value FROM json_each(?))", toJSONOrNil(usrns)).
+		limitedPer("e.usrn", "e.event_time DESC, e.object_reference", limit, offset))
+}
+
+// FindByPromoters is as per FindByPromoter, for events raised by any of the
+// promoters, with up to limit from offset for each promoter, and without the
+// counts.
+func (repo *DbRepository) FindByPromoters(swaCodes []string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, error) {
+	return repo.query(newSearchQuery(temporalFilters).
+		withinTemporalWindow(temporalFilters).
+		where("e.promoter_swa_code IN (SELECT value FROM json_each(?))", toJSONOrNil(swaCodes)).
+		limitedPer("e.promoter_swa_code", "e.event_time DESC, e.object_reference", limit, offset))
+}
+
+// FindByUSRN returns up to limit of the events on a street from offset, most
+// recent first, along with the number in all.
+func (repo *DbRepository) FindByUSRN(usrn string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, int, error) {
+	return repo.page(newSearchQuery(temporalFilters).
+		withinTemporalWindow(temporalFilters).
+		where("e.usrn = ?", usrn).
+		ordered("e.event_time DESC, e.object_reference"), limit, offset)
+}
+
+// FindByPromoter returns up to limit of the events raised by a promoter from
+// offset, most recent first, along with the number in all.
+func (repo *DbRepository) FindByPromoter(swaCode string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, int, error) {
+	return repo.page(newSearchQuery(temporalFilters).
+		withinTemporalWindow(temporalFilters).
+		where("e.promoter_swa_code = ?", swaCode).
+		ordered("e.event_time DESC, e.object_reference"), limit, offset)
+}
+
+// ChangesSince returns up to limit of the changes recorded in the history after
+// the given history id, oldest first, within the bounding box (if any) and
+// matching the facets.
+func (repo *DbRepository) ChangesSince(lastID int64, bbox *models.BBox, facets *models.Facets, limit int) ([]*models.Change, error) {
+	return repo.changes(newHistoryQuery().
+		where("e.id > ?", lastID).
+		withinBoundingBox(bbox).
+		matchingFacets(facets).
+		ordered("e.id").
+		limited(limit))
+}
+
+// LatestChanges returns up to limit of the most recent changes in the history
+// by event time, newest first, within the bounding box and matching the facets.
+func (repo *DbRepository) LatestChanges(bbox *models.BBox, facets *models.Facets, limit int) ([]*models.Change, error) {
+	return repo.changes(newHistoryQuery().
+		withinBoundingBox(bbox).
+		matchingFacets(facets).
+		ordered("e.event_time DESC, e.id DESC").
+		limited(limit))
+}
+
+// ChangesBetween returns the changes with an event time in the range [from,
+// to), oldest first, within the bounding box (if any) and on any of the
+// streets (if any).
+func (repo *DbRepository) ChangesBetween(from time.Time, to time.Time, bbox *models.BBox, usrns []string) ([]*models.Change, error) {
+	q := newHistoryQuery().
+		where("e.event_time >= ? AND e.event_time < ?", from.UTC(), to.UTC()).
+		withinBoundingBox(bbox).
+		ordered("e.event_time, e.id")
+
+	if len(usrns) > 0 {
+		q.where("e.usrn IN (SELECT value FROM json_each(?))", toJSONOrNil(usrns))
 	}
+	return repo.changes(q)
+}
 
-	params := facetsToParams(bbox, facets, temporalFilters)
-	rows, err := repo.searchStmt.Query(params...)
+func (repo *DbRepository) changes(q *searchQuery) ([]*models.Change, error) {
+	selectClause := strings.TrimSpace(searchSQL) + ",\n    " + createdSQL("e.object_reference", "e.id")
+	query, params := q.withCTEs(q.buildSelect(selectClause, ""))
+	rows, err := repo.db.Query(query, params...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute search query")
+		return nil, errors.Wrap(err, "failed to execute changes query")
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -138,122 +498,177 @@ func (repo *DbRepository) Search(bbox *models.BBox, facets *models.Facets, tempo
 		}
 	}()
 
-	events := make([]*models.Event, 0, 50)
+	changes := make([]*models.Change, 0, 50)
 	for rows.Next() {
-		var event models.Event
-		if err := rows.Scan(
-			// Identifiers
-			&event.ID,
-			&event.EventType,
-			&event.ObjectReference,
-			&event.ActivityReferenceNumber,
-			&event.WorkReferenceNumber,
-			&event.Section58ReferenceNumber,
-			&event.PermitReferenceNumber,
-
-			// Core location and authority info
-			&event.USRN,
-			&event.StreetName,
-			&event.AreaName,
-			&event.Town,
-			&event.HighwayAuthority,
-			&event.HighwayAuthoritySWACode,
-			&event.PromoterSWACode,
-			&event.PromoterOrganisation,
-
-			// Coordinates & descriptions
-			&event.ActivityCoordinates,
-			&event.ActivityLocationType,
-			&event.ActivityLocationDescription,
-			&event.WorksLocationCoordinates,
-			&event.WorksLocationType,
-			&event.Section58Coordinates,
-			&event.Section58LocationType,
-
-			// Categories & types
-			&event.WorkCategory,
-			&event.WorkCategoryRef,
-			&event.WorkStatus,
-			&event.WorkStatusRef,
-			&event.TrafficManagementType,
-			&event.TrafficManagementTypeRef,
-			&event.CurrentTrafficManagementType,
-			&event.CurrentTrafficManagementTypeRef,
-			&event.RoadCategory,
-			&event.ActivityType,
-			&event.ActivityTypeDetails,
-			&event.Section58Status,
-			&event.Section58Duration,
-			&event.Section58Extent,
-
-			// Dates/times
-			&event.ProposedStartDate,
-			&event.ProposedEndDate,
-			&event.ProposedStartTime,
-			&event.ProposedEndTime,
-			&event.ActualStartDateTime,
-			&event.ActualEndDateTime,
-			&event.StartDate,
-			&event.StartTime,
-			&event.EndDate,
-			&event.EndTime,
-			&event.CurrentTrafficManagementUpdateDate,
-
-			// Flags
-			&event.IsTTRORequired,
-			&event.IsCovid19Response,
-			&event.IsTrafficSensitive,
-			&event.IsDeemed,
-			&event.CollaborativeWorking,
-			&event.Cancelled,
-			&event.TrafficManagementRequired,
-
-			// Misc
-			&event.PermitConditions,
-			&event.PermitStatus,
-			&event.CollaborationType,
-			&event.CollaborationTypeRef,
-			&event.CloseFootway,
-			&event.CloseFootwayRef,
-		); err != nil {
-			return nil, errors.Wrap(err, "failed to scan row")
+		var created bool
+		event, err := scanEvent(rows, &created)
+		if err != nil {
+			return nil, err
 		}
-		events = append(events, &event)
+		changes = append(changes, &models.Change{ID: event.ID, Kind: changeKind(created), Event: event})
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, errors.Wrap(err, "error iterating over rows")
 	}
 
+	return changes, nil
+}
+
+func (repo *DbRepository) count(q *searchQuery) (int, error) {
+	query, params := q.buildCount()
+	var count int
+	if err := repo.db.QueryRow(query, params...).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "failed to execute count query")
+	}
+	return count, nil
+}
+
+// page returns up to limit (or, if zero, all) of the events from offset, in
+// the order of the query, along with the number matching in all.
+func (repo *DbRepository) page(q *searchQuery, limit int, offset int) ([]*models.Event, int, error) {
+	total, err := repo.count(q)
+	if err != nil || offset >= total {
+		return []*models.Event{}, total, err
+	}
+
+	events, err := repo.query(q.limited(limit).skipping(offset))
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (repo *DbRepository) query(q *searchQuery) ([]*models.Event, error) {
+	events := make([]*models.Event, 0, 50)
+	err := repo.each(q, func(event *models.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return events, nil
 }
 
-func facetsToParams(bbox *models.BBox, facets *models.Facets, temporalFilters *models.TemporalFilters) []any {
-	params := []any{
-		// Correct parameter order: maxX, minX, maxY, minY (which seems counterintuitive)
-		bbox.MaxX, bbox.MinX, bbox.MaxY, bbox.MinY,
-		fmt.Sprintf("+%d days", temporalFilters.MaxDaysAhead),
-		fmt.Sprintf("-%d days", temporalFilters.MaxDaysBehind),
+// each calls fn with each event as it is read, stopping at the first error.
+func (repo *DbRepository) each(q *searchQuery, fn func(event *models.Event) error) error {
+	query, params := q.build()
+	rows, err := repo.db.Query(query, params...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute search query")
 	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
 
-	// Add string facet parameters (each facet needs 3 parameters for the OR condition)
-	facetGetters := []func(f *models.Facets) []string{
-		func(f *models.Facets) []string { return f.PermitStatus },
-		func(f *models.Facets) []string { return f.TrafficManagementTypeRef },
-		func(f *models.Facets) []string { return f.WorkStatusRef },
-		func(f *models.Facets) []string { return f.WorkCategoryRef },
-		func(f *models.Facets) []string { return f.RoadCategory },
-		func(f *models.Facets) []string { return f.HighwayAuthority },
-		func(f *models.Facets) []string { return f.PromoterOrganisation },
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
 	}
 
-	for _, getter := range facetGetters {
-		jsonVal := toJSONOrNil(getFacetSlice(facets, getter))
-		// Needs to be copied 3x times for the placeholders
-		params = append(params, jsonVal, jsonVal, jsonVal)
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "error iterating over rows")
 	}
 
-	return params
+	return nil
+}
+
+// scanEvent reads a row whose columns are laid out as per the search queries,
+// followed by any extra columns.
+func scanEvent(rows *sql.Rows, extra ...any) (*models.Event, error) {
+	var event models.Event
+	dest := []any{
+		// Identifiers
+		&event.ID,
+		&event.ObjectType,
+		&event.EventType,
+		&event.EventReference,
+		&event.EventTime,
+		&event.ObjectReference,
+		&event.ActivityReferenceNumber,
+		&event.WorkReferenceNumber,
+		&event.Section58ReferenceNumber,
+		&event.PermitReferenceNumber,
+
+		// Core location and authority info
+		&event.USRN,
+		&event.StreetName,
+		&event.AreaName,
+		&event.Town,
+		&event.HighwayAuthority,
+		&event.HighwayAuthoritySWACode,
+		&event.PromoterSWACode,
+		&event.PromoterOrganisation,
+
+		// Coordinates & descriptions
+		&event.ActivityCoordinates,
+		&event.ActivityLocationType,
+		&event.ActivityLocationDescription,
+		&event.WorksLocationCoordinates,
+		&event.WorksLocationType,
+		&event.Section58Coordinates,
+		&event.Section58LocationType,
+
+		// Categories & types
+		&event.WorkCategory,
+		&event.WorkCategoryRef,
+		&event.WorkStatus,
+		&event.WorkStatusRef,
+		&event.TrafficManagementType,
+		&event.TrafficManagementTypeRef,
+		&event.CurrentTrafficManagementType,
+		&event.CurrentTrafficManagementTypeRef,
+		&event.RoadCategory,
+		&event.ActivityType,
+		&event.ActivityTypeDetails,
+		&event.Section58Status,
+		&event.Section58Duration,
+		&event.Section58Extent,
+
+		// Dates/times
+		&event.ProposedStartDate,
+		&event.ProposedEndDate,
+		&event.ProposedStartTime,
+		&event.ProposedEndTime,
+		&event.ActualStartDateTime,
+		&event.ActualEndDateTime,
+		&event.StartDate,
+		&event.StartTime,
+		&event.EndDate,
+		&event.EndTime,
+		&event.CurrentTrafficManagementUpdateDate,
+
+		// Flags
+		&event.IsTTRORequired,
+		&event.IsCovid19Response,
+		&event.IsTrafficSensitive,
+		&event.IsDeemed,
+		&event.CollaborativeWorking,
+		&event.Cancelled,
+		&event.TrafficManagementRequired,
+
+		// Misc
+		&event.PermitConditions,
+		&event.PermitStatus,
+		&event.CollaborationType,
+		&event.CollaborationTypeRef,
+		&event.CloseFootway,
+		&event.CloseFootwayRef,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, errors.Wrap(err, "failed to scan row")
+	}
+
+	event.PermitConditionCodes = models.ParsePermitConditions(event.PermitConditions)
+	return &event, nil
 }
 
 // Helper function to convert string slice to JSON or nil
@@ -265,21 +680,7 @@ func toJSONOrNil(slice []string) any {
 	return string(jsonBytes)
 }
 
-// Helper functions to safely extract facet values
-func getFacetSlice(facets *models.Facets, getter func(*models.Facets) []string) []string {
-	if facets == nil {
-		return nil
-	}
-	return getter(facets)
-}
-
 func (repo *DbRepository) Close() error {
-	if repo.searchStmt != nil {
-		if err := repo.searchStmt.Close(); err != nil {
-			return errors.Wrap(err, "failed to close search db statement")
-		}
-	}
-
 	if repo.refDataStmt != nil {
 		if err := repo.refDataStmt.Close(); err != nil {
 			return errors.Wrap(err, "failed to close ref-data db statement")
@@ -298,81 +699,103 @@ func (repo *DbRepository) HealthCheck() checks.Check {
 	}
 }
 
-func (repo *DbRepository) BatchUpsert() (*Batch, error) {
-	cols := []string{
-		// Identifiers
-		"event_type",
-		"object_reference",
-		"activity_reference_number",
-		"work_reference_number",
-		"section_58_reference_number",
-		"permit_reference_number",
-
-		// Core location and authority info
-		"usrn",
-		"street_name",
-		"area_name",
-		"town",
-		"highway_authority",
-		"highway_authority_swa_code",
-		"promoter_swa_code",
-		"promoter_organisation",
-
-		// Coordinates & descriptions
-		"activity_coordinates",
-		"activity_location_type",
-		"activity_location_description",
-		"works_location_coordinates",
-		"works_location_type",
-		"section_58_coordinates",
-		"section_58_location_type",
-
-		// Categories & types
-		"work_category",
-		"work_category_ref",
-		"work_status",
-		"work_status_ref",
-		"traffic_management_type",
-		"traffic_management_type_ref",
-		"current_traffic_management_type",
-		"current_traffic_management_type_ref",
-		"road_category",
-		"activity_type",
-		"activity_type_details",
-		"section_58_status",
-		"section_58_duration",
-		"section_58_extent",
-
-		// Dates/times
-		"proposed_start_date",
-		"proposed_end_date",
-		"proposed_start_time",
-		"proposed_end_time",
-		"actual_start_date_time",
-		"actual_end_date_time",
-		"start_date",
-		"start_time",
-		"end_date",
-		"end_time",
-		"current_traffic_management_update_date",
+// eventColumns are the columns written on upsert; the unique key (object_reference)
+// must remain first, as it is excluded from the ON CONFLICT update set.
+var eventColumns = []string{
+	// Identifiers
+	"object_reference",
+	"object_type",
+	"event_type",
+	"event_reference",
+	"event_time",
+	"activity_reference_number",
+	"work_reference_number",
+	"section_58_reference_number",
+	"permit_reference_number",
+
+	// Core location and authority info
+	"usrn",
+	"street_name",
+	"area_name",
+	"town",
+	"highway_authority",
+	"highway_authority_swa_code",
+	"promoter_swa_code",
+	"promoter_organisation",
+
+	// Coordinates & descriptions
+	"activity_coordinates",
+	"activity_location_type",
+	"activity_location_description",
+	"works_location_coordinates",
+	"works_location_type",
+	"section_58_coordinates",
+	"section_58_location_type",
+
+	// Categories & types
+	"work_category",
+	"work_category_ref",
+	"work_status",
+	"work_status_ref",
+	"traffic_management_type",
+	"traffic_management_type_ref",
+	"current_traffic_management_type",
+	"current_traffic_management_type_ref",
+	"road_category",
+	"activity_type",
+	"activity_type_details",
+	"section_58_status",
+	"section_58_duration",
+	"section_58_extent",
+
+	// Dates/times
+	"proposed_start_date",
+	"proposed_end_date",
+	"proposed_start_time",
+	"proposed_end_time",
+	"actual_start_date_time",
+	"actual_end_date_time",
+	"start_date",
+	"start_time",
+	"end_date",
+	"end_time",
+	"current_traffic_management_update_date",
+
+	// Flags
+	"is_ttro_required",
+	"is_covid_19_response",
+	"is_traffic_sensitive",
+	"is_deemed",
+	"collaborative_working",
+	"cancelled",
+	"traffic_management_required",
+
+	// Misc
+	"permit_conditions",
+	"permit_status",
+	"collaboration_type",
+	"collaboration_type_ref",
+	"close_footway",
+	"close_footway_ref",
+}
 
-		// Flags
-		"is_ttro_required",
-		"is_covid_19_response",
-		"is_traffic_sensitive",
-		"is_deemed",
-		"collaborative_working",
-		"cancelled",
-		"traffic_management_required",
+// ftsColumns are the events columns copied into the full-text index.
+var ftsColumns = []string{
+	"street_name",
+	"area_name",
+	"town",
+	"activity_location_description",
+	"permit_conditions",
+	"object_reference",
+	"work_reference_number",
+	"permit_reference_number",
+	"activity_reference_number",
+	"section_58_reference_number",
+	"usrn",
+}
 
-		// Misc
-		"permit_conditions",
-		"permit_status",
-		"collaboration_type",
-		"collaboration_type_ref",
-		"close_footway",
-		"close_footway_ref",
-	}
+func (repo *DbRepository) BatchUpsert() (*Batch, error) {
+	cols := eventColumns
 
 	placeholders := make([]string, len(cols))
 	for i := range cols {
@@ -393,6 +816,14 @@ func (repo *DbRepository) BatchUpsert() (*Batch, error) {
 		RETURNING id;
 	`, strings.Join(cols, ", "), strings.Join(placeholders, ", "), strings.Join(updateSet, ", "))
 
+	// Replayed events (e.g. re-running the bulk loader) are only recorded once
+	historyQuery := fmt.Sprintf(`
+		INSERT INTO event_history (%s)
+		VALUES (%s)
+		ON CONFLICT(object_reference, event_reference) DO NOTHING
+		RETURNING id;
+	`, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+
 	tx, err := repo.db.Begin()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to begin transaction")
@@ -403,9 +834,15 @@ func (repo *DbRepository) BatchUpsert() (*Batch, error) {
 		return nil, errors.Wrap(err, "failed to prepare statement")
 	}
 
+	historyStmt, err := tx.Prepare(historyQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepare history statement")
+	}
+
 	return &Batch{
-		tx:   tx,
-		stmt: stmt,
+		tx:          tx,
+		stmt:        stmt,
+		historyStmt: historyStmt,
 	}, nil
 }
 
@@ -419,8 +856,11 @@ func (batch *Batch) Upsert(event *models.Event) (int64, error) {
 	// Extract values from struct
 	values := []any{
 		// Identifiers
-		event.EventType,
 		event.ObjectReference,
+		event.ObjectType,
+		event.EventType,
+		event.EventReference,
+		event.EventTime,
 		event.ActivityReferenceNumber,
 		event.WorkReferenceNumber,
 		event.Section58ReferenceNumber,
@@ -503,6 +943,26 @@ func (batch *Batch) Upsert(event *models.Event) (int64, error) {
 		return 0, errors.Wrap(err, "failed to insert into R-tree")
 	}
 
+	err = batch.upsertFTS(id, event)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to update full-text index")
+	}
+
+	_, err = batch.tx.Exec(`DELETE FROM event_permit_conditions WHERE id = ?`, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to clear permit conditions")
+	}
+
+	err = insertPermitConditions(batch.tx, "event_permit_conditions", id, event.PermitConditionCodes)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to insert permit conditions")
+	}
+
+	err = batch.appendHistory(event, values, *bbox)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to append to event history")
+	}
+
 	return id, nil
 }
 
@@ -534,6 +994,92 @@ func (batch *Batch) upsertRTree(id int64, bbox models.BBox) error {
 	return err
 }
 
+func (batch *Batch) upsertFTS(id int64, event *models.Event) error {
+	_, err := batch.tx.Exec(`DELETE FROM events_fts WHERE rowid = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	placeholders := strings.Repeat(", ?", len(ftsColumns))
+	_, err = batch.tx.Exec(
+		fmt.Sprintf(`INSERT INTO events_fts (rowid, %s) VALUES (?%s)`, strings.Join(ftsColumns, ", "), placeholders),
+		id,
+		event.StreetName,
+		event.AreaName,
+		event.Town,
+		event.ActivityLocationDescription,
+		event.PermitConditions,
+		event.ObjectReference,
+		event.WorkReferenceNumber,
+		event.PermitReferenceNumber,
+		event.ActivityReferenceNumber,
+		event.Section58ReferenceNumber,
+		event.USRN,
+	)
+	return err
+}
+
+func insertPermitConditions(tx *sql.Tx, table string, id int64, codes []string) error {
+	for _, code := range codes {
+		if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (id, code) VALUES (?, ?)`, table), id, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (batch *Batch) appendHistory(event *models.Event, values []any, bbox models.BBox) error {
+	var id int64
+	err := batch.historyStmt.QueryRow(values...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// already recorded
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = batch.tx.Exec(
+		`INSERT INTO event_history_rtree (id, minx, maxx, miny, maxy) VALUES (?, ?, ?, ?, ?)`,
+		id, bbox.MinX, bbox.MaxX, bbox.MinY, bbox.MaxY,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = insertPermitConditions(batch.tx, "event_history_permit_conditions", id, event.PermitConditionCodes)
+	if err != nil {
+		return err
+	}
+
+	var created bool
+	err = batch.tx.QueryRow("SELECT "+createdSQL("?", "?"), event.ObjectReference, id).Scan(&created)
+	if err != nil {
+		return err
+	}
+
+	batch.changes = append(batch.changes, &models.Change{ID: id, Kind: changeKind(created), Event: event})
+	return nil
+}
+
+// Changes lists the events newly recorded in the history by this batch, which
+// are only visible to others once it is done.
+func (batch *Batch) Changes() []*models.Change {
+	return batch.changes
+}
+
+// createdSQL is true if no history is recorded for an object before the given id
+func createdSQL(objectReference string, id string) string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM event_history p WHERE p.object_reference = %s AND p.id < %s)", objectReference, id)
+}
+
+func changeKind(created bool) string {
+	if created {
+		return models.ChangeCreated
+	}
+	return models.ChangeUpdated
+}
+
 func (repo *DbRepository) RegenerateIndex() (int, int, error) {
 
 	tx, err := repo.db.Begin()
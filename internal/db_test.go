@@ -0,0 +1,46 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newTestRepo(t *testing.T) *DbRepository {
+	t.Helper()
+
+	repo, err := NewDbRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	return repo
+}
+
+// upsert adds the events, numbering their event references if not given.
+func upsert(t *testing.T, repo *DbRepository, events ...*models.Event) {
+	t.Helper()
+
+	batch, err := repo.BatchUpsert()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for idx, event := range events {
+		if event.EventReference == nil {
+			event.EventReference = ptr(int64(idx + 1))
+		}
+		if _, err := batch.Upsert(event); err != nil {
+			t.Fatalf("unexpected error: %v", batch.Abort(err))
+		}
+	}
+	if err := batch.Done(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package digest
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// Store reads the event history.
+type Store interface {
+	ChangesBetween(from time.Time, to time.Time, bbox *models.BBox, usrns []string) ([]*models.Change, error)
+}
+
+// Digest summarises the works (and activities and section 58s) on a watch
+// which were first seen, or changed, in a period.
+type Digest struct {
+	Watch   *Watch
+	From    time.Time
+	To      time.Time
+	New     []*Entry
+	Changed []*Entry
+}
+
+// Entry is the latest state of a work, activity or section 58 in the period.
+type Entry struct {
+	Reference string
+	Type      string
+	Location  string
+	Promoter  string
+	Status    string
+	StartsAt  *time.Time
+	EndsAt    *time.Time
+	// Updates is the number of events received in the period
+	Updates int
+}
+
+func (digest *Digest) IsEmpty() bool {
+	return len(digest.New) == 0 && len(digest.Changed) == 0
+}
+
+// Build collects the changes on the watched streets and within the watched
+// areas with an event time in the range [from, to).
+func Build(store Store, watch *Watch, from time.Time, to time.Time) (*Digest, error) {
+	changes := make(map[int64]*models.Change)
+	if len(watch.USRNs) > 0 {
+		found, err := store.ChangesBetween(from, to, nil, watch.USRNs)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read changes on watched streets")
+		}
+		for _, change := range found {
+			changes[change.ID] = change
+		}
+	}
+
+	areas, err := watch.Areas()
+	if err != nil {
+		return nil, err
+	}
+	for _, area := range areas {
+		bbox := area.BoundingBox()
+		found, err := store.ChangesBetween(from, to, &bbox, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read changes in watched area")
+		}
+		for _, change := range found {
+			if area.IntersectsEvent(change.Event) {
+				changes[change.ID] = change
+			}
+		}
+	}
+
+	// The latest state of each object, and whether it was first seen in the period
+	ids := slices.Sorted(func(yield func(int64) bool) {
+		for id := range changes {
+			if !yield(id) {
+				return
+			}
+		}
+	})
+	latest := make(map[string]*models.Event)
+	order := make([]string, 0)
+	created := make(map[string]bool)
+	updates := make(map[string]int)
+	for _, id := range ids {
+		change := changes[id]
+		objectReference := change.Event.ObjectReference
+		if _, ok := latest[objectReference]; !ok {
+			order = append(order, objectReference)
+		}
+		latest[objectReference] = change.Event
+		updates[objectReference]++
+		if change.Kind == models.ChangeCreated {
+			created[objectReference] = true
+		}
+	}
+
+	events := make([]*models.Event, len(order))
+	for idx, objectReference := range order {
+		events[idx] = latest[objectReference]
+	}
+
+	digest := &Digest{Watch: watch, From: from, To: to, New: make([]*Entry, 0), Changed: make([]*Entry, 0)}
+	works, others := models.GroupByWork(events)
+	for _, work := range works {
+		entry := workEntry(work)
+		isNew := false
+		for _, permit := range work.Permits {
+			entry.Updates += updates[permit.ObjectReference]
+			isNew = isNew || created[permit.ObjectReference]
+		}
+		digest.add(entry, isNew)
+	}
+
+	for _, event := range others {
+		entry := eventEntry(event)
+		entry.Updates = updates[event.ObjectReference]
+		digest.add(entry, created[event.ObjectReference])
+	}
+
+	byLocation := func(a, b *Entry) int {
+		return cmp.Or(cmp.Compare(a.Location, b.Location), cmp.Compare(a.Reference, b.Reference))
+	}
+	slices.SortFunc(digest.New, byLocation)
+	slices.SortFunc(digest.Changed, byLocation)
+	return digest, nil
+}
+
+func (digest *Digest) add(entry *Entry, isNew bool) {
+	if isNew {
+		digest.New = append(digest.New, entry)
+	} else {
+		digest.Changed = append(digest.Changed, entry)
+	}
+}
+
+func workEntry(work *models.Work) *Entry {
+	permit := work.Permits[0]
+	return &Entry{
+		Reference: work.WorkReferenceNumber,
+		Type:      "Work",
+		Location:  location(permit),
+		Promoter:  deref(work.PromoterOrganisation),
+		Status:    strings.Join(nonEmpty(deref(work.WorkStatus), deref(work.PermitStatus)), ", "),
+		StartsAt:  work.ActiveFrom,
+		EndsAt:    work.ActiveTo,
+	}
+}
+
+func eventEntry(event *models.Event) *Entry {
+	entryType := "Activity"
+	if event.Section58ReferenceNumber != nil {
+		entryType = "Section 58"
+	}
+
+	return &Entry{
+		Reference: deref(firstNonNil(event.Section58ReferenceNumber, event.ActivityReferenceNumber, &event.ObjectReference)),
+		Type:      entryType,
+		Location:  location(event),
+		Promoter:  deref(event.PromoterOrganisation),
+		Status:    deref(firstNonNil(event.Section58Status, event.ActivityType)),
+		StartsAt:  event.StartsAt(),
+		EndsAt:    event.EndsAt(),
+	}
+}
+
+func location(event *models.Event) string {
+	return strings.Join(nonEmpty(deref(event.StreetName), deref(event.AreaName), deref(event.Town)), ", ")
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func firstNonNil(values ...*string) *string {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func nonEmpty(values ...string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+	// Europe/London, even where the system has no timezone database
+	_ "time/tzdata"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+type fakeStore struct {
+	changes []*models.Change
+}
+
+func (store *fakeStore) ChangesBetween(from time.Time, to time.Time, bbox *models.BBox, usrns []string) ([]*models.Change, error) {
+	found := make([]*models.Change, 0)
+	for _, change := range store.changes {
+		event := change.Event
+		if event.EventTime.Before(from) || !event.EventTime.Before(to) {
+			continue
+		}
+		if bbox != nil {
+			eventBBox, err := event.BoundingBox()
+			if err != nil || eventBBox == nil || !bbox.Intersects(*eventBBox) {
+				continue
+			}
+		}
+		if usrns != nil && (event.USRN == nil || !contains(usrns, *event.USRN)) {
+			continue
+		}
+		found = append(found, change)
+	}
+	return found, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func change(id int64, kind string, objectReference string, eventTime time.Time, event models.Event) *models.Change {
+	event.ObjectReference = objectReference
+	event.EventTime = &eventTime
+	return &models.Change{ID: id, Kind: kind, Event: &event}
+}
+
+var (
+	from = time.Date(2025, 6, 1, 6, 0, 0, 0, time.UTC)
+	to   = from.AddDate(0, 0, 1)
+)
+
+func fixture() *fakeStore {
+	return &fakeStore{changes: []*models.Change{
+		// Created in the period, then updated
+		change(1, models.ChangeCreated, "PERMIT-1", from.Add(time.Hour), models.Event{
+			USRN: ptr("1001"), StreetName: ptr("High Street"), WorkReferenceNumber: ptr("WORK-1"),
+			PromoterOrganisation: ptr("Water Co"), WorkStatus: ptr("Planned"),
+			WorksLocationCoordinates: ptr("POINT(500 500)"),
+		}),
+		change(2, models.ChangeUpdated, "PERMIT-1", from.Add(2*time.Hour), models.Event{
+			USRN: ptr("1001"), StreetName: ptr("High Street"), WorkReferenceNumber: ptr("WORK-1"),
+			PromoterOrganisation: ptr("Water Co"), WorkStatus: ptr("In progress"),
+			WorksLocationCoordinates: ptr("POINT(500 500)"),
+		}),
+		// Created before the period, and updated during it
+		change(3, models.ChangeUpdated, "ACTIVITY-1", from.Add(3*time.Hour), models.Event{
+			USRN: ptr("2002"), StreetName: ptr("Low Road"), ActivityReferenceNumber: ptr("ACT-1"),
+			ActivityType: ptr("Skip"), ActivityCoordinates: ptr("POINT(5000 5000)"),
+		}),
+		// Outside the period
+		change(4, models.ChangeCreated, "PERMIT-2", to, models.Event{
+			USRN: ptr("1001"), StreetName: ptr("High Street"), WorkReferenceNumber: ptr("WORK-2"),
+			WorksLocationCoordinates: ptr("POINT(500 500)"),
+		}),
+		// Not watched
+		change(5, models.ChangeCreated, "PERMIT-3", from.Add(time.Hour), models.Event{
+			USRN: ptr("3003"), StreetName: ptr("Far Lane"), WorkReferenceNumber: ptr("WORK-3"),
+			WorksLocationCoordinates: ptr("POINT(90000 90000)"),
+		}),
+	}}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name            string
+		watch           *Watch
+		expectedNew     []string
+		expectedChanged []string
+	}{
+		{
+			name:            "By USRN",
+			watch:           &Watch{Name: "High Street", USRNs: []string{"1001"}},
+			expectedNew:     []string{"WORK-1"},
+			expectedChanged: []string{},
+		},
+		{
+			name:            "By area",
+			watch:           &Watch{Name: "Centre", Polygons: []string{"POLYGON((4000 4000, 6000 4000, 6000 6000, 4000 6000, 4000 4000))"}},
+			expectedNew:     []string{},
+			expectedChanged: []string{"ACT-1"},
+		},
+		{
+			name:            "By USRN and overlapping bbox",
+			watch:           &Watch{Name: "Both", USRNs: []string{"1001"}, BBoxes: []string{"0,0,10000,10000"}},
+			expectedNew:     []string{"WORK-1"},
+			expectedChanged: []string{"ACT-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, err := Build(fixture(), tt.watch, from, to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := references(digest.New); strings.Join(got, ",") != strings.Join(tt.expectedNew, ",") {
+				t.Errorf("got new %v, want %v", got, tt.expectedNew)
+			}
+			if got := references(digest.Changed); strings.Join(got, ",") != strings.Join(tt.expectedChanged, ",") {
+				t.Errorf("got changed %v, want %v", got, tt.expectedChanged)
+			}
+		})
+	}
+}
+
+func TestBuildUsesLatestState(t *testing.T) {
+	digest, err := Build(fixture(), &Watch{Name: "High Street", USRNs: []string{"1001"}}, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry := digest.New[0]
+	if entry.Status != "In progress" || entry.Updates != 2 || entry.Promoter != "Water Co" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestRender(t *testing.T) {
+	digest, err := Build(fixture(), &Watch{Name: "Both <watch>", USRNs: []string{"1001"}, BBoxes: []string{"0,0,10000,10000"}}, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	text, html, err := Render(digest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{"NEW (1)", "Work WORK-1 - High Street", "Status: In progress", "Updated 2 times", "CHANGED (1)", "Activity ACT-1 - Low Road"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected text to contain %q, got:\n%s", expected, text)
+		}
+	}
+
+	for _, expected := range []string{"<h2>New (1)</h2>", "<td>Work WORK-1</td>", "Both &lt;watch&gt;"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected HTML to contain %q, got:\n%s", expected, html)
+		}
+	}
+}
+
+func references(entries []*Entry) []string {
+	refs := make([]string, len(entries))
+	for idx, entry := range entries {
+		refs[idx] = entry.Reference
+	}
+	return refs
+}
+
+func TestNextRun(t *testing.T) {
+	at := 7*time.Hour + 30*time.Minute
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{name: "Later today", now: time.Date(2025, 6, 1, 6, 0, 0, 0, time.UTC), expected: time.Date(2025, 6, 1, 7, 30, 0, 0, time.UTC)},
+		{name: "Tomorrow", now: time.Date(2025, 6, 1, 7, 30, 0, 0, time.UTC), expected: time.Date(2025, 6, 2, 7, 30, 0, 0, time.UTC)},
+		{name: "Next month", now: time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC), expected: time.Date(2025, 7, 1, 7, 30, 0, 0, time.UTC)},
+		{name: "Clocks going forward today", now: time.Date(2025, 3, 30, 0, 30, 0, 0, london), expected: time.Date(2025, 3, 30, 7, 30, 0, 0, london)},
+		{name: "Clocks going back tomorrow", now: time.Date(2025, 10, 25, 12, 0, 0, 0, london), expected: time.Date(2025, 10, 26, 7, 30, 0, 0, london)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextRun(tt.now, at)
+			if !got.Equal(tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+			if clock := got.Format("15:04"); clock != "07:30" {
+				t.Errorf("got %s on the clock, want 07:30", clock)
+			}
+		})
+	}
+}
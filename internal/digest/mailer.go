@@ -0,0 +1,177 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Message is an email with plain-text and HTML alternatives.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// SMTPMailer sends messages via an SMTP server, using STARTTLS when the
+// server supports it, and authenticating only when a username is given.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// SMTPMailerFromEnv configures a mailer from the SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME and SMTP_PASSWORD environment variables.
+func SMTPMailerFromEnv() (*SMTPMailer, error) {
+	mailer := &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+	if mailer.Host == "" {
+		return nil, errors.New("SMTP_HOST is not set")
+	}
+	if mailer.Port == "" {
+		mailer.Port = "587"
+	}
+	return mailer, nil
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(mailer.Host, mailer.Port)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", addr)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, mailer.Host)
+	if err != nil {
+		_ = conn.Close()
+		return errors.Wrap(err, "failed to start SMTP session")
+	}
+	defer func() { _ = client.Close() }()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: mailer.Host}); err != nil {
+			return errors.Wrap(err, "failed to start TLS")
+		}
+	}
+
+	if mailer.Username != "" {
+		auth := smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+		if err := client.Auth(auth); err != nil {
+			return errors.Wrap(err, "failed to authenticate")
+		}
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return errors.Wrap(err, "sender rejected")
+	}
+	for _, recipient := range msg.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return errors.Wrapf(err, "recipient %s rejected", recipient)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "failed to start message")
+	}
+	if _, err := w.Write(body); err != nil {
+		return errors.Wrap(err, "failed to write message")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "message rejected")
+	}
+
+	return client.Quit()
+}
+
+// WriterMailer writes messages to a writer rather than sending them, e.g. for
+// a dry-run.
+type WriterMailer struct {
+	W io.Writer
+}
+
+func (mailer *WriterMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(mailer.W, "%s\r\n", body)
+	return err
+}
+
+// encode formats a message as a MIME multipart/alternative email.
+func encode(msg *Message) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n", boundary)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&buf)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, errors.Wrap(err, "failed to encode message")
+		}
+		if err := qp.Close(); err != nil {
+			return nil, errors.Wrap(err, "failed to encode message")
+		}
+	}
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate MIME boundary")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,164 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is a minimal SMTP server which records the envelope and message
+// of each mail it receives.
+type smtpSink struct {
+	listener net.Listener
+	received chan *sunkMail
+}
+
+type sunkMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	sink := &smtpSink{listener: listener, received: make(chan *sunkMail, 1)}
+	go sink.serve()
+	return sink
+}
+
+func (sink *smtpSink) serve() {
+	for {
+		conn, err := sink.listener.Accept()
+		if err != nil {
+			return
+		}
+		go sink.handle(conn)
+	}
+}
+
+func (sink *smtpSink) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP sink")
+
+	mail := &sunkMail{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			mail.from = strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			mail.data = data.String()
+			sink.received <- mail
+			mail = &sunkMail{}
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	sink := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(sink.listener.Addr().String())
+	mailer := &SMTPMailer{Host: host, Port: port}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := mailer.Send(ctx, &Message{
+		From:    "relay@example.com",
+		To:      []string{"ops@example.com", "oncall@example.com"},
+		Subject: "High Street: 1 new and 0 changed street works",
+		Text:    "NEW (1)\n\n* Work WORK-1 - High Street\n",
+		HTML:    "<h2>New (1)</h2>",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received *sunkMail
+	select {
+	case received = <-sink.received:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for mail")
+	}
+
+	if received.from != "relay@example.com" {
+		t.Errorf("got sender %s, want relay@example.com", received.from)
+	}
+	if got := strings.Join(received.to, ","); got != "ops@example.com,oncall@example.com" {
+		t.Errorf("got recipients %s", got)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(received.data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if got := msg.Header.Get("Subject"); got != "High Street: 1 new and 0 changed street works" {
+		t.Errorf("got subject %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %s (%v), want multipart/alternative", mediaType, err)
+	}
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	expected := map[string]string{
+		"text/plain": "NEW (1)\n\n* Work WORK-1 - High Street\n",
+		"text/html":  "<h2>New (1)</h2>",
+	}
+	for range expected {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(part)
+		if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != expected[contentType] {
+			t.Errorf("got %s part %q, want %q", contentType, got, expected[contentType])
+		}
+	}
+}
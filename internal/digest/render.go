@@ -0,0 +1,52 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var funcs = map[string]any{
+	"attribution": func() []string { return internal.ATTRIBUTION },
+	"formatDate":  func(t time.Time) string { return t.UTC().Format("Mon 2 Jan 2006 15:04 MST") },
+	"formatTime": func(t *time.Time) string {
+		if t == nil {
+			return "unknown"
+		}
+		return t.UTC().Format("2 Jan 2006 15:04")
+	},
+}
+
+var (
+	textTemplate = template.Must(template.New("digest.txt.tmpl").Funcs(funcs).ParseFS(templates, "templates/digest.txt.tmpl"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(funcs).ParseFS(templates, "templates/digest.html.tmpl"))
+)
+
+// Render formats a digest as plain-text and HTML.
+func Render(digest *Digest) (string, string, error) {
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, digest); err != nil {
+		return "", "", errors.Wrap(err, "failed to render text digest")
+	}
+
+	var html bytes.Buffer
+	if err := htmlTemplate.Execute(&html, digest); err != nil {
+		return "", "", errors.Wrap(err, "failed to render HTML digest")
+	}
+
+	return text.String(), html.String(), nil
+}
+
+// Subject is the subject line of the email for a digest.
+func Subject(digest *Digest) string {
+	return fmt.Sprintf("%s: %d new and %d changed street works", digest.Watch.Name, len(digest.New), len(digest.Changed))
+}
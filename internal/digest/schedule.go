@@ -0,0 +1,94 @@
+package digest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Digester builds and sends the digests for a watch-list.
+type Digester struct {
+	Store   Store
+	Mailer  Mailer
+	From    string
+	Watches []*Watch
+}
+
+// Send builds the digest for each watch over the period [from, to), and mails
+// those with any new or changed works. Failures for one watch do not prevent
+// the others being sent.
+func (digester *Digester) Send(ctx context.Context, from time.Time, to time.Time) error {
+	var errs error
+	for _, watch := range digester.Watches {
+		if err := digester.send(ctx, watch, from, to); err != nil {
+			errs = errors.CombineErrors(errs, errors.Wrapf(err, "digest %s", watch.Name))
+		}
+	}
+	return errs
+}
+
+func (digester *Digester) send(ctx context.Context, watch *Watch, from time.Time, to time.Time) error {
+	digest, err := Build(digester.Store, watch, from, to)
+	if err != nil {
+		return err
+	}
+
+	if digest.IsEmpty() {
+		log.Printf("Digest %s: nothing new or changed, not sending", watch.Name)
+		return nil
+	}
+
+	text, html, err := Render(digest)
+	if err != nil {
+		return err
+	}
+
+	err = digester.Mailer.Send(ctx, &Message{
+		From:    digester.From,
+		To:      watch.Recipients,
+		Subject: Subject(digest),
+		Text:    text,
+		HTML:    html,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to send")
+	}
+
+	log.Printf("Digest %s: sent %d new and %d changed to %d recipients", watch.Name, len(digest.New), len(digest.Changed), len(watch.Recipients))
+	return nil
+}
+
+// RunDaily sends the digests every day at the given time of day (in the
+// local timezone), each covering the preceding 24 hours, until the context
+// is cancelled.
+func (digester *Digester) RunDaily(ctx context.Context, at time.Duration) {
+	for {
+		next := NextRun(time.Now(), at)
+		log.Printf("Next digest at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := digester.Send(ctx, next.AddDate(0, 0, -1), next); err != nil {
+			log.Printf("Error sending digests: %v", err)
+		}
+	}
+}
+
+// NextRun is the first time strictly after now at the given time of day, as
+// shown on the clock, so it is unaffected by daylight saving changes.
+func NextRun(now time.Time, at time.Duration) time.Time {
+	hour, minute := int(at/time.Hour), int(at%time.Hour/time.Minute)
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
@@ -0,0 +1,76 @@
+package digest
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// Watch is an entry in the watch-list: the streets and areas whose new and
+// changed works are sent in a digest to the recipients.
+type Watch struct {
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+	USRNs      []string `json:"usrns,omitempty"`
+	// BBoxes are comma-separated, as per the search bbox parameter
+	BBoxes []string `json:"bboxes,omitempty"`
+	// Polygons are WKT, in British National Grid coordinates (EPSG:27700)
+	Polygons []string `json:"polygons,omitempty"`
+}
+
+// LoadWatchList reads a JSON array of watches.
+func LoadWatchList(path string) ([]*Watch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read watch-list")
+	}
+
+	var watches []*Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return nil, errors.Wrap(err, "failed to parse watch-list")
+	}
+
+	for idx, watch := range watches {
+		if err := watch.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid watch-list entry %d", idx)
+		}
+	}
+	return watches, nil
+}
+
+func (watch *Watch) validate() error {
+	if watch.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(watch.Recipients) == 0 {
+		return errors.New("at least one recipient is required")
+	}
+	if len(watch.USRNs)+len(watch.BBoxes)+len(watch.Polygons) == 0 {
+		return errors.New("at least one of usrns, bboxes or polygons is required")
+	}
+	_, err := watch.Areas()
+	return err
+}
+
+// Areas parses the bounding boxes and polygons being watched.
+func (watch *Watch) Areas() ([]*models.Area, error) {
+	areas := make([]*models.Area, 0, len(watch.BBoxes)+len(watch.Polygons))
+	for _, value := range watch.BBoxes {
+		bbox, err := models.BoundingBoxFromCSV(value)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, models.AreaFromBBox(*bbox))
+	}
+
+	for _, value := range watch.Polygons {
+		area, err := models.AreaFromWKT(value)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, area)
+	}
+	return areas, nil
+}
@@ -0,0 +1,102 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestFacetCountsExcludeTheirOwnSelection(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	event := func(ref string, status string, promoter string, conditions ...string) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, EventType: "PERMIT_GRANTED", WorkStatusRef: ptr(status), PromoterOrganisation: ptr(promoter),
+			PermitConditionCodes:     conditions,
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		}
+	}
+	upsert(t, repo,
+		event("E1", "in_progress", "Water Co", "NCT01a"),
+		event("E2", "planned", "Water Co"),
+		event("E3", "in_progress", "Gas Co", "NCT01a", "NCT02"),
+		event("E4", "completed", "Gas Co"),
+	)
+
+	bbox := &models.BBox{MinX: 530000, MinY: 180000, MaxX: 531000, MaxY: 181000}
+	tests := []struct {
+		name     string
+		selected map[string][]string
+		expected map[string]map[string]int
+	}{
+		{
+			name:     "None",
+			selected: map[string][]string{},
+			expected: map[string]map[string]int{
+				"work_status_ref":       {"in_progress": 2, "planned": 1, "completed": 1},
+				"promoter_organisation": {"Water Co": 2, "Gas Co": 2},
+				"permit_condition":      {"NCT01a": 2, "NCT02": 1},
+			},
+		},
+		{
+			name:     "Included value",
+			selected: map[string][]string{"work_status_ref": {"in_progress"}},
+			expected: map[string]map[string]int{
+				"work_status_ref":       {"in_progress": 2, "planned": 1, "completed": 1},
+				"promoter_organisation": {"Water Co": 1, "Gas Co": 1},
+				"permit_condition":      {"NCT01a": 2, "NCT02": 1},
+			},
+		},
+		{
+			name:     "Excluded value with another facet",
+			selected: map[string][]string{"work_status_ref": {"!planned"}, "promoter_organisation": {"Water Co"}},
+			expected: map[string]map[string]int{
+				"work_status_ref":       {"in_progress": 1, "planned": 1},
+				"promoter_organisation": {"Water Co": 1, "Gas Co": 2},
+				"permit_condition":      {"NCT01a": 1},
+			},
+		},
+		{
+			name:     "Wildcard",
+			selected: map[string][]string{"promoter_organisation": {"Gas*"}},
+			expected: map[string]map[string]int{
+				"work_status_ref":       {"in_progress": 1, "completed": 1},
+				"promoter_organisation": {"Water Co": 2, "Gas Co": 2},
+				"permit_condition":      {"NCT01a": 1, "NCT02": 1},
+			},
+		},
+		{
+			name:     "Multi-valued facet",
+			selected: map[string][]string{"permit_condition": {"NCT02"}},
+			expected: map[string]map[string]int{
+				"work_status_ref":       {"in_progress": 1},
+				"promoter_organisation": {"Gas Co": 1},
+				"permit_condition":      {"NCT01a": 2, "NCT02": 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facets, err := models.FacetsFromMap(tt.selected)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			counts, err := repo.FacetCounts(bbox, "", &facets, &models.TemporalFilters{MaxDaysAhead: 7})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for facet, expected := range tt.expected {
+				if actual := (*counts)[facet]; !maps.Equal(actual, expected) {
+					t.Errorf("got %s counts %v, want %v", facet, actual, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Package gpkg writes OGC GeoPackage (1.3) files of feature layers.
+package gpkg
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkb"
+)
+
+const (
+	applicationID = 0x47504B47 // "GPKG"
+	userVersion   = 10300      // 1.3.0
+
+	// SRSBritishNationalGrid is EPSG:27700
+	SRSBritishNationalGrid = 27700
+	// SRSWGS84 is EPSG:4326
+	SRSWGS84 = 4326
+)
+
+// The spatial reference systems required by the specification, and British
+// National Grid.
+var spatialRefSystems = []struct {
+	name         string
+	id           int
+	organization string
+	definition   string
+	description  string
+}{
+	{"Undefined cartesian SRS", -1, "NONE", "undefined", "undefined cartesian coordinate reference system"},
+	{"Undefined geographic SRS", 0, "NONE", "undefined", "undefined geographic coordinate reference system"},
+	{"WGS 84 geodetic", SRSWGS84, "EPSG", `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AXIS["Latitude",NORTH],AXIS["Longitude",EAST],AUTHORITY["EPSG","4326"]]`, "longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid"},
+	{"OSGB 1936 / British National Grid", SRSBritishNationalGrid, "EPSG", `PROJCS["OSGB 1936 / British National Grid",GEOGCS["OSGB 1936",DATUM["OSGB_1936",SPHEROID["Airy 1830",6377563.396,299.3249646,AUTHORITY["EPSG","7001"]],TOWGS84[446.448,-125.157,542.06,0.15,0.247,0.842,-20.489],AUTHORITY["EPSG","6277"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4277"]],PROJECTION["Transverse_Mercator"],PARAMETER["latitude_of_origin",49],PARAMETER["central_meridian",-2],PARAMETER["scale_factor",0.9996012717],PARAMETER["false_easting",400000],PARAMETER["false_northing",-100000],UNIT["metre",1,AUTHORITY["EPSG","9001"]],AXIS["Easting",EAST],AXIS["Northing",NORTH],AUTHORITY["EPSG","27700"]]`, "British National Grid eastings and northings in metres"},
+}
+
+const createSQL = `
+CREATE TABLE gpkg_spatial_ref_sys (
+    srs_name TEXT NOT NULL,
+    srs_id INTEGER PRIMARY KEY,
+    organization TEXT NOT NULL,
+    organization_coordsys_id INTEGER NOT NULL,
+    definition TEXT NOT NULL,
+    description TEXT
+);
+
+CREATE TABLE gpkg_contents (
+    table_name TEXT NOT NULL PRIMARY KEY,
+    data_type TEXT NOT NULL,
+    identifier TEXT UNIQUE,
+    description TEXT DEFAULT '',
+    last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+    min_x DOUBLE,
+    min_y DOUBLE,
+    max_x DOUBLE,
+    max_y DOUBLE,
+    srs_id INTEGER,
+    CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id)
+);
+
+CREATE TABLE gpkg_geometry_columns (
+    table_name TEXT NOT NULL,
+    column_name TEXT NOT NULL,
+    geometry_type_name TEXT NOT NULL,
+    srs_id INTEGER NOT NULL,
+    z TINYINT NOT NULL,
+    m TINYINT NOT NULL,
+    CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name),
+    CONSTRAINT fk_gc_tn FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name),
+    CONSTRAINT fk_gc_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id)
+);
+`
+
+// Column is an attribute column of a layer.
+type Column struct {
+	Name string
+	// Type is a GeoPackage data type, e.g. TEXT, INTEGER or DATETIME
+	Type string
+}
+
+// GeoPackage is a GeoPackage being written, within a single transaction.
+type GeoPackage struct {
+	db     *sql.DB
+	tx     *sql.Tx
+	layers []*Layer
+}
+
+// Layer is a feature table with a single geometry column, "geom".
+type Layer struct {
+	name   string
+	srsID  int32
+	insert *sql.Stmt
+	count  int
+	// The extent of the geometries inserted, if any
+	extent *[4]float64
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Create creates a new GeoPackage at path, which must not already exist.
+func Create(path string) (*GeoPackage, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, errors.Newf("%s already exists", path)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GeoPackage")
+	}
+
+	db.SetMaxOpenConns(1)
+
+	gpkg := &GeoPackage{db: db}
+	if err := gpkg.init(); err != nil {
+		_ = db.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return gpkg, nil
+}
+
+func (gpkg *GeoPackage) init() error {
+	pragmas := fmt.Sprintf("PRAGMA application_id = %d; PRAGMA user_version = %d;", applicationID, userVersion)
+	if _, err := gpkg.db.Exec(pragmas); err != nil {
+		return errors.Wrap(err, "failed to set GeoPackage pragmas")
+	}
+
+	tx, err := gpkg.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	gpkg.tx = tx
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return errors.Wrap(err, "failed to create GeoPackage tables")
+	}
+
+	for _, srs := range spatialRefSystems {
+		_, err := tx.Exec(`INSERT INTO gpkg_spatial_ref_sys (srs_name, srs_id, organization, organization_coordsys_id, definition, description)
+			VALUES (?, ?, ?, ?, ?, ?)`, srs.name, srs.id, srs.organization, srs.id, srs.definition, srs.description)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add spatial reference system %d", srs.id)
+		}
+	}
+	return nil
+}
+
+// CreateLayer adds a feature table. Geometries may be of any type, and may
+// have Z values.
+func (gpkg *GeoPackage) CreateLayer(name string, description string, srsID int, columns []Column) (*Layer, error) {
+	if !identifierPattern.MatchString(name) {
+		return nil, errors.Newf("invalid layer name '%s'", name)
+	}
+
+	definitions := []string{"fid INTEGER PRIMARY KEY AUTOINCREMENT", "geom GEOMETRY"}
+	names := []string{"geom"}
+	for _, column := range columns {
+		if !identifierPattern.MatchString(column.Name) || column.Name == "fid" || column.Name == "geom" {
+			return nil, errors.Newf("invalid column name '%s'", column.Name)
+		}
+		definitions = append(definitions, fmt.Sprintf(`"%s" %s`, column.Name, column.Type))
+		names = append(names, `"`+column.Name+`"`)
+	}
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{fmt.Sprintf(`CREATE TABLE "%s" (%s)`, name, strings.Join(definitions, ", ")), nil},
+		{`INSERT INTO gpkg_contents (table_name, data_type, identifier, description, srs_id) VALUES (?, 'features', ?, ?, ?)`,
+			[]any{name, name, description, srsID}},
+		{`INSERT INTO gpkg_geometry_columns (table_name, column_name, geometry_type_name, srs_id, z, m) VALUES (?, 'geom', 'GEOMETRY', ?, 2, 0)`,
+			[]any{name, srsID}},
+	}
+	for _, stmt := range statements {
+		if _, err := gpkg.tx.Exec(stmt.query, stmt.args...); err != nil {
+			return nil, errors.Wrapf(err, "failed to create layer %s", name)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	insert, err := gpkg.tx.Prepare(fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`, name, strings.Join(names, ", "), placeholders))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to prepare insert into %s", name)
+	}
+
+	layer := &Layer{name: name, srsID: int32(srsID), insert: insert}
+	gpkg.layers = append(gpkg.layers, layer)
+	return layer, nil
+}
+
+// Insert adds a feature, with its values in the order of the layer's columns.
+// A nil geometry is stored as NULL.
+func (layer *Layer) Insert(g geom.T, values ...any) error {
+	var blob []byte
+	if g != nil {
+		var err error
+		if blob, err = Encode(g, layer.srsID); err != nil {
+			return err
+		}
+
+		if !g.Empty() {
+			bounds := g.Bounds()
+			if layer.extent == nil {
+				layer.extent = &[4]float64{bounds.Min(0), bounds.Min(1), bounds.Max(0), bounds.Max(1)}
+			} else {
+				layer.extent[0] = min(layer.extent[0], bounds.Min(0))
+				layer.extent[1] = min(layer.extent[1], bounds.Min(1))
+				layer.extent[2] = max(layer.extent[2], bounds.Max(0))
+				layer.extent[3] = max(layer.extent[3], bounds.Max(1))
+			}
+		}
+	}
+
+	if _, err := layer.insert.Exec(append([]any{blob}, values...)...); err != nil {
+		return errors.Wrapf(err, "failed to insert into %s", layer.name)
+	}
+	layer.count++
+	return nil
+}
+
+// Count is the number of features inserted.
+func (layer *Layer) Count() int {
+	return layer.count
+}
+
+// Close records the extent of each layer, and commits the GeoPackage.
+func (gpkg *GeoPackage) Close() error {
+	defer func() { _ = gpkg.db.Close() }()
+
+	for _, layer := range gpkg.layers {
+		if err := layer.insert.Close(); err != nil {
+			return errors.Wrapf(err, "failed to complete layer %s", layer.name)
+		}
+		if layer.extent == nil {
+			continue
+		}
+
+		_, err := gpkg.tx.Exec(`UPDATE gpkg_contents SET min_x = ?, min_y = ?, max_x = ?, max_y = ? WHERE table_name = ?`,
+			layer.extent[0], layer.extent[1], layer.extent[2], layer.extent[3], layer.name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to record extent of %s", layer.name)
+		}
+	}
+
+	return errors.Wrap(gpkg.tx.Commit(), "failed to commit GeoPackage")
+}
+
+// Abort discards the GeoPackage; the caller should remove the file.
+func (gpkg *GeoPackage) Abort() error {
+	defer func() { _ = gpkg.db.Close() }()
+	return gpkg.tx.Rollback()
+}
+
+// Encode formats a geometry as a GeoPackage binary: a header with the SRS and
+// the XY envelope, followed by the geometry as little-endian ISO WKB.
+func Encode(g geom.T, srsID int32) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("GP")
+	buf.WriteByte(0) // version 1
+
+	empty := g.Empty()
+	// Little-endian, with an XY envelope unless empty
+	flags := byte(0x01)
+	if empty {
+		flags |= 0x10
+	} else {
+		flags |= 0x02
+	}
+	buf.WriteByte(flags)
+	_ = binary.Write(&buf, binary.LittleEndian, srsID)
+
+	if !empty {
+		bounds := g.Bounds()
+		for _, value := range []float64{bounds.Min(0), bounds.Max(0), bounds.Min(1), bounds.Max(1)} {
+			_ = binary.Write(&buf, binary.LittleEndian, math.Float64bits(value))
+		}
+	}
+
+	data, err := wkb.Marshal(g, binary.LittleEndian)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode geometry")
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,146 @@
+package gpkg
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkb"
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+func TestEncode(t *testing.T) {
+	g, err := wkt.Unmarshal("LINESTRING Z (1 2 0, 3 -4 5)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blob, err := Encode(g, SRSBritishNationalGrid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(blob[:4], []byte{'G', 'P', 0, 0x03}) {
+		t.Errorf("unexpected header %x", blob[:4])
+	}
+	if srsID := int32(binary.LittleEndian.Uint32(blob[4:8])); srsID != SRSBritishNationalGrid {
+		t.Errorf("got srs_id %d, want %d", srsID, SRSBritishNationalGrid)
+	}
+
+	envelope := make([]float64, 4)
+	for i := range envelope {
+		envelope[i] = math.Float64frombits(binary.LittleEndian.Uint64(blob[8+8*i:]))
+	}
+	if expected := []float64{1, 3, -4, 2}; !equal(envelope, expected) {
+		t.Errorf("got envelope %v, want %v", envelope, expected)
+	}
+
+	decoded, err := wkb.Unmarshal(blob[40:])
+	if err != nil {
+		t.Fatalf("invalid WKB: %v", err)
+	}
+	if decoded.Layout() != geom.XYZ || !equal(decoded.FlatCoords(), g.FlatCoords()) {
+		t.Errorf("got %v, want %v", decoded.FlatCoords(), g.FlatCoords())
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	blob, err := Encode(geom.NewLineString(geom.XY), SRSBritishNationalGrid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Empty, without an envelope
+	if blob[3] != 0x11 {
+		t.Errorf("got flags %x, want 11", blob[3])
+	}
+}
+
+func TestCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	gpkg, err := Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	layer, err := gpkg.CreateLayer("permit", "Permits", SRSBritishNationalGrid, []Column{{Name: "object_reference", Type: "TEXT"}, {Name: "event_reference", Type: "INTEGER"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := gpkg.CreateLayer("bad name", "", SRSBritishNationalGrid, nil); err == nil {
+		t.Errorf("expected an error for an invalid layer name")
+	}
+
+	for _, row := range []struct {
+		wkt string
+		ref string
+	}{
+		{"POINT(530000 180000)", "P1"},
+		{"LINESTRING(529000 181000, 531000 179500)", "P2"},
+	} {
+		g, _ := wkt.Unmarshal(row.wkt)
+		if err := layer.Insert(g, row.ref, 42); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := layer.Insert(nil, "P3", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := gpkg.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := Create(path); err == nil {
+		t.Errorf("expected an error creating over an existing file")
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var applicationID, userVersion int
+	_ = db.QueryRow("PRAGMA application_id").Scan(&applicationID)
+	_ = db.QueryRow("PRAGMA user_version").Scan(&userVersion)
+	if applicationID != 0x47504B47 || userVersion != 10300 {
+		t.Errorf("got application_id %x and user_version %d", applicationID, userVersion)
+	}
+
+	var minX, minY, maxX, maxY float64
+	var srsID int
+	err = db.QueryRow("SELECT min_x, min_y, max_x, max_y, srs_id FROM gpkg_contents WHERE table_name = 'permit' AND data_type = 'features'").
+		Scan(&minX, &minY, &maxX, &maxY, &srsID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !equal([]float64{minX, minY, maxX, maxY}, []float64{529000, 179500, 531000, 181000}) || srsID != SRSBritishNationalGrid {
+		t.Errorf("got extent %v %v %v %v in %d", minX, minY, maxX, maxY, srsID)
+	}
+
+	var geometryType string
+	if err := db.QueryRow("SELECT geometry_type_name FROM gpkg_geometry_columns WHERE table_name = 'permit' AND column_name = 'geom'").Scan(&geometryType); err != nil || geometryType != "GEOMETRY" {
+		t.Errorf("got geometry type %s (%v)", geometryType, err)
+	}
+
+	var count, nullGeoms int
+	_ = db.QueryRow("SELECT COUNT(*), SUM(geom IS NULL) FROM permit WHERE event_reference = 42 OR event_reference IS NULL").Scan(&count, &nullGeoms)
+	if count != 3 || nullGeoms != 1 {
+		t.Errorf("got %d features with %d null geometries, want 3 with 1", count, nullGeoms)
+	}
+}
+
+func equal(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
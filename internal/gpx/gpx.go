@@ -0,0 +1,98 @@
+// Package gpx streams GPX 1.1 documents of waypoints and tracks.
+package gpx
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const Namespace = "http://www.topografix.com/GPX/1/1"
+
+// Waypoint is a point of interest, in WGS84 degrees.
+type Waypoint struct {
+	XMLName     xml.Name `xml:"wpt"`
+	Lat         float64  `xml:"lat,attr"`
+	Lon         float64  `xml:"lon,attr"`
+	Name        string   `xml:"name,omitempty"`
+	Description string   `xml:"desc,omitempty"`
+	Link        *Link    `xml:"link,omitempty"`
+	Type        string   `xml:"type,omitempty"`
+}
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+}
+
+// Track is a line or outline, as one or more segments of points.
+type Track struct {
+	XMLName     xml.Name  `xml:"trk"`
+	Name        string    `xml:"name,omitempty"`
+	Description string    `xml:"desc,omitempty"`
+	Link        *Link     `xml:"link,omitempty"`
+	Type        string    `xml:"type,omitempty"`
+	Segments    []Segment `xml:"trkseg"`
+}
+
+type Segment struct {
+	Points []TrackPoint `xml:"trkpt"`
+}
+
+type TrackPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+// Writer writes a document. The GPX schema requires every waypoint to come
+// before any track.
+type Writer struct {
+	enc      *xml.Encoder
+	inTracks bool
+}
+
+func NewWriter(w io.Writer, name string, creator string) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, errors.Wrap(err, "failed to write GPX")
+	}
+
+	enc := xml.NewEncoder(w)
+	err := enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "gpx"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "version"}, Value: "1.1"},
+		{Name: xml.Name{Local: "creator"}, Value: creator},
+		{Name: xml.Name{Local: "xmlns"}, Value: Namespace},
+	}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write GPX")
+	}
+
+	metadata := struct {
+		Name string `xml:"name"`
+		Time string `xml:"time"`
+	}{Name: name, Time: time.Now().UTC().Format(time.RFC3339)}
+	if err := enc.EncodeElement(metadata, xml.StartElement{Name: xml.Name{Local: "metadata"}}); err != nil {
+		return nil, errors.Wrap(err, "failed to write GPX metadata")
+	}
+	return &Writer{enc: enc}, nil
+}
+
+func (writer *Writer) WriteWaypoint(waypoint *Waypoint) error {
+	if writer.inTracks {
+		return errors.New("waypoints must be written before tracks")
+	}
+	return errors.Wrap(writer.enc.Encode(waypoint), "failed to write GPX waypoint")
+}
+
+func (writer *Writer) WriteTrack(track *Track) error {
+	writer.inTracks = true
+	return errors.Wrap(writer.enc.Encode(track), "failed to write GPX track")
+}
+
+func (writer *Writer) Close() error {
+	if err := writer.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "gpx"}}); err != nil {
+		return errors.Wrap(err, "failed to complete GPX")
+	}
+	return errors.Wrap(writer.enc.Close(), "failed to complete GPX")
+}
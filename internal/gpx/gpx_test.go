@@ -0,0 +1,59 @@
+package gpx
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var sb strings.Builder
+	w, err := NewWriter(&sb, "Roadworks", "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := w.WriteWaypoint(&Waypoint{Lat: 51.5, Lon: -0.12, Name: "High Street", Type: "road_closure"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	track := &Track{Name: "Low Road", Segments: []Segment{{Points: []TrackPoint{{Lat: 51.5, Lon: -0.12}, {Lat: 51.6, Lon: -0.13}}}}}
+	if err := w.WriteTrack(track); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.WriteWaypoint(&Waypoint{Lat: 1, Lon: 1}); err == nil {
+		t.Errorf("expected an error writing a waypoint after a track")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		XMLName   xml.Name `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+		Version   string   `xml:"version,attr"`
+		Name      string   `xml:"metadata>name"`
+		Waypoints []struct {
+			Lat  float64 `xml:"lat,attr"`
+			Lon  float64 `xml:"lon,attr"`
+			Name string  `xml:"name"`
+		} `xml:"wpt"`
+		Tracks []struct {
+			Name   string `xml:"name"`
+			Points []struct {
+				Lat float64 `xml:"lat,attr"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal([]byte(sb.String()), &doc); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, sb.String())
+	}
+
+	if doc.Version != "1.1" || doc.Name != "Roadworks" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if len(doc.Waypoints) != 1 || doc.Waypoints[0].Lat != 51.5 || doc.Waypoints[0].Lon != -0.12 || doc.Waypoints[0].Name != "High Street" {
+		t.Errorf("unexpected waypoints: %+v", doc.Waypoints)
+	}
+	if len(doc.Tracks) != 1 || len(doc.Tracks[0].Points) != 2 {
+		t.Errorf("unexpected tracks: %+v", doc.Tracks)
+	}
+}
@@ -0,0 +1,306 @@
+// Package graph is a GraphQL API over the events, grouped into works,
+// streets and promoters, so that clients can fetch related objects in one
+// round trip. Related objects are looked up in batches, per field, by the
+// loaders added to each request's context.
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+const (
+	maxDepth       = 10
+	maxParallelism = 50
+	// maxFirst caps the number of events in any list
+	maxFirst = 1000
+)
+
+// NewSchema parses the schema, checking it against the resolvers.
+func NewSchema(repo *internal.DbRepository, organisations promoter.Organisations) (*graphql.Schema, error) {
+	schema, err := graphql.ParseSchema(schemaSDL, &Resolver{repo: repo, organisations: organisations},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(maxDepth),
+		graphql.MaxParallelism(maxParallelism),
+	)
+	return schema, errors.Wrap(err, "failed to parse GraphQL schema")
+}
+
+// Resolver resolves the root query fields.
+type Resolver struct {
+	repo          *internal.DbRepository
+	organisations promoter.Organisations
+}
+
+type bboxInput struct {
+	MinX float64
+	MinY float64
+	MaxX float64
+	MaxY float64
+}
+
+type facetInput struct {
+	Name    string
+	Values  *[]string
+	Exclude *[]string
+}
+
+type windowInput struct {
+	MaxDaysAhead  *int32
+	MaxDaysBehind *int32
+	AsAt          *graphql.Time
+}
+
+type searchArgs struct {
+	BBox   *bboxInput
+	Q      *string
+	Facets *[]*facetInput
+	Window *windowInput
+}
+
+type pagedSearchArgs struct {
+	searchArgs
+	First  *int32
+	Offset *int32
+}
+
+type eventsArgs struct {
+	Window *windowInput
+	First  *int32
+	Offset *int32
+}
+
+func (r *Resolver) Events(args pagedSearchArgs) ([]*eventResolver, error) {
+	p, err := toPage(args.First, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := r.search(args.searchArgs, p)
+	if err != nil {
+		return nil, err
+	}
+	return r.events(events), nil
+}
+
+func (r *Resolver) Works(args searchArgs) ([]*workResolver, error) {
+	events, temporalFilters, err := r.search(args, page{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Summarised from all their permits, not only those matching the search
+	works, _, err := r.repo.GroupByWork(events, temporalFilters)
+	if err != nil {
+		return nil, failed(err, "Failed to look up works")
+	}
+	resolvers := make([]*workResolver, len(works))
+	for idx, work := range works {
+		resolvers[idx] = &workResolver{root: r, work: work}
+	}
+	return resolvers, nil
+}
+
+func (r *Resolver) Event(args struct{ ObjectReference string }) (*eventResolver, error) {
+	event, err := r.repo.FindByObjectReference(args.ObjectReference)
+	if err != nil {
+		return nil, failed(err, "Failed to look up object")
+	}
+	if event == nil {
+		return nil, nil
+	}
+	return &eventResolver{root: r, event: event}, nil
+}
+
+func (r *Resolver) Work(ctx context.Context, args struct{ WorkReferenceNumber string }) (*workResolver, error) {
+	return r.work(ctx, args.WorkReferenceNumber)
+}
+
+func (r *Resolver) Street(ctx context.Context, args struct{ USRN string }) (*streetResolver, error) {
+	events, err := loadersFrom(ctx).streetEvents.Load(ctx, eventsKey{value: args.USRN, window: defaultWindow, page: defaultPage})()
+	if err != nil {
+		return nil, failed(err, "Failed to look up street")
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return r.street(events[0]), nil
+}
+
+func (r *Resolver) Promoter(args struct{ SWACode string }) *promoterResolver {
+	return r.promoter(args.SWACode, nil)
+}
+
+// search finds the events matching the args, or - unless p is zero - the page
+// of them, in order of object reference.
+func (r *Resolver) search(args searchArgs, p page) ([]*models.Event, *models.TemporalFilters, error) {
+	text := ""
+	if args.Q != nil {
+		text = strings.TrimSpace(*args.Q)
+	}
+	if args.BBox == nil && text == "" {
+		return nil, nil, errors.New("bbox is required unless q is given")
+	}
+
+	var bbox *models.BBox
+	if args.BBox != nil {
+		bbox = &models.BBox{MinX: args.BBox.MinX, MinY: args.BBox.MinY, MaxX: args.BBox.MaxX, MaxY: args.BBox.MaxY}
+	}
+
+	facets, err := toFacets(args.Facets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, err := toWindow(args.Window)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	temporalFilters := w.temporalFilters()
+	var events []*models.Event
+	if p == (page{}) {
+		events, err = r.repo.Search(bbox, text, facets, temporalFilters)
+	} else {
+		events, _, err = r.repo.SearchPage(bbox, text, facets, temporalFilters, p.first, p.offset)
+	}
+	if err != nil {
+		return nil, nil, failed(err, "Failed to search events")
+	}
+	return events, temporalFilters, nil
+}
+
+func (r *Resolver) events(events []*models.Event) []*eventResolver {
+	resolvers := make([]*eventResolver, len(events))
+	for idx, event := range events {
+		resolvers[idx] = &eventResolver{root: r, event: event}
+	}
+	return resolvers
+}
+
+func (r *Resolver) work(ctx context.Context, workReferenceNumber string) (*workResolver, error) {
+	work, err := loadersFrom(ctx).works.Load(ctx, workReferenceNumber)()
+	if err != nil {
+		return nil, failed(err, "Failed to look up work")
+	}
+	if work == nil {
+		return nil, nil
+	}
+	return &workResolver{root: r, work: work}, nil
+}
+
+// street is the street an event is on, or nil if it has no USRN.
+func (r *Resolver) street(event *models.Event) *streetResolver {
+	if event.USRN == nil || *event.USRN == "" {
+		return nil
+	}
+	return &streetResolver{
+		root: r,
+		street: &models.Street{
+			USRN:             *event.USRN,
+			StreetName:       event.StreetName,
+			AreaName:         event.AreaName,
+			Town:             event.Town,
+			HighwayAuthority: event.HighwayAuthority,
+		},
+		authoritySWACode: event.HighwayAuthoritySWACode,
+	}
+}
+
+// promoter is identified by its SWA code, with the name from the known
+// organisations, or else as given on its events.
+func (r *Resolver) promoter(swaCode string, name *string) *promoterResolver {
+	resolver := &promoterResolver{root: r, swaCode: swaCode, name: name}
+	if org, ok := r.organisations[swaCode]; ok {
+		resolver.org = org
+		resolver.name = &org.Name
+	}
+	return resolver
+}
+
+func toFacets(inputs *[]*facetInput) (*models.Facets, error) {
+	facets := make(models.Facets)
+	if inputs == nil {
+		return &facets, nil
+	}
+
+	for _, input := range *inputs {
+		if !isFacet(input.Name) {
+			return nil, errors.Newf("unknown facet %s", input.Name)
+		}
+		if input.Values != nil {
+			for _, value := range *input.Values {
+				facets.Add(input.Name, value)
+			}
+		}
+		if input.Exclude != nil {
+			facets.Exclude(input.Name, *input.Exclude...)
+		}
+	}
+	return &facets, nil
+}
+
+func isFacet(name string) bool {
+	for _, facet := range models.FacetRegistry {
+		if facet.Param == name {
+			return true
+		}
+	}
+	return false
+}
+
+func toWindow(input *windowInput) (window, error) {
+	w := defaultWindow
+	if input == nil {
+		return w, nil
+	}
+
+	if input.MaxDaysAhead != nil {
+		w.maxDaysAhead = int(*input.MaxDaysAhead)
+	}
+	if input.MaxDaysBehind != nil {
+		w.maxDaysBehind = int(*input.MaxDaysBehind)
+	}
+	if w.maxDaysAhead < 0 || w.maxDaysBehind < 0 || w.maxDaysAhead > models.MaxWindowDays || w.maxDaysBehind > models.MaxWindowDays {
+		return w, errors.Newf("maxDaysAhead and maxDaysBehind must be between 0 and %d", models.MaxWindowDays)
+	}
+	if input.AsAt != nil {
+		w.asAt = input.AsAt.UTC().Format(time.RFC3339Nano)
+	}
+	return w, nil
+}
+
+func toPage(first *int32, offset *int32) (page, error) {
+	p := defaultPage
+	if first != nil {
+		p.first = int(*first)
+	}
+	if offset != nil {
+		p.offset = int(*offset)
+	}
+	if p.first < 1 || p.first > maxFirst {
+		return p, errors.Newf("first must be between 1 and %d", maxFirst)
+	}
+	if p.offset < 0 {
+		return p, errors.New("offset must be non-negative")
+	}
+	return p, nil
+}
+
+// failed logs the cause of a failure, returning just the message, so that
+// database errors are not exposed to clients.
+func failed(err error, message string) error {
+	log.Printf("%s: %v", message, err)
+	return errors.New(message)
+}
@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSchemaQueries(t *testing.T) {
+	organisations := promoter.Organisations{
+		"7001": {Id: "7001", Name: "Water Co", Url: "https://water.example.com"},
+	}
+	schema, err := NewSchema(nil, organisations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "Known promoter",
+			query:    `{ promoter(swaCode: "7001") { swaCode name websiteUrl logoUrl } }`,
+			expected: `{"promoter":{"swaCode":"7001","name":"Water Co","websiteUrl":"https://water.example.com","logoUrl":null}}`,
+		},
+		{
+			name:     "Unknown promoter",
+			query:    `{ promoter(swaCode: "9999") { swaCode name } }`,
+			expected: `{"promoter":{"swaCode":"9999","name":null}}`,
+		},
+		{
+			name:  "Search without bbox or q",
+			query: `{ events { objectReference } }`,
+			err:   "bbox is required unless q is given",
+		},
+		{
+			name:  "Too many events",
+			query: `{ events(q: "high", first: 1001) { objectReference } }`,
+			err:   "first must be between 1 and 1000",
+		},
+		{
+			name:  "Window too wide",
+			query: `{ events(q: "high", window: {maxDaysBehind: 10000}) { objectReference } }`,
+			err:   "maxDaysAhead and maxDaysBehind must be between 0 and 366",
+		},
+		{
+			name:  "Unknown facet",
+			query: `{ events(q: "high", facets: [{name: "colour", values: ["red"]}]) { objectReference } }`,
+			err:   "unknown facet colour",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := schema.Exec(WithLoaders(context.Background(), nil), tt.query, "", nil)
+			if tt.err != "" {
+				if len(response.Errors) != 1 || response.Errors[0].Message != tt.err {
+					t.Fatalf("got errors %v, want %s", response.Errors, tt.err)
+				}
+				return
+			}
+			if len(response.Errors) > 0 {
+				t.Fatalf("unexpected errors: %v", response.Errors)
+			}
+			if string(response.Data) != tt.expected {
+				t.Errorf("got %s, want %s", response.Data, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEventsLoaderBatches(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]string
+	fetch := func(usrns []string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sorted := slices.Clone(usrns)
+		slices.Sort(sorted)
+		calls = append(calls, sorted)
+
+		events := make([]*models.Event, 0)
+		for _, usrn := range usrns {
+			events = append(events, &models.Event{ObjectReference: "E-" + usrn, USRN: ptr(usrn)})
+		}
+		return events, nil
+	}
+	loader := newEventsLoader(fetch, func(event *models.Event) *string { return event.USRN })
+
+	ctx := context.Background()
+	keys := []eventsKey{
+		{value: "1", window: defaultWindow, page: defaultPage},
+		{value: "2", window: defaultWindow, page: defaultPage},
+		{value: "1", window: defaultWindow, page: defaultPage},
+		{value: "3", window: window{maxDaysAhead: 28}, page: defaultPage},
+		{value: "4", window: defaultWindow, page: page{first: 10}},
+	}
+	thunks := make([]func() ([]*models.Event, error), len(keys))
+	for idx, key := range keys {
+		thunks[idx] = loader.Load(ctx, key)
+	}
+
+	results := make([]string, len(keys))
+	for idx, thunk := range thunks {
+		events, err := thunk()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ := json.Marshal(events)
+		results[idx] = string(data)
+	}
+
+	if results[0] != results[2] || len(calls) != 3 {
+		t.Errorf("expected one query per window and page, got %v", calls)
+	}
+	slices.SortFunc(calls, func(a, b []string) int { return slices.Compare(a, b) })
+	if !slices.Equal(calls[0], []string{"1", "2"}) || !slices.Equal(calls[1], []string{"3"}) || !slices.Equal(calls[2], []string{"4"}) {
+		t.Errorf("unexpected batches: %v", calls)
+	}
+}
@@ -0,0 +1,143 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// batchWait is how long a loader waits for more keys before querying, which
+// only needs to be long enough for sibling resolvers to ask.
+const batchWait = 2 * time.Millisecond
+
+type loadersKey struct{}
+
+// loaders batch the lookups made while resolving the fields of a list, e.g.
+// the work of each event, into one query per field. They also cache the
+// results, so are created afresh for every request.
+type loaders struct {
+	works          *dataloader.Loader[string, *models.Work]
+	streetEvents   *dataloader.Loader[eventsKey, []*models.Event]
+	promoterEvents *dataloader.Loader[eventsKey, []*models.Event]
+}
+
+// WithLoaders adds the loaders for a request to its context, which must be
+// done before executing a query.
+func WithLoaders(ctx context.Context, repo *internal.DbRepository) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		works:          newWorksLoader(repo.FindByWorkReferences),
+		streetEvents:   newEventsLoader(repo.FindByUSRNs, func(event *models.Event) *string { return event.USRN }),
+		promoterEvents: newEventsLoader(repo.FindByPromoters, func(event *models.Event) *string { return event.PromoterSWACode }),
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// window is a comparable form of the temporal filters, for use in keys.
+type window struct {
+	maxDaysAhead  int
+	maxDaysBehind int
+	// asAt is in RFC 3339 format, or empty for now
+	asAt string
+}
+
+var defaultWindow = window{maxDaysAhead: 7}
+
+func (w window) temporalFilters() *models.TemporalFilters {
+	filters := &models.TemporalFilters{MaxDaysAhead: w.maxDaysAhead, MaxDaysBehind: w.maxDaysBehind}
+	if w.asAt != "" {
+		asAt, _ := time.Parse(time.RFC3339Nano, w.asAt)
+		filters.AsAt = &asAt
+	}
+	return filters
+}
+
+// page is the events of each street or promoter to return: up to first,
+// after skipping offset.
+type page struct {
+	first  int
+	offset int
+}
+
+var defaultPage = page{first: 100}
+
+// eventsKey is a street's USRN or a promoter's SWA code, with the window in
+// which its events must be active, and the page of them.
+type eventsKey struct {
+	value  string
+	window window
+	page   page
+}
+
+// newEventsLoader batches lookups of the events for each of many values
+// (e.g. streets), with one query per distinct window and page. keyOf is the
+// value of an event, by which the results are distributed.
+func newEventsLoader(
+	fetch func(values []string, temporalFilters *models.TemporalFilters, limit int, offset int) ([]*models.Event, error),
+	keyOf func(event *models.Event) *string,
+) *dataloader.Loader[eventsKey, []*models.Event] {
+	type batchKey struct {
+		window window
+		page   page
+	}
+
+	batch := func(ctx context.Context, keys []eventsKey) []*dataloader.Result[[]*models.Event] {
+		results := make([]*dataloader.Result[[]*models.Event], len(keys))
+
+		byBatch := make(map[batchKey][]int)
+		for idx, key := range keys {
+			bk := batchKey{window: key.window, page: key.page}
+			byBatch[bk] = append(byBatch[bk], idx)
+		}
+
+		for bk, indices := range byBatch {
+			values := make([]string, len(indices))
+			for i, idx := range indices {
+				values[i] = keys[idx].value
+			}
+
+			events, err := fetch(values, bk.window.temporalFilters(), bk.page.first, bk.page.offset)
+			grouped := make(map[string][]*models.Event)
+			for _, event := range events {
+				if value := keyOf(event); value != nil {
+					grouped[*value] = append(grouped[*value], event)
+				}
+			}
+
+			for _, idx := range indices {
+				found := grouped[keys[idx].value]
+				if found == nil {
+					found = []*models.Event{}
+				}
+				results[idx] = &dataloader.Result[[]*models.Event]{Data: found, Error: err}
+			}
+		}
+		return results
+	}
+	return dataloader.NewBatchedLoader(batch, dataloader.WithWait[eventsKey, []*models.Event](batchWait))
+}
+
+// newWorksLoader batches lookups of works by their reference number, where
+// an unknown work is nil.
+func newWorksLoader(fetch func(workReferenceNumbers []string) ([]*models.Event, error)) *dataloader.Loader[string, *models.Work] {
+	batch := func(ctx context.Context, keys []string) []*dataloader.Result[*models.Work] {
+		events, err := fetch(keys)
+		works, _ := models.GroupByWork(events)
+		byRef := make(map[string]*models.Work, len(works))
+		for _, work := range works {
+			byRef[work.WorkReferenceNumber] = work
+		}
+
+		results := make([]*dataloader.Result[*models.Work], len(keys))
+		for idx, key := range keys {
+			results[idx] = &dataloader.Result[*models.Work]{Data: byRef[key], Error: err}
+		}
+		return results
+	}
+	return dataloader.NewBatchedLoader(batch, dataloader.WithWait[string, *models.Work](batchWait))
+}
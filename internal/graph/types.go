@@ -0,0 +1,248 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+type eventResolver struct {
+	root  *Resolver
+	event *models.Event
+}
+
+func (r *eventResolver) ObjectReference() string { return r.event.ObjectReference }
+func (r *eventResolver) ObjectType() *string     { return r.event.ObjectType }
+func (r *eventResolver) EventType() string       { return r.event.EventType }
+func (r *eventResolver) EventTime() *graphql.Time {
+	return toTime(r.event.EventTime)
+}
+
+func (r *eventResolver) EventReference() *graphql.ID {
+	if r.event.EventReference == nil {
+		return nil
+	}
+	id := graphql.ID(strconv.FormatInt(*r.event.EventReference, 10))
+	return &id
+}
+
+func (r *eventResolver) USRN() *string { return r.event.USRN }
+func (r *eventResolver) Street() *streetResolver {
+	return r.root.street(r.event)
+}
+
+func (r *eventResolver) HighwayAuthority() *authorityResolver {
+	return toAuthority(r.event.HighwayAuthority, r.event.HighwayAuthoritySWACode)
+}
+
+func (r *eventResolver) Promoter() *promoterResolver {
+	if r.event.PromoterSWACode == nil || *r.event.PromoterSWACode == "" {
+		return nil
+	}
+	return r.root.promoter(*r.event.PromoterSWACode, r.event.PromoterOrganisation)
+}
+
+func (r *eventResolver) Work(ctx context.Context) (*workResolver, error) {
+	if r.event.WorkReferenceNumber == nil || *r.event.WorkReferenceNumber == "" {
+		return nil, nil
+	}
+	return r.root.work(ctx, *r.event.WorkReferenceNumber)
+}
+
+func (r *eventResolver) ActivityReferenceNumber() *string  { return r.event.ActivityReferenceNumber }
+func (r *eventResolver) WorkReferenceNumber() *string      { return r.event.WorkReferenceNumber }
+func (r *eventResolver) PermitReferenceNumber() *string    { return r.event.PermitReferenceNumber }
+func (r *eventResolver) Section58ReferenceNumber() *string { return r.event.Section58ReferenceNumber }
+
+func (r *eventResolver) Coordinates() *string {
+	for _, coords := range []*string{r.event.WorksLocationCoordinates, r.event.ActivityCoordinates, r.event.Section58Coordinates} {
+		if coords != nil && *coords != "" {
+			return coords
+		}
+	}
+	return nil
+}
+
+func (r *eventResolver) ActivityLocationDescription() *string {
+	return r.event.ActivityLocationDescription
+}
+
+func (r *eventResolver) WorkCategory() *string          { return r.event.WorkCategory }
+func (r *eventResolver) WorkCategoryRef() *string       { return r.event.WorkCategoryRef }
+func (r *eventResolver) WorkStatus() *string            { return r.event.WorkStatus }
+func (r *eventResolver) WorkStatusRef() *string         { return r.event.WorkStatusRef }
+func (r *eventResolver) PermitStatus() *string          { return r.event.PermitStatus }
+func (r *eventResolver) TrafficManagementType() *string { return r.event.TrafficManagementType }
+func (r *eventResolver) TrafficManagementTypeRef() *string {
+	return r.event.TrafficManagementTypeRef
+}
+
+func (r *eventResolver) CurrentTrafficManagementType() *string {
+	return r.event.CurrentTrafficManagementType
+}
+
+func (r *eventResolver) CurrentTrafficManagementTypeRef() *string {
+	return r.event.CurrentTrafficManagementTypeRef
+}
+
+func (r *eventResolver) RoadCategory() *string       { return r.event.RoadCategory }
+func (r *eventResolver) ActivityType() *string       { return r.event.ActivityType }
+func (r *eventResolver) Section58Status() *string    { return r.event.Section58Status }
+func (r *eventResolver) CloseFootway() *string       { return r.event.CloseFootway }
+func (r *eventResolver) CloseFootwayRef() *string    { return r.event.CloseFootwayRef }
+func (r *eventResolver) Cancelled() *string          { return r.event.Cancelled }
+func (r *eventResolver) IsTrafficSensitive() *string { return r.event.IsTrafficSensitive }
+
+func (r *eventResolver) PermitConditionCodes() []string {
+	if r.event.PermitConditionCodes == nil {
+		return []string{}
+	}
+	return r.event.PermitConditionCodes
+}
+
+func (r *eventResolver) StartsAt() *graphql.Time          { return toTime(r.event.StartsAt()) }
+func (r *eventResolver) EndsAt() *graphql.Time            { return toTime(r.event.EndsAt()) }
+func (r *eventResolver) ProposedStartDate() *graphql.Time { return toTime(r.event.ProposedStartDate) }
+func (r *eventResolver) ProposedEndDate() *graphql.Time   { return toTime(r.event.ProposedEndDate) }
+func (r *eventResolver) ActualStartDateTime() *graphql.Time {
+	return toTime(r.event.ActualStartDateTime)
+}
+
+func (r *eventResolver) ActualEndDateTime() *graphql.Time {
+	return toTime(r.event.ActualEndDateTime)
+}
+
+type workResolver struct {
+	root *Resolver
+	work *models.Work
+}
+
+func (r *workResolver) WorkReferenceNumber() string { return r.work.WorkReferenceNumber }
+
+func (r *workResolver) Promoter() *promoterResolver {
+	if r.work.PromoterSWACode == nil || *r.work.PromoterSWACode == "" {
+		return nil
+	}
+	return r.root.promoter(*r.work.PromoterSWACode, r.work.PromoterOrganisation)
+}
+
+// HighwayAuthority and Street are those of the first permit, as every permit
+// of a work is on the same street.
+func (r *workResolver) HighwayAuthority() *authorityResolver {
+	if len(r.work.Permits) == 0 {
+		return nil
+	}
+	permit := r.work.Permits[0]
+	return toAuthority(permit.HighwayAuthority, permit.HighwayAuthoritySWACode)
+}
+
+func (r *workResolver) Street() *streetResolver {
+	if len(r.work.Permits) == 0 {
+		return nil
+	}
+	return r.root.street(r.work.Permits[0])
+}
+
+func (r *workResolver) WorkStatus() *string       { return r.work.WorkStatus }
+func (r *workResolver) WorkStatusRef() *string    { return r.work.WorkStatusRef }
+func (r *workResolver) PermitStatus() *string     { return r.work.PermitStatus }
+func (r *workResolver) ActiveFrom() *graphql.Time { return toTime(r.work.ActiveFrom) }
+func (r *workResolver) ActiveTo() *graphql.Time   { return toTime(r.work.ActiveTo) }
+func (r *workResolver) Permits() []*eventResolver { return r.root.events(r.work.Permits) }
+
+type streetResolver struct {
+	root             *Resolver
+	street           *models.Street
+	authoritySWACode *string
+}
+
+func (r *streetResolver) USRN() string        { return r.street.USRN }
+func (r *streetResolver) StreetName() *string { return r.street.StreetName }
+func (r *streetResolver) AreaName() *string   { return r.street.AreaName }
+func (r *streetResolver) Town() *string       { return r.street.Town }
+func (r *streetResolver) HighwayAuthority() *authorityResolver {
+	return toAuthority(r.street.HighwayAuthority, r.authoritySWACode)
+}
+
+func (r *streetResolver) Events(ctx context.Context, args eventsArgs) ([]*eventResolver, error) {
+	w, err := toWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+	p, err := toPage(args.First, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := loadersFrom(ctx).streetEvents.Load(ctx, eventsKey{value: r.street.USRN, window: w, page: p})()
+	if err != nil {
+		return nil, failed(err, "Failed to look up street")
+	}
+	return r.root.events(events), nil
+}
+
+type promoterResolver struct {
+	root    *Resolver
+	swaCode string
+	name    *string
+	org     *models.PromoterOrg
+}
+
+func (r *promoterResolver) SWACode() string { return r.swaCode }
+func (r *promoterResolver) Name() *string   { return r.name }
+
+func (r *promoterResolver) WebsiteURL() *string {
+	if r.org == nil {
+		return nil
+	}
+	return &r.org.Url
+}
+
+func (r *promoterResolver) LogoURL() *string {
+	if r.org == nil {
+		return nil
+	}
+	return r.org.Favicon
+}
+
+func (r *promoterResolver) Events(ctx context.Context, args eventsArgs) ([]*eventResolver, error) {
+	w, err := toWindow(args.Window)
+	if err != nil {
+		return nil, err
+	}
+	p, err := toPage(args.First, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := loadersFrom(ctx).promoterEvents.Load(ctx, eventsKey{value: r.swaCode, window: w, page: p})()
+	if err != nil {
+		return nil, failed(err, "Failed to look up promoter events")
+	}
+	return r.root.events(events), nil
+}
+
+type authorityResolver struct {
+	name    string
+	swaCode *string
+}
+
+func (r *authorityResolver) Name() string     { return r.name }
+func (r *authorityResolver) SWACode() *string { return r.swaCode }
+
+func toAuthority(name *string, swaCode *string) *authorityResolver {
+	if name == nil || *name == "" {
+		return nil
+	}
+	return &authorityResolver{name: *name, swaCode: swaCode}
+}
+
+func toTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
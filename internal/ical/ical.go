@@ -0,0 +1,116 @@
+// Package ical writes iCalendar (RFC 5545) calendars of events.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest a content line may be, excluding the CRLF,
+// before it must be folded.
+const maxLineOctets = 75
+
+type Calendar struct {
+	ProductID string
+	Name      string
+	Events    []*Event
+}
+
+// Event is a VEVENT. Start is required; End and the text properties are
+// omitted when empty.
+type Event struct {
+	UID          string
+	Stamp        time.Time
+	LastModified *time.Time
+	Start        time.Time
+	End          *time.Time
+	Summary      string
+	Location     string
+	Description  string
+	URL          string
+	Cancelled    bool
+}
+
+// Write encodes the calendar, folding long lines and escaping text values.
+func (calendar *Calendar) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line := func(name string, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", calendar.ProductID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if calendar.Name != "" {
+		line("X-WR-CALNAME", escape(calendar.Name))
+	}
+
+	for _, event := range calendar.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(event.UID))
+		line("DTSTAMP", formatTime(event.Stamp))
+		if event.LastModified != nil {
+			line("LAST-MODIFIED", formatTime(*event.LastModified))
+		}
+		line("DTSTART", formatTime(event.Start))
+		if event.End != nil && event.End.After(event.Start) {
+			line("DTEND", formatTime(*event.End))
+		}
+		if event.Summary != "" {
+			line("SUMMARY", escape(event.Summary))
+		}
+		if event.Location != "" {
+			line("LOCATION", escape(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escape(event.Description))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		if event.Cancelled {
+			line("STATUS", "CANCELLED")
+		} else {
+			line("STATUS", "CONFIRMED")
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// writeFolded writes a content line, breaking it into lines of at most 75
+// octets (without splitting a UTF-8 sequence), with each continuation line
+// starting with a space.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// The leading space counts towards the length of continuation lines
+		limit = maxLineOctets - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
@@ -0,0 +1,106 @@
+package ical
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "High Street", expected: "High Street"},
+		{text: "High Street, Town; County", expected: `High Street\, Town\; County`},
+		{text: `C:\path`, expected: `C:\\path`},
+		{text: "line one\nline two\r\nline three", expected: `line one\nline two\nline three`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.text); got != tt.expected {
+			t.Errorf("escape(%q): got %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "Short", line: "SUMMARY:Roadworks"},
+		{name: "Exactly 75 octets", line: "SUMMARY:" + strings.Repeat("a", 67)},
+		{name: "Long", line: "DESCRIPTION:" + strings.Repeat("abcdefghij", 30)},
+		{name: "Multibyte", line: "DESCRIPTION:" + strings.Repeat("£€", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			w := bufio.NewWriter(&sb)
+			writeFolded(w, tt.line)
+			_ = w.Flush()
+
+			folded := strings.TrimSuffix(sb.String(), "\r\n")
+			for _, line := range strings.Split(folded, "\r\n") {
+				if len(line) > maxLineOctets {
+					t.Errorf("line of %d octets exceeds %d: %q", len(line), maxLineOctets, line)
+				}
+			}
+
+			if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != tt.line {
+				t.Errorf("unfolded line differs: got %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestCalendarWrite(t *testing.T) {
+	start := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	calendar := &Calendar{
+		ProductID: "-//test//EN",
+		Name:      "Roadworks",
+		Events: []*Event{
+			{UID: "PERMIT-1@example.com", Stamp: start, Start: start, End: &end, Summary: "Works, High Street"},
+			{UID: "PERMIT-2@example.com", Stamp: start, Start: start, Cancelled: true},
+		},
+	}
+
+	var sb strings.Builder
+	if err := calendar.Write(&sb); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Roadworks",
+		"BEGIN:VEVENT",
+		"UID:PERMIT-1@example.com",
+		"DTSTAMP:20250601T080000Z",
+		"DTSTART:20250601T080000Z",
+		"DTEND:20250603T080000Z",
+		`SUMMARY:Works\, High Street`,
+		"STATUS:CONFIRMED",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:PERMIT-2@example.com",
+		"DTSTAMP:20250601T080000Z",
+		"DTSTART:20250601T080000Z",
+		"STATUS:CANCELLED",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	if got := sb.String(); got != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,236 @@
+// Package kml streams KML 2.2 documents of placemarks.
+package kml
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/twpayne/go-geom"
+)
+
+const Namespace = "http://www.opengis.net/kml/2.2"
+
+// Style is a shared style, referenced by placemarks as "#<id>". Colours are
+// in KML's aabbggrr hex notation.
+type Style struct {
+	XMLName   xml.Name   `xml:"Style"`
+	ID        string     `xml:"id,attr,omitempty"`
+	IconStyle *IconStyle `xml:"IconStyle,omitempty"`
+	LineStyle *LineStyle `xml:"LineStyle,omitempty"`
+	PolyStyle *PolyStyle `xml:"PolyStyle,omitempty"`
+}
+
+type IconStyle struct {
+	Color string `xml:"color,omitempty"`
+	Icon  *Icon  `xml:"Icon,omitempty"`
+}
+
+type Icon struct {
+	Href string `xml:"href"`
+}
+
+type LineStyle struct {
+	Color string  `xml:"color,omitempty"`
+	Width float64 `xml:"width,omitempty"`
+}
+
+type PolyStyle struct {
+	Color string `xml:"color,omitempty"`
+}
+
+// Placemark is a feature with a geometry, which must be in WGS84 longitude
+// and latitude.
+type Placemark struct {
+	Name        string
+	Description string
+	StyleURL    string
+	// IconHref overrides the icon of the shared style
+	IconHref string
+	Begin    *time.Time
+	End      *time.Time
+	Data     []Data
+	Geometry geom.T
+}
+
+type Data struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type placemark struct {
+	XMLName      xml.Name  `xml:"Placemark"`
+	Name         string    `xml:"name,omitempty"`
+	Description  string    `xml:"description,omitempty"`
+	TimeSpan     *timeSpan `xml:"TimeSpan,omitempty"`
+	StyleURL     string    `xml:"styleUrl,omitempty"`
+	Style        *Style    `xml:"Style,omitempty"`
+	ExtendedData *struct {
+		Data []Data `xml:"Data"`
+	} `xml:"ExtendedData,omitempty"`
+	Geometry any
+}
+
+type timeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type point struct {
+	XMLName     xml.Name `xml:"Point"`
+	Coordinates string   `xml:"coordinates"`
+}
+
+type lineString struct {
+	XMLName     xml.Name `xml:"LineString"`
+	Tessellate  int      `xml:"tessellate"`
+	Coordinates string   `xml:"coordinates"`
+}
+
+type linearRing struct {
+	Coordinates string `xml:"LinearRing>coordinates"`
+}
+
+type polygon struct {
+	XMLName         xml.Name     `xml:"Polygon"`
+	Tessellate      int          `xml:"tessellate"`
+	OuterBoundaryIs linearRing   `xml:"outerBoundaryIs"`
+	InnerBoundaryIs []linearRing `xml:"innerBoundaryIs"`
+}
+
+type multiGeometry struct {
+	XMLName    xml.Name `xml:"MultiGeometry"`
+	Geometries []any
+}
+
+// Writer writes a document, one placemark at a time.
+type Writer struct {
+	enc *xml.Encoder
+}
+
+// NewWriter starts a document with the given shared styles.
+func NewWriter(w io.Writer, name string, styles []*Style) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, errors.Wrap(err, "failed to write KML")
+	}
+
+	enc := xml.NewEncoder(w)
+	start := []xml.Token{
+		xml.StartElement{Name: xml.Name{Local: "kml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}}},
+		xml.StartElement{Name: xml.Name{Local: "Document"}},
+	}
+	for _, token := range start {
+		if err := enc.EncodeToken(token); err != nil {
+			return nil, errors.Wrap(err, "failed to write KML")
+		}
+	}
+
+	if err := enc.EncodeElement(name, xml.StartElement{Name: xml.Name{Local: "name"}}); err != nil {
+		return nil, errors.Wrap(err, "failed to write KML")
+	}
+	for _, style := range styles {
+		if err := enc.Encode(style); err != nil {
+			return nil, errors.Wrap(err, "failed to write KML style")
+		}
+	}
+	return &Writer{enc: enc}, nil
+}
+
+func (writer *Writer) WritePlacemark(p *Placemark) error {
+	g, err := geometry(p.Geometry)
+	if err != nil {
+		return err
+	}
+
+	pm := &placemark{
+		Name:        p.Name,
+		Description: p.Description,
+		StyleURL:    p.StyleURL,
+		Geometry:    g,
+	}
+	if p.IconHref != "" {
+		pm.Style = &Style{IconStyle: &IconStyle{Icon: &Icon{Href: p.IconHref}}}
+	}
+	if p.Begin != nil || p.End != nil {
+		pm.TimeSpan = &timeSpan{Begin: formatTime(p.Begin), End: formatTime(p.End)}
+	}
+	if len(p.Data) > 0 {
+		pm.ExtendedData = &struct {
+			Data []Data `xml:"Data"`
+		}{Data: p.Data}
+	}
+
+	return errors.Wrap(writer.enc.Encode(pm), "failed to write KML placemark")
+}
+
+func (writer *Writer) Close() error {
+	for _, name := range []string{"Document", "kml"} {
+		if err := writer.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+			return errors.Wrap(err, "failed to complete KML")
+		}
+	}
+	return errors.Wrap(writer.enc.Close(), "failed to complete KML")
+}
+
+func geometry(g geom.T) (any, error) {
+	switch g := g.(type) {
+	case *geom.Point:
+		return &point{Coordinates: coordinates(g.FlatCoords(), g.Stride())}, nil
+	case *geom.LineString:
+		return &lineString{Tessellate: 1, Coordinates: coordinates(g.FlatCoords(), g.Stride())}, nil
+	case *geom.Polygon:
+		poly := &polygon{Tessellate: 1}
+		for i := range g.NumLinearRings() {
+			ring := g.LinearRing(i)
+			lr := linearRing{Coordinates: coordinates(ring.FlatCoords(), ring.Stride())}
+			if i == 0 {
+				poly.OuterBoundaryIs = lr
+			} else {
+				poly.InnerBoundaryIs = append(poly.InnerBoundaryIs, lr)
+			}
+		}
+		return poly, nil
+	case *geom.MultiPoint:
+		return multi(g.NumPoints(), func(i int) geom.T { return g.Point(i) })
+	case *geom.MultiLineString:
+		return multi(g.NumLineStrings(), func(i int) geom.T { return g.LineString(i) })
+	case *geom.MultiPolygon:
+		return multi(g.NumPolygons(), func(i int) geom.T { return g.Polygon(i) })
+	case *geom.GeometryCollection:
+		return multi(g.NumGeoms(), g.Geom)
+	default:
+		return nil, errors.Newf("unsupported geometry type %T", g)
+	}
+}
+
+func multi(n int, member func(i int) geom.T) (any, error) {
+	mg := &multiGeometry{Geometries: make([]any, n)}
+	for i := range n {
+		g, err := geometry(member(i))
+		if err != nil {
+			return nil, err
+		}
+		mg.Geometries[i] = g
+	}
+	return mg, nil
+}
+
+// coordinates formats the longitude and latitude of each coordinate as
+// "lon,lat", separated by spaces.
+func coordinates(flatCoords []float64, stride int) string {
+	parts := make([]string, 0, len(flatCoords)/stride)
+	for i := 0; i+1 < len(flatCoords); i += stride {
+		parts = append(parts, strconv.FormatFloat(flatCoords[i], 'f', 6, 64)+","+strconv.FormatFloat(flatCoords[i+1], 'f', 6, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
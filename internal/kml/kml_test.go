@@ -0,0 +1,94 @@
+package kml
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+func TestWriter(t *testing.T) {
+	var sb strings.Builder
+	w, err := NewWriter(&sb, "Roadworks", []*Style{{ID: "tm-road_closure", LineStyle: &LineStyle{Color: "ff0000ff", Width: 4}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	begin := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	for _, geometry := range []string{
+		"POINT(-1.5 52.25)",
+		"LINESTRING(-1.5 52.25, -1.4 52.3)",
+		"POLYGON((0 0, 1 0, 1 1, 0 0), (0.2 0.1, 0.3 0.1, 0.3 0.2, 0.2 0.1))",
+		"MULTIPOINT((1 2), (3 4))",
+	} {
+		g, err := wkt.Unmarshal(geometry)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err = w.WritePlacemark(&Placemark{
+			Name:     "High Street & Low Road",
+			StyleURL: "#tm-road_closure",
+			IconHref: "https://example.com/logo.png",
+			Begin:    &begin,
+			Data:     []Data{{Name: "object_reference", Value: "P1"}},
+			Geometry: g,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.opengis.net/kml/2.2 kml"`
+		Name    string   `xml:"Document>name"`
+		Styles  []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"Document>Style"`
+		Marks []struct {
+			Name     string   `xml:"name"`
+			StyleURL string   `xml:"styleUrl"`
+			Icon     string   `xml:"Style>IconStyle>Icon>href"`
+			Begin    string   `xml:"TimeSpan>begin"`
+			Data     string   `xml:"ExtendedData>Data>value"`
+			Point    string   `xml:"Point>coordinates"`
+			Line     string   `xml:"LineString>coordinates"`
+			Outer    string   `xml:"Polygon>outerBoundaryIs>LinearRing>coordinates"`
+			Inner    string   `xml:"Polygon>innerBoundaryIs>LinearRing>coordinates"`
+			Multi    []string `xml:"MultiGeometry>Point>coordinates"`
+		} `xml:"Document>Placemark"`
+	}
+	if err := xml.Unmarshal([]byte(sb.String()), &doc); err != nil {
+		t.Fatalf("invalid KML: %v\n%s", err, sb.String())
+	}
+
+	if doc.Name != "Roadworks" || len(doc.Styles) != 1 || doc.Styles[0].ID != "tm-road_closure" || len(doc.Marks) != 4 {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+
+	mark := doc.Marks[0]
+	if mark.Name != "High Street & Low Road" || mark.StyleURL != "#tm-road_closure" || mark.Icon != "https://example.com/logo.png" ||
+		mark.Begin != "2025-06-01T08:00:00Z" || mark.Data != "P1" {
+		t.Errorf("unexpected placemark: %+v", mark)
+	}
+
+	expected := []string{
+		"-1.500000,52.250000",
+		"-1.500000,52.250000 -1.400000,52.300000",
+		"0.000000,0.000000 1.000000,0.000000 1.000000,1.000000 0.000000,0.000000",
+		"1.000000,2.000000 3.000000,4.000000",
+	}
+	got := []string{doc.Marks[0].Point, doc.Marks[1].Line, doc.Marks[2].Outer, strings.Join(doc.Marks[3].Multi, " ")}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("placemark %d: got coordinates %q, want %q", i, got[i], expected[i])
+		}
+	}
+	if doc.Marks[2].Inner == "" {
+		t.Errorf("expected polygon hole to be written")
+	}
+}
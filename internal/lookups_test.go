@@ -0,0 +1,57 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestFindByUSRNsPagesEachStreet(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	event := func(ref string, usrn string, minutes int) *models.Event {
+		eventTime := start.Add(time.Duration(minutes) * time.Minute)
+		return &models.Event{
+			ObjectReference: ref, EventType: "PERMIT_GRANTED", USRN: ptr(usrn), EventTime: &eventTime,
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		}
+	}
+	upsert(t, repo,
+		event("A1", "1001", 1), event("A2", "1001", 2), event("A3", "1001", 3),
+		event("B1", "1002", 1), event("B2", "1002", 2),
+		event("C1", "1003", 1),
+	)
+
+	tests := []struct {
+		name     string
+		limit    int
+		offset   int
+		expected []string
+	}{
+		{name: "First of each", limit: 1, expected: []string{"A3", "B2", "C1"}},
+		{name: "Second of each", limit: 1, offset: 1, expected: []string{"A2", "B1"}},
+		{name: "All", limit: 10, expected: []string{"A3", "A2", "A1", "B2", "B1", "C1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.FindByUSRNs([]string{"1001", "1002", "1003"}, &models.TemporalFilters{MaxDaysAhead: 7}, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			refs := make([]string, len(events))
+			for idx, event := range events {
+				refs[idx] = event.ObjectReference
+			}
+			slices.SortStableFunc(refs, func(a, b string) int { return int(a[0]) - int(b[0]) })
+			if !slices.Equal(refs, tt.expected) {
+				t.Errorf("got %v, want %v", refs, tt.expected)
+			}
+		})
+	}
+}
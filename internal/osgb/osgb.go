@@ -0,0 +1,249 @@
+// Package osgb converts between British National Grid (EPSG:27700)
+// coordinates and WGS84 (EPSG:4326) longitude and latitude.
+//
+// It follows the Ordnance Survey's "A guide to coordinate systems in Great
+// Britain": an inverse transverse Mercator projection onto the Airy 1830
+// ellipsoid (OSGB36), followed by a Helmert transformation to WGS84, and the
+// reverse of each to convert back to the National Grid. The
+// Helmert transformation is accurate to within about 5 metres, which is
+// ample for locating street works, and avoids a dependency on PROJ.
+package osgb
+
+import (
+	"math"
+
+	"github.com/cockroachdb/errors"
+	"github.com/twpayne/go-geom"
+)
+
+type ellipsoid struct {
+	a, b float64
+}
+
+var (
+	airy1830 = ellipsoid{a: 6377563.396, b: 6356256.909}
+	wgs84    = ellipsoid{a: 6378137.000, b: 6356752.3141}
+)
+
+// National Grid projection
+const (
+	scaleFactor = 0.9996012717
+	trueOriginE = 400000.0
+	trueOriginN = -100000.0
+)
+
+var (
+	trueOriginLat = radians(49)
+	trueOriginLon = radians(-2)
+)
+
+// OSGB36 to WGS84 Helmert transformation parameters
+const (
+	tx    = 446.448
+	ty    = -125.157
+	tz    = 542.060
+	scale = 20.4894e-6
+)
+
+var (
+	rx = arcSeconds(0.1502)
+	ry = arcSeconds(0.2470)
+	rz = arcSeconds(0.8421)
+)
+
+// ToWGS84 converts an easting and northing to a WGS84 longitude and latitude
+// in degrees.
+func ToWGS84(easting float64, northing float64) (lon float64, lat float64) {
+	lat, lon = gridToOSGB36(easting, northing)
+	x, y, z := toCartesian(airy1830, lat, lon)
+	x, y, z = helmert(x, y, z)
+	lat, lon = fromCartesian(wgs84, x, y, z)
+	return degrees(lon), degrees(lat)
+}
+
+// FromWGS84 converts a WGS84 longitude and latitude in degrees to an easting
+// and northing.
+func FromWGS84(lon float64, lat float64) (easting float64, northing float64) {
+	x, y, z := toCartesian(wgs84, radians(lat), radians(lon))
+	x, y, z = inverseHelmert(x, y, z)
+	phi, lambda := fromCartesian(airy1830, x, y, z)
+	return osgb36ToGrid(phi, lambda)
+}
+
+// Reproject returns a copy of a geometry in British National Grid
+// coordinates with its coordinates converted to WGS84 longitude and latitude.
+// Any further dimensions (e.g. Z) are left unchanged.
+func Reproject(g geom.T) (geom.T, error) {
+	var clone geom.T
+	switch g := g.(type) {
+	case *geom.Point:
+		clone = g.Clone()
+	case *geom.LineString:
+		clone = g.Clone()
+	case *geom.Polygon:
+		clone = g.Clone()
+	case *geom.MultiPoint:
+		clone = g.Clone()
+	case *geom.MultiLineString:
+		clone = g.Clone()
+	case *geom.MultiPolygon:
+		clone = g.Clone()
+	case *geom.GeometryCollection:
+		collection := geom.NewGeometryCollection()
+		for _, member := range g.Geoms() {
+			reprojected, err := Reproject(member)
+			if err != nil {
+				return nil, err
+			}
+			if err := collection.Push(reprojected); err != nil {
+				return nil, errors.Wrap(err, "failed to build geometry collection")
+			}
+		}
+		return collection, nil
+	default:
+		return nil, errors.Newf("unsupported geometry type %T", g)
+	}
+
+	coords := clone.FlatCoords()
+	stride := clone.Stride()
+	for i := 0; i+1 < len(coords); i += stride {
+		coords[i], coords[i+1] = ToWGS84(coords[i], coords[i+1])
+	}
+	return clone, nil
+}
+
+// gridToOSGB36 is the inverse transverse Mercator projection, giving the
+// latitude and longitude in radians on the Airy 1830 ellipsoid.
+func gridToOSGB36(easting float64, northing float64) (lat float64, lon float64) {
+	a, b := airy1830.a, airy1830.b
+	e2 := 1 - (b*b)/(a*a)
+
+	lat = trueOriginLat
+	m := 0.0
+	for {
+		lat = (northing-trueOriginN-m)/(a*scaleFactor) + lat
+
+		m = meridionalArc(lat)
+
+		if math.Abs(northing-trueOriginN-m) < 0.00001 {
+			break
+		}
+	}
+
+	sinLat, cosLat, tanLat := math.Sin(lat), math.Cos(lat), math.Tan(lat)
+	nu := a * scaleFactor / math.Sqrt(1-e2*sinLat*sinLat)
+	rho := a * scaleFactor * (1 - e2) / math.Pow(1-e2*sinLat*sinLat, 1.5)
+	eta2 := nu/rho - 1
+
+	tan2, tan4, tan6 := tanLat*tanLat, math.Pow(tanLat, 4), math.Pow(tanLat, 6)
+	secLat := 1 / cosLat
+
+	vii := tanLat / (2 * rho * nu)
+	viii := tanLat / (24 * rho * math.Pow(nu, 3)) * (5 + 3*tan2 + eta2 - 9*tan2*eta2)
+	ix := tanLat / (720 * rho * math.Pow(nu, 5)) * (61 + 90*tan2 + 45*tan4)
+	x := secLat / nu
+	xi := secLat / (6 * math.Pow(nu, 3)) * (nu/rho + 2*tan2)
+	xii := secLat / (120 * math.Pow(nu, 5)) * (5 + 28*tan2 + 24*tan4)
+	xiia := secLat / (5040 * math.Pow(nu, 7)) * (61 + 662*tan2 + 1320*tan4 + 720*tan6)
+
+	de := easting - trueOriginE
+	lat = lat - vii*math.Pow(de, 2) + viii*math.Pow(de, 4) - ix*math.Pow(de, 6)
+	lon = trueOriginLon + x*de - xi*math.Pow(de, 3) + xii*math.Pow(de, 5) - xiia*math.Pow(de, 7)
+	return lat, lon
+}
+
+// osgb36ToGrid is the transverse Mercator projection of a latitude and
+// longitude in radians on the Airy 1830 ellipsoid.
+func osgb36ToGrid(lat float64, lon float64) (easting float64, northing float64) {
+	a, b := airy1830.a, airy1830.b
+	e2 := 1 - (b*b)/(a*a)
+
+	sinLat, cosLat, tanLat := math.Sin(lat), math.Cos(lat), math.Tan(lat)
+	nu := a * scaleFactor / math.Sqrt(1-e2*sinLat*sinLat)
+	rho := a * scaleFactor * (1 - e2) / math.Pow(1-e2*sinLat*sinLat, 1.5)
+	eta2 := nu/rho - 1
+
+	tan2, tan4 := tanLat*tanLat, math.Pow(tanLat, 4)
+	cos3, cos5 := math.Pow(cosLat, 3), math.Pow(cosLat, 5)
+
+	i := meridionalArc(lat) + trueOriginN
+	ii := nu / 2 * sinLat * cosLat
+	iii := nu / 24 * sinLat * cos3 * (5 - tan2 + 9*eta2)
+	iiia := nu / 720 * sinLat * cos5 * (61 - 58*tan2 + tan4)
+	iv := nu * cosLat
+	v := nu / 6 * cos3 * (nu/rho - tan2)
+	vi := nu / 120 * cos5 * (5 - 18*tan2 + tan4 + 14*eta2 - 58*tan2*eta2)
+
+	dl := lon - trueOriginLon
+	northing = i + ii*math.Pow(dl, 2) + iii*math.Pow(dl, 4) + iiia*math.Pow(dl, 6)
+	easting = trueOriginE + iv*dl + v*math.Pow(dl, 3) + vi*math.Pow(dl, 5)
+	return easting, northing
+}
+
+// meridionalArc is the distance along the central meridian from the true
+// origin to the latitude, scaled onto the grid.
+func meridionalArc(lat float64) float64 {
+	a, b := airy1830.a, airy1830.b
+	n := (a - b) / (a + b)
+	n2, n3 := n*n, n*n*n
+
+	ma := (1 + n + 5.0/4*n2 + 5.0/4*n3) * (lat - trueOriginLat)
+	mb := (3*n + 3*n2 + 21.0/8*n3) * math.Sin(lat-trueOriginLat) * math.Cos(lat+trueOriginLat)
+	mc := (15.0/8*n2 + 15.0/8*n3) * math.Sin(2*(lat-trueOriginLat)) * math.Cos(2*(lat+trueOriginLat))
+	md := 35.0 / 24 * n3 * math.Sin(3*(lat-trueOriginLat)) * math.Cos(3*(lat+trueOriginLat))
+	return b * scaleFactor * (ma - mb + mc - md)
+}
+
+func toCartesian(e ellipsoid, lat float64, lon float64) (x float64, y float64, z float64) {
+	e2 := 1 - (e.b*e.b)/(e.a*e.a)
+	sinLat := math.Sin(lat)
+	nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+	return nu * math.Cos(lat) * math.Cos(lon),
+		nu * math.Cos(lat) * math.Sin(lon),
+		nu * (1 - e2) * sinLat
+}
+
+func helmert(x float64, y float64, z float64) (float64, float64, float64) {
+	s := 1 + scale
+	return tx + s*x - rz*y + ry*z,
+		ty + rz*x + s*y - rx*z,
+		tz - ry*x + rx*y + s*z
+}
+
+// inverseHelmert reverses helmert by negating its parameters, which is
+// accurate to well within the transformation itself.
+func inverseHelmert(x float64, y float64, z float64) (float64, float64, float64) {
+	s := 1 - scale
+	return -tx + s*x + rz*y - ry*z,
+		-ty - rz*x + s*y + rx*z,
+		-tz + ry*x - rx*y + s*z
+}
+
+func fromCartesian(e ellipsoid, x float64, y float64, z float64) (lat float64, lon float64) {
+	e2 := 1 - (e.b*e.b)/(e.a*e.a)
+	p := math.Hypot(x, y)
+	lat = math.Atan2(z, p*(1-e2))
+	for range 10 {
+		sinLat := math.Sin(lat)
+		nu := e.a / math.Sqrt(1-e2*sinLat*sinLat)
+		next := math.Atan2(z+e2*nu*sinLat, p)
+		if math.Abs(next-lat) < 1e-12 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+	return lat, math.Atan2(y, x)
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+func arcSeconds(seconds float64) float64 {
+	return radians(seconds / 3600)
+}
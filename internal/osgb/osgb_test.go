@@ -0,0 +1,85 @@
+package osgb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+func TestGridToOSGB36(t *testing.T) {
+	// Worked example from "A guide to coordinate systems in Great Britain", C.2
+	lat, lon := gridToOSGB36(651409.903, 313177.270)
+
+	expectedLat := 52 + 39.0/60 + 27.2531/3600
+	expectedLon := 1 + 43.0/60 + 4.5177/3600
+	if math.Abs(degrees(lat)-expectedLat) > 1e-7 || math.Abs(degrees(lon)-expectedLon) > 1e-7 {
+		t.Errorf("got %.8f, %.8f, want %.8f, %.8f", degrees(lat), degrees(lon), expectedLat, expectedLon)
+	}
+}
+
+func TestOSGB36ToGrid(t *testing.T) {
+	// Worked example from "A guide to coordinate systems in Great Britain", C.1
+	easting, northing := osgb36ToGrid(radians(52+39.0/60+27.2531/3600), radians(1+43.0/60+4.5177/3600))
+
+	if math.Abs(easting-651409.903) > 0.001 || math.Abs(northing-313177.270) > 0.001 {
+		t.Errorf("got %.3f, %.3f, want 651409.903, 313177.270", easting, northing)
+	}
+}
+
+func TestToWGS84(t *testing.T) {
+	tests := []struct {
+		name        string
+		easting     float64
+		northing    float64
+		expectedLon float64
+		expectedLat float64
+	}{
+		// Reference values from the OS transformation (OSTN15), which the Helmert
+		// transformation approximates to within a few metres
+		{name: "Elizabeth Tower, London", easting: 530268, northing: 179640, expectedLon: -0.124630, expectedLat: 51.500683},
+		{name: "Caister water tower", easting: 651409.903, northing: 313177.270, expectedLon: 1.716073, expectedLat: 52.657977},
+	}
+
+	// About 10 metres
+	const tolerance = 0.0001
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lon, lat := ToWGS84(tt.easting, tt.northing)
+			if math.Abs(lon-tt.expectedLon) > tolerance || math.Abs(lat-tt.expectedLat) > tolerance {
+				t.Errorf("got %.6f, %.6f, want %.6f, %.6f", lon, lat, tt.expectedLon, tt.expectedLat)
+			}
+		})
+	}
+}
+
+func TestFromWGS84RoundTrip(t *testing.T) {
+	for _, grid := range [][2]float64{{530268, 179640}, {651409.903, 313177.270}, {325000, 673000}} {
+		lon, lat := ToWGS84(grid[0], grid[1])
+		easting, northing := FromWGS84(lon, lat)
+		if math.Abs(easting-grid[0]) > 0.01 || math.Abs(northing-grid[1]) > 0.01 {
+			t.Errorf("got %.3f, %.3f, want %.3f, %.3f", easting, northing, grid[0], grid[1])
+		}
+	}
+}
+
+func TestReproject(t *testing.T) {
+	g, err := wkt.Unmarshal("LINESTRING Z (530268 179640 12, 651409.903 313177.270 0)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reprojected, err := Reproject(g)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	coords := reprojected.FlatCoords()
+	if math.Abs(coords[0]+0.12463) > 0.0001 || math.Abs(coords[1]-51.50068) > 0.0001 || coords[2] != 12 {
+		t.Errorf("unexpected first coordinate: %v", coords[:3])
+	}
+
+	if original := g.FlatCoords(); original[0] != 530268 {
+		t.Errorf("expected the original geometry to be unchanged, got %v", original)
+	}
+}
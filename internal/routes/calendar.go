@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/ical"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const calendarProductID = "-//street-manager-relay//Street Manager Relay//EN"
+
+// HandleCalendar renders the permits, activities and section 58s on a street
+// (?usrn=) or within a bounding box (?bbox=, with the usual facets) as an
+// iCalendar feed, which calendar apps can subscribe to.
+func HandleCalendar(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var events []*models.Event
+		var name string
+
+		if usrn := c.Query("usrn"); usrn != "" {
+			temporalFilters, err := bindTemporalFilters(c)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			// The most recent, should a street have an unusual number of events
+			if events, _, err = repo.FindByUSRN(usrn, temporalFilters, lookupLimitMax, 0); err != nil {
+				_ = c.Error(errors.Wrap(err, "error looking up street"))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up street"})
+				return
+			}
+			name = "Street works on USRN " + usrn
+			if len(events) > 0 && events[0].StreetName != nil {
+				name = "Street works on " + *events[0].StreetName
+			}
+		} else {
+			if c.Query("bbox") == "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "one of bbox or usrn is required"})
+				return
+			}
+
+			criteria, err := bindSearchCriteria(c)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if events, err = repo.Search(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters); err != nil {
+				_ = c.Error(errors.Wrap(err, "error searching events"))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
+				return
+			}
+			name = "Street works"
+		}
+
+		calendar := &ical.Calendar{
+			ProductID: calendarProductID,
+			Name:      name,
+			Events:    make([]*ical.Event, 0, len(events)),
+		}
+		now := time.Now()
+		for _, event := range enrich(organisations, events) {
+			if vevent := toVEvent(event, now); vevent != nil {
+				calendar.Events = append(calendar.Events, vevent)
+			}
+		}
+
+		c.Header("Content-Type", "text/calendar; charset=utf-8")
+		c.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+		c.Status(http.StatusOK)
+		if err := calendar.Write(c.Writer); err != nil {
+			_ = c.Error(errors.Wrap(err, "error writing calendar"))
+		}
+	}
+}
+
+// toVEvent maps an event onto a VEVENT spanning its actual (or otherwise
+// proposed) start and end, or nil if it has no start.
+func toVEvent(event *EnrichedEvent, now time.Time) *ical.Event {
+	start := event.StartsAt()
+	if start == nil {
+		return nil
+	}
+
+	vevent := &ical.Event{
+		UID:          event.ObjectReference + "@street-manager-relay",
+		Stamp:        now,
+		LastModified: event.EventTime,
+		Start:        *start,
+		End:          event.EndsAt(),
+		Summary:      eventSummary(event.Event),
+		Location:     joinNonEmpty(", ", event.StreetName, event.AreaName, event.Town),
+		Description:  eventDescription(event),
+		Cancelled:    event.Cancelled != nil && *event.Cancelled == "Yes",
+	}
+	if event.PromoterWebsiteURL != nil {
+		vevent.URL = *event.PromoterWebsiteURL
+	}
+	return vevent
+}
+
+func eventSummary(event *models.Event) string {
+	var kind string
+	switch {
+	case event.Section58ReferenceNumber != nil:
+		kind = "Section 58"
+	case event.ActivityReferenceNumber != nil:
+		kind = "Activity"
+		if event.ActivityType != nil {
+			kind = *event.ActivityType
+		}
+	default:
+		kind = "Works"
+		if event.WorkCategory != nil {
+			kind = *event.WorkCategory + " works"
+		}
+	}
+
+	if event.StreetName != nil {
+		return fmt.Sprintf("%s: %s", kind, *event.StreetName)
+	}
+	return kind
+}
+
+func eventDescription(event *EnrichedEvent) string {
+	lines := make([]string, 0)
+	add := func(label string, value *string) {
+		if value != nil && *value != "" {
+			lines = append(lines, label+": "+*value)
+		}
+	}
+
+	add("Promoter", event.PromoterOrganisation)
+	add("Traffic management", firstNonEmpty(event.CurrentTrafficManagementType, event.TrafficManagementType))
+	add("Footway", event.CloseFootway)
+	add("Work status", event.WorkStatus)
+	add("Permit status", event.PermitStatus)
+	add("Activity", event.ActivityTypeDetails)
+	add("Section 58 status", event.Section58Status)
+	add("Location", firstNonEmpty(event.ActivityLocationDescription, event.WorksLocationType))
+	add("Work reference", event.WorkReferenceNumber)
+	add("Permit reference", event.PermitReferenceNumber)
+	add("Activity reference", event.ActivityReferenceNumber)
+	add("Section 58 reference", event.Section58ReferenceNumber)
+	return strings.Join(lines, "\n")
+}
+
+func firstNonEmpty(values ...*string) *string {
+	for _, value := range values {
+		if value != nil && *value != "" {
+			return value
+		}
+	}
+	return nil
+}
+
+func joinNonEmpty(sep string, values ...*string) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != nil && *value != "" {
+			parts = append(parts, *value)
+		}
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/tabular"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// exportColumns are the object reference followed by every field of an
+// enriched event, in the order they are declared.
+var exportColumns = append([]tabular.Column[EnrichedEvent]{{
+	Name:  "object_reference",
+	Type:  "TEXT",
+	Value: func(event *EnrichedEvent) string { return event.ObjectReference },
+}}, tabular.Columns[EnrichedEvent]()...)
+
+// bindExportColumns selects the columns given by the comma-separated columns
+// parameter, or all columns by default.
+func bindExportColumns(c *gin.Context) ([]tabular.Column[EnrichedEvent], error) {
+	names := expandCommaSeparated(c.QueryArray("columns"))
+	if len(names) == 0 {
+		return exportColumns, nil
+	}
+
+	columns := make([]tabular.Column[EnrichedEvent], 0, len(names))
+	for _, name := range names {
+		idx := slices.IndexFunc(exportColumns, func(column tabular.Column[EnrichedEvent]) bool { return column.Name == name })
+		if idx < 0 {
+			return nil, errors.Newf("unknown column '%s'", name)
+		}
+		columns = append(columns, exportColumns[idx])
+	}
+	return columns, nil
+}
+
+// exportSearch streams the search results as CSV or XLSX, writing each event
+// as it is read from the database.
+func exportSearch(c *gin.Context, repo *internal.DbRepository, organisations promoter.Organisations, criteria *searchCriteria, format string) {
+	columns, err := bindExportColumns(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var w tabular.Writer
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w = tabular.NewCSVWriter(c.Writer)
+	case "xlsx":
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		if w, err = tabular.NewXLSXWriter(c.Writer, "Search results"); err != nil {
+			_ = c.Error(errors.Wrap(err, "error starting export"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to export events"})
+			return
+		}
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="search.%s"`, format))
+	c.Status(http.StatusOK)
+
+	header := make([]string, len(columns))
+	for idx, column := range columns {
+		header[idx] = column.Name
+	}
+	if err := w.Write(header); err != nil {
+		_ = c.Error(errors.Wrap(err, "error writing export header"))
+		return
+	}
+
+	// Once the header is written the status can no longer be changed, so any
+	// errors result in a truncated export
+	err = repo.SearchEach(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, func(event *models.Event) error {
+		enriched := enrich(organisations, []*models.Event{event})[0]
+		row := make([]string, len(columns))
+		for idx, column := range columns {
+			row[idx] = column.Value(enriched)
+		}
+		return w.Write(row)
+	})
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error exporting events"))
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		_ = c.Error(errors.Wrap(err, "error completing export"))
+	}
+}
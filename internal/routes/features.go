@@ -0,0 +1,482 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/osgb"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+)
+
+// The OGC API - Features endpoints expose events as a single "events"
+// collection, for GIS tools which speak the standard rather than /search.
+const (
+	featuresPath = BasePath + "/ogc"
+
+	crs84  = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+	crsBNG = "http://www.opengis.net/def/crs/EPSG/0/27700"
+
+	defaultFeatureLimit = 100
+	maxFeatureLimit     = 1000
+
+	geoJSONContentType = "application/geo+json"
+)
+
+var conformanceClasses = []string{
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/core",
+	"http://www.opengis.net/spec/ogcapi-features-1/1.0/conf/geojson",
+	"http://www.opengis.net/spec/ogcapi-features-2/1.0/conf/crs",
+}
+
+// nationalGrid is the extent of British National Grid, used when no bbox is given.
+var nationalGrid = models.BBox{MinX: 0, MinY: 0, MaxX: 700000, MaxY: 1300000}
+
+// greatBritain is the extent of the data in CRS84, as minLon, minLat, maxLon, maxLat.
+var greatBritain = [4]float64{-8.82, 49.79, 1.92, 60.94}
+
+type OGCLink struct {
+	Href  string `json:"href"`
+	Rel   string `json:"rel"`
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type Feature struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Geometry   *geojson.Geometry `json:"geometry"`
+	Properties *EnrichedEvent    `json:"properties"`
+	Links      []OGCLink         `json:"links,omitempty"`
+}
+
+type FeatureCollection struct {
+	Type           string     `json:"type"`
+	Features       []*Feature `json:"features"`
+	Links          []OGCLink  `json:"links"`
+	NumberMatched  int        `json:"numberMatched"`
+	NumberReturned int        `json:"numberReturned"`
+	TimeStamp      time.Time  `json:"timeStamp"`
+	Attribution    []string   `json:"attribution"`
+}
+
+// featureQuery is a request for items, with the search criteria mapped onto
+// the native EPSG:27700 search.
+type featureQuery struct {
+	criteria *searchCriteria
+	limit    int
+	offset   int
+	crs      string
+}
+
+func HandleFeaturesLanding() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := bindFormat(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		base := baseURL(c) + featuresPath
+		c.JSON(http.StatusOK, gin.H{
+			"title":       "Street Manager Relay",
+			"description": "Street works permits, activities and section 58 restrictions from GOV.UK Street Manager",
+			"links": []OGCLink{
+				{Href: base, Rel: "self", Type: "application/json", Title: "This document"},
+				{Href: base + "/conformance", Rel: "conformance", Type: "application/json", Title: "Conformance classes"},
+				{Href: base + "/collections", Rel: "data", Type: "application/json", Title: "Collections"},
+			},
+			"attribution": internal.ATTRIBUTION,
+		})
+	}
+}
+
+func HandleFeaturesConformance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := bindFormat(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"conformsTo": conformanceClasses})
+	}
+}
+
+func HandleFeaturesCollections() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := bindFormat(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		base := baseURL(c) + featuresPath
+		c.JSON(http.StatusOK, gin.H{
+			"links": []OGCLink{
+				{Href: base + "/collections", Rel: "self", Type: "application/json", Title: "This document"},
+			},
+			"collections": []gin.H{eventsCollection(base)},
+			"crs":         []string{crs84, crsBNG},
+		})
+	}
+}
+
+func HandleFeaturesCollection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := bindFormat(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, eventsCollection(baseURL(c)+featuresPath))
+	}
+}
+
+func eventsCollection(base string) gin.H {
+	self := base + "/collections/events"
+	return gin.H{
+		"id":          "events",
+		"title":       "Street works events",
+		"description": "The current state of each permit, activity and section 58 restriction",
+		"itemType":    "feature",
+		"extent": gin.H{
+			"spatial": gin.H{
+				"bbox": [][]float64{greatBritain[:]},
+				"crs":  crs84,
+			},
+			"temporal": gin.H{
+				"interval": [][]*string{{nil, nil}},
+			},
+		},
+		"crs":        []string{crs84, crsBNG},
+		"storageCrs": crsBNG,
+		"links": []OGCLink{
+			{Href: self, Rel: "self", Type: "application/json", Title: "This document"},
+			{Href: self + "/items", Rel: "items", Type: geoJSONContentType, Title: "Events"},
+		},
+	}
+}
+
+// HandleFeatureItems searches for events, as per /search, returning a page of
+// them as GeoJSON features. Without a datetime, the same default window as
+// /search applies; the standard "../.." lifts it entirely.
+func HandleFeatureItems(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := bindFeatureQuery(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		criteria := query.criteria
+		page, matched, err := repo.SearchPage(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, query.limit, query.offset)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error searching events"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
+			return
+		}
+
+		base := baseURL(c)
+		features := make([]*Feature, 0, len(page))
+		for _, event := range enrich(organisations, page) {
+			features = append(features, toFeature(event, query.crs, ""))
+		}
+
+		links := []OGCLink{
+			{Href: pageURL(base, c.Request.URL, query.offset), Rel: "self", Type: geoJSONContentType, Title: "This document"},
+			{Href: base + featuresPath + "/collections/events", Rel: "collection", Type: "application/json", Title: "The events collection"},
+		}
+		if query.offset > 0 {
+			links = append(links, OGCLink{Href: pageURL(base, c.Request.URL, max(query.offset-query.limit, 0)), Rel: "prev", Type: geoJSONContentType, Title: "Previous page"})
+		}
+		if next := query.offset + query.limit; next < matched {
+			links = append(links, OGCLink{Href: pageURL(base, c.Request.URL, next), Rel: "next", Type: geoJSONContentType, Title: "Next page"})
+		}
+
+		c.Header("Content-Type", geoJSONContentType)
+		c.Header("Content-Crs", "<"+query.crs+">")
+		c.JSON(http.StatusOK, &FeatureCollection{
+			Type:           "FeatureCollection",
+			Features:       features,
+			Links:          links,
+			NumberMatched:  matched,
+			NumberReturned: len(features),
+			TimeStamp:      time.Now().UTC().Truncate(time.Second),
+			Attribution:    internal.ATTRIBUTION,
+		})
+	}
+}
+
+// HandleFeatureItem returns the current state of a single event as a GeoJSON
+// feature, identified by its object reference.
+func HandleFeatureItem(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := checkQueryParams(c, "f", "crs"); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := bindFormat(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		crs, err := bindCRS(c, "crs")
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		event, err := repo.FindByObjectReference(c.Param("featureId"))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up object"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up feature"})
+			return
+		}
+
+		if event == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Feature not found"})
+			return
+		}
+
+		c.Header("Content-Type", geoJSONContentType)
+		c.Header("Content-Crs", "<"+crs+">")
+		c.JSON(http.StatusOK, toFeature(enrich(organisations, []*models.Event{event})[0], crs, baseURL(c)))
+	}
+}
+
+// toFeature converts an event, with its geometry in the requested CRS, or
+// null if it has no valid coordinates. Links are only added when base is given.
+func toFeature(event *EnrichedEvent, crs string, base string) *Feature {
+	feature := &Feature{Type: "Feature", ID: event.ObjectReference, Properties: event}
+
+	if g, err := event.Geometry(); err == nil {
+		digits := 2
+		if crs == crs84 {
+			g, err = osgb.Reproject(g)
+			digits = 7
+		}
+		if err == nil {
+			feature.Geometry, _ = geojson.Encode(g, geojson.EncodeGeometryWithMaxDecimalDigits(digits))
+		}
+	}
+
+	if base != "" {
+		collection := base + featuresPath + "/collections/events"
+		feature.Links = []OGCLink{
+			{Href: collection + "/items/" + url.PathEscape(event.ObjectReference), Rel: "self", Type: geoJSONContentType, Title: "This feature"},
+			{Href: collection, Rel: "collection", Type: "application/json", Title: "The events collection"},
+		}
+	}
+	return feature
+}
+
+func bindFeatureQuery(c *gin.Context) (*featureQuery, error) {
+	allowed := []string{"f", "bbox", "bbox-crs", "crs", "datetime", "limit", "offset", "q"}
+	for _, facet := range models.FacetRegistry {
+		allowed = append(allowed, facet.Param, facet.Param+"__not")
+	}
+	if err := checkQueryParams(c, allowed...); err != nil {
+		return nil, err
+	}
+
+	if err := bindFormat(c); err != nil {
+		return nil, err
+	}
+
+	query := &featureQuery{limit: defaultFeatureLimit}
+	var err error
+	if query.crs, err = bindCRS(c, "crs"); err != nil {
+		return nil, err
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		// Larger limits are capped, as the standard allows
+		query.limit = min(limit, maxFeatureLimit)
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
+		}
+		query.offset = offset
+	}
+
+	bbox, err := bindFeatureBBox(c)
+	if err != nil {
+		return nil, err
+	}
+
+	facets, err := bindFacets(c)
+	if err != nil {
+		return nil, errors.New("Malformed facets")
+	}
+
+	temporalFilters := &models.TemporalFilters{MaxDaysAhead: 7, MaxDaysBehind: 0}
+	if value := c.Query("datetime"); value != "" {
+		if temporalFilters.From, temporalFilters.To, err = parseDatetime(value); err != nil {
+			return nil, err
+		}
+	}
+
+	query.criteria = &searchCriteria{
+		bbox:            bbox,
+		text:            strings.TrimSpace(c.Query("q")),
+		facets:          facets,
+		temporalFilters: temporalFilters,
+	}
+	return query, nil
+}
+
+// bindFeatureBBox parses the bbox, which is in CRS84 unless bbox-crs says
+// otherwise, into a British National Grid bounding box. A CRS84 bbox is
+// converted by its corners and edge midpoints, which suffices for the
+// curvature of the grid over the extent of a search.
+func bindFeatureBBox(c *gin.Context) (*models.BBox, error) {
+	value := c.Query("bbox")
+	if value == "" {
+		return &nationalGrid, nil
+	}
+
+	bboxCRS, err := bindCRS(c, "bbox-crs")
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 && len(parts) != 6 {
+		return nil, errors.New("bbox must have 4 (or 6) comma-separated numbers")
+	}
+	coords := make([]float64, len(parts))
+	for i, part := range parts {
+		if coords[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return nil, errors.Newf("bbox has an invalid number '%s'", part)
+		}
+	}
+	if len(coords) == 6 {
+		// Heights are disregarded
+		coords = []float64{coords[0], coords[1], coords[3], coords[4]}
+	}
+
+	if bboxCRS == crsBNG {
+		if coords[0] > coords[2] || coords[1] > coords[3] {
+			return nil, errors.New("bbox must be minX,minY,maxX,maxY in EPSG:27700")
+		}
+		return &models.BBox{MinX: coords[0], MinY: coords[1], MaxX: coords[2], MaxY: coords[3]}, nil
+	}
+
+	minLon, minLat, maxLon, maxLat := coords[0], coords[1], coords[2], coords[3]
+	if minLat < -90 || maxLat > 90 || minLat > maxLat || minLon > maxLon {
+		return nil, errors.New("bbox must be minLon,minLat,maxLon,maxLat in CRS84")
+	}
+
+	bounds := geom.NewBounds(geom.XY)
+	midLon, midLat := (minLon+maxLon)/2, (minLat+maxLat)/2
+	for _, lon := range []float64{minLon, midLon, maxLon} {
+		for _, lat := range []float64{minLat, midLat, maxLat} {
+			easting, northing := osgb.FromWGS84(lon, lat)
+			bounds.Extend(geom.NewPointFlat(geom.XY, []float64{easting, northing}))
+		}
+	}
+	return &models.BBox{
+		MinX: math.Floor(bounds.Min(0)),
+		MinY: math.Floor(bounds.Min(1)),
+		MaxX: math.Ceil(bounds.Max(0)),
+		MaxY: math.Ceil(bounds.Max(1)),
+	}, nil
+}
+
+// parseDatetime parses an instant or an interval with either end open ("..").
+// A date alone covers that whole day.
+func parseDatetime(value string) (*time.Time, *time.Time, error) {
+	start, end, isInterval := strings.Cut(value, "/")
+	if !isInterval {
+		end = start
+	}
+
+	from, err := parseDatetimeBound(start, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := parseDatetimeBound(end, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if from == nil && to == nil {
+		// Unbounded, though this still has to replace the default window
+		return &time.Time{}, nil, nil
+	}
+	if from != nil && to != nil && from.After(*to) {
+		return nil, nil, errors.New("datetime interval must not end before it starts")
+	}
+	return from, to, nil
+}
+
+func parseDatetimeBound(value string, end bool) (*time.Time, error) {
+	if value == "" || value == ".." {
+		return nil, nil
+	}
+
+	t, err := models.ParseTimestamp(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert datetime")
+	}
+	if end && len(value) == len(time.DateOnly) {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+func bindCRS(c *gin.Context, param string) (string, error) {
+	switch crs := c.DefaultQuery(param, crs84); crs {
+	case crs84, crsBNG:
+		return crs, nil
+	default:
+		return "", errors.Newf("%s must be one of: %s, %s", param, crs84, crsBNG)
+	}
+}
+
+func bindFormat(c *gin.Context) error {
+	if f := c.DefaultQuery("f", "json"); f != "json" {
+		return errors.New("f must be one of: json")
+	}
+	return nil
+}
+
+// checkQueryParams rejects unknown parameters, as the standard requires,
+// rather than silently returning unfiltered results.
+func checkQueryParams(c *gin.Context, allowed ...string) error {
+	for param := range c.Request.URL.Query() {
+		if !slices.Contains(allowed, param) {
+			return errors.Newf("unknown parameter '%s'", param)
+		}
+	}
+	return nil
+}
+
+// pageURL is the request URL with its offset replaced.
+func pageURL(base string, requestURL *url.URL, offset int) string {
+	params := requestURL.Query()
+	params.Del("offset")
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+
+	href := base + requestURL.Path
+	if encoded := params.Encode(); encoded != "" {
+		href += "?" + encoded
+	}
+	return href
+}
@@ -0,0 +1,249 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal/osgb"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const itemsPath = "/ogc/collections/events/items"
+
+func featuresFixture(t *testing.T) *gin.Engine {
+	event := func(ref string, coords string, start string, end string) *models.Event {
+		startsAt, _ := time.Parse(time.RFC3339, start)
+		endsAt, _ := time.Parse(time.RFC3339, end)
+		return &models.Event{
+			ObjectReference: ref, EventType: "WORK_START", PromoterSWACode: ptr("7001"),
+			WorksLocationCoordinates: ptr(coords), ProposedStartDate: &startsAt, ProposedEndDate: &endsAt,
+		}
+	}
+	return newTestRouter(t,
+		event("OBJ-A", "POINT(530100 180100)", "2025-06-01T08:00:00Z", "2025-06-05T17:00:00Z"),
+		event("OBJ-B", "POINT(530200 180200)", "2025-07-01T08:00:00Z", "2025-07-02T17:00:00Z"),
+		event("OBJ-C", "POINT(400000 300000)", "2025-06-01T08:00:00Z", "2025-06-05T17:00:00Z"),
+	)
+}
+
+type featureCollectionResponse struct {
+	Features []struct {
+		ID       string `json:"id"`
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+	Links          []OGCLink `json:"links"`
+	NumberMatched  int       `json:"numberMatched"`
+	NumberReturned int       `json:"numberReturned"`
+}
+
+func (response *featureCollectionResponse) ids() []string {
+	ids := make([]string, 0, len(response.Features))
+	for _, feature := range response.Features {
+		ids = append(ids, feature.ID)
+	}
+	return ids
+}
+
+func (response *featureCollectionResponse) link(rel string) string {
+	for _, link := range response.Links {
+		if link.Rel == rel {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+func TestHandleFeatureItems(t *testing.T) {
+	r := featuresFixture(t)
+
+	// Around OBJ-A and OBJ-B, in CRS84
+	lon, lat := osgb.ToWGS84(530150, 180150)
+	crs84BBox := fmt.Sprintf("%f,%f,%f,%f", lon-0.01, lat-0.01, lon+0.01, lat+0.01)
+	items := "http://example.com" + BasePath + itemsPath
+
+	tests := []struct {
+		name    string
+		params  url.Values
+		status  int
+		ids     []string
+		matched int
+		links   map[string]string
+		error   string
+	}{
+		{
+			name:   "CRS84 bbox",
+			params: url.Values{"bbox": {crs84BBox}, "datetime": {"../.."}},
+			status: http.StatusOK, ids: []string{"OBJ-A", "OBJ-B"}, matched: 2,
+		},
+		{
+			name:   "British National Grid bbox",
+			params: url.Values{"bbox": {"530000,180000,531000,181000"}, "bbox-crs": {crsBNG}, "datetime": {"../.."}},
+			status: http.StatusOK, ids: []string{"OBJ-A", "OBJ-B"}, matched: 2,
+		},
+		{
+			name:   "CRS84 bbox with heights",
+			params: url.Values{"bbox": {fmt.Sprintf("%f,%f,0,%f,%f,100", lon-0.01, lat-0.01, lon+0.01, lat+0.01)}, "datetime": {"../.."}},
+			status: http.StatusOK, ids: []string{"OBJ-A", "OBJ-B"}, matched: 2,
+		},
+		{
+			name:   "Inverted bbox",
+			params: url.Values{"bbox": {fmt.Sprintf("%f,%f,%f,%f", lon+0.01, lat, lon-0.01, lat)}},
+			status: http.StatusBadRequest, error: "bbox must be minLon,minLat,maxLon,maxLat in CRS84",
+		},
+		{
+			name:   "Date",
+			params: url.Values{"datetime": {"2025-06-03"}},
+			status: http.StatusOK, ids: []string{"OBJ-A", "OBJ-C"}, matched: 2,
+		},
+		{
+			name:   "Open start, ending on a date",
+			params: url.Values{"datetime": {"../2025-06-01"}},
+			status: http.StatusOK, ids: []string{"OBJ-A", "OBJ-C"}, matched: 2,
+		},
+		{
+			name:   "Open end",
+			params: url.Values{"datetime": {"2025-06-10T00:00:00Z/.."}},
+			status: http.StatusOK, ids: []string{"OBJ-B"}, matched: 1,
+		},
+		{
+			name:   "Default window",
+			params: url.Values{},
+			status: http.StatusOK, ids: []string{}, matched: 0,
+		},
+		{
+			name:   "Interval ending before it starts",
+			params: url.Values{"datetime": {"2025-07-02/2025-06-01"}},
+			status: http.StatusBadRequest, error: "datetime interval must not end before it starts",
+		},
+		{
+			name:   "Unknown parameter",
+			params: url.Values{"datetime": {"../.."}, "colour": {"red"}},
+			status: http.StatusBadRequest, error: "unknown parameter 'colour'",
+		},
+		{
+			name:   "First page",
+			params: url.Values{"datetime": {"../.."}, "limit": {"1"}},
+			status: http.StatusOK, ids: []string{"OBJ-A"}, matched: 3,
+			links: map[string]string{
+				"self": items + "?datetime=..%2F..&limit=1",
+				"next": items + "?datetime=..%2F..&limit=1&offset=1",
+				"prev": "",
+			},
+		},
+		{
+			name:   "Middle page",
+			params: url.Values{"datetime": {"../.."}, "limit": {"1"}, "offset": {"1"}},
+			status: http.StatusOK, ids: []string{"OBJ-B"}, matched: 3,
+			links: map[string]string{
+				"self": items + "?datetime=..%2F..&limit=1&offset=1",
+				"prev": items + "?datetime=..%2F..&limit=1",
+				"next": items + "?datetime=..%2F..&limit=1&offset=2",
+			},
+		},
+		{
+			name:   "Beyond the last page",
+			params: url.Values{"datetime": {"../.."}, "limit": {"2"}, "offset": {"5"}},
+			status: http.StatusOK, ids: []string{}, matched: 3,
+			links: map[string]string{
+				"prev": items + "?datetime=..%2F..&limit=2&offset=3",
+				"next": "",
+			},
+		},
+		{
+			name:   "Invalid limit",
+			params: url.Values{"limit": {"0"}},
+			status: http.StatusBadRequest, error: "limit must be a positive integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(r, itemsPath+"?"+tt.params.Encode())
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.error != "" {
+				if !strings.Contains(w.Body.String(), tt.error) {
+					t.Errorf("got %s, want error %q", w.Body, tt.error)
+				}
+				return
+			}
+
+			var response featureCollectionResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ids := response.ids(); !slices.Equal(ids, tt.ids) {
+				t.Errorf("got %v, want %v", ids, tt.ids)
+			}
+			if response.NumberMatched != tt.matched || response.NumberReturned != len(tt.ids) {
+				t.Errorf("got %d matched and %d returned, want %d and %d", response.NumberMatched, response.NumberReturned, tt.matched, len(tt.ids))
+			}
+			for rel, expected := range tt.links {
+				if href := response.link(rel); href != expected {
+					t.Errorf("got %s link %q, want %q", rel, href, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleFeatureItemsCRS(t *testing.T) {
+	r := featuresFixture(t)
+	lon, lat := osgb.ToWGS84(530100, 180100)
+
+	tests := []struct {
+		name     string
+		crs      string
+		expected []float64
+		epsilon  float64
+	}{
+		{name: "CRS84 by default", expected: []float64{lon, lat}, epsilon: 1e-6},
+		{name: "British National Grid", crs: crsBNG, expected: []float64{530100, 180100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{"bbox": {"530000,180000,530150,180150"}, "bbox-crs": {crsBNG}, "datetime": {"../.."}}
+			if tt.crs != "" {
+				params.Set("crs", tt.crs)
+			}
+			w := get(r, itemsPath+"?"+params.Encode())
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+
+			expectedCRS := crs84
+			if tt.crs != "" {
+				expectedCRS = tt.crs
+			}
+			if crs := w.Header().Get("Content-Crs"); crs != "<"+expectedCRS+">" {
+				t.Errorf("got Content-Crs %s, want <%s>", crs, expectedCRS)
+			}
+
+			var response featureCollectionResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(response.Features) != 1 {
+				t.Fatalf("got %v, want OBJ-A alone", response.ids())
+			}
+			coords := response.Features[0].Geometry.Coordinates
+			if len(coords) != 2 || math.Abs(coords[0]-tt.expected[0]) > tt.epsilon || math.Abs(coords[1]-tt.expected[1]) > tt.epsilon {
+				t.Errorf("got %v, want %v", coords, tt.expected)
+			}
+		})
+	}
+}
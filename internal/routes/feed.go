@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/atom"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	defaultFeedEntries = 50
+	maxFeedEntries     = 200
+
+	// feedTagPrefix is the prefix of the tag URIs (RFC 4151) identifying entries
+	feedTagPrefix = "tag:street-manager-relay,2025:"
+)
+
+// HandleFeed renders the latest changes within a bounding box, and matching
+// the facets, as an Atom feed, most recent event first.
+func HandleFeed(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bbox, err := models.BoundingBoxFromCSV(c.Query("bbox"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		facets, err := bindFacets(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Malformed facets"})
+			return
+		}
+
+		limit := defaultFeedEntries
+		if value := c.Query("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxFeedEntries {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxFeedEntries)})
+				return
+			}
+		}
+
+		changes, err := repo.LatestChanges(bbox, facets, limit)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error reading latest changes"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to read latest changes"})
+			return
+		}
+
+		base := baseURL(c)
+		updated := time.Now()
+		if len(changes) > 0 && changes[0].Event.EventTime != nil {
+			updated = *changes[0].Event.EventTime
+		}
+
+		self := base + c.Request.URL.RequestURI()
+		feed := atom.NewFeed(feedID(bbox, facets), "Street works changes", updated)
+		feed.Subtitle = "Changes to permits, activities and section 58s within " + c.Query("bbox")
+		feed.Links = []atom.Link{{Href: self, Rel: "self", Type: "application/atom+xml"}}
+		feed.Author = &atom.Person{Name: "Street Manager"}
+		feed.Rights = strings.Join(internal.ATTRIBUTION, " ")
+		feed.Generator = "street-manager-relay"
+
+		for _, change := range changes {
+			event := enrich(organisations, []*models.Event{change.Event})[0]
+			feed.Entries = append(feed.Entries, toFeedEntry(base, change, event))
+		}
+
+		c.Header("Content-Type", "application/atom+xml; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := feed.Write(c.Writer); err != nil {
+			_ = c.Error(errors.Wrap(err, "error writing feed"))
+		}
+	}
+}
+
+func toFeedEntry(base string, change *models.Change, event *EnrichedEvent) *atom.Entry {
+	// Each event notification from Street Manager has a unique reference, but
+	// fall back to the history id in case it is missing
+	id := feedTagPrefix + "history/" + strconv.FormatInt(change.ID, 10)
+	if event.EventReference != nil {
+		id = feedTagPrefix + "event/" + strconv.FormatInt(*event.EventReference, 10)
+	}
+
+	updated := time.Now()
+	if event.EventTime != nil {
+		updated = *event.EventTime
+	}
+
+	entry := &atom.Entry{
+		ID:      id,
+		Title:   fmt.Sprintf("%s (%s)", eventSummary(event.Event), strings.ToLower(strings.ReplaceAll(event.EventType, "_", " "))),
+		Updated: atom.Time(updated),
+		Links: []atom.Link{{
+			Href: base + BasePath + "/objects/" + url.PathEscape(event.ObjectReference),
+			Rel:  "alternate",
+			Type: "application/json",
+		}},
+		Categories: []atom.Category{{Term: event.EventType}, {Term: change.Kind}},
+		Content:    &atom.Text{Type: "text", Body: eventDescription(event)},
+	}
+
+	if event.PromoterWebsiteURL != nil {
+		entry.Links = append(entry.Links, atom.Link{Href: *event.PromoterWebsiteURL, Rel: "related", Type: "text/html"})
+	}
+	return entry
+}
+
+// feedID identifies a feed by the changes it selects, rather than by its URL,
+// so that it stays the same however the bbox and facets are written, and
+// whichever host it is fetched from.
+func feedID(bbox *models.BBox, facets *models.Facets) string {
+	params := url.Values{"bbox": {strings.Join([]string{
+		strconv.FormatFloat(bbox.MinX, 'f', -1, 64),
+		strconv.FormatFloat(bbox.MinY, 'f', -1, 64),
+		strconv.FormatFloat(bbox.MaxX, 'f', -1, 64),
+		strconv.FormatFloat(bbox.MaxY, 'f', -1, 64),
+	}, ",")}}
+
+	for param, filter := range *facets {
+		values := slices.Clone(filter.Include)
+		for _, excluded := range filter.Exclude {
+			values = append(values, "!"+excluded)
+		}
+		slices.Sort(values)
+		params[param] = slices.Compact(values)
+	}
+	return feedTagPrefix + "feed?" + params.Encode()
+}
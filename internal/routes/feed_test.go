@@ -0,0 +1,112 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestHandleFeed(t *testing.T) {
+	eventTime := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	deps := newTestDependencies(t, &models.Event{
+		ObjectReference: "OBJ-A", EventType: "WORK_START", PromoterSWACode: ptr("7001"), EventTime: &eventTime,
+		WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &eventTime, ProposedEndDate: &eventTime,
+	})
+	// As the remote address of requests made by httptest
+	deps.TrustedProxies = []string{"192.0.2.0/24"}
+	r := newTestRouterWith(t, deps)
+
+	const (
+		id         = "tag:street-manager-relay,2025:feed?bbox=530000%2C180000%2C531000%2C181000"
+		filteredID = "tag:street-manager-relay,2025:feed?bbox=530000%2C180000%2C531000%2C181000&event_type=%21ITEM_REVERTED&event_type=WORK_START"
+	)
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		headers    map[string]string
+		id         string
+		self       string
+	}{
+		{
+			name: "BBox",
+			path: "/feed.atom?bbox=530000,180000,531000,181000",
+			id:   id, self: "http://example.com" + BasePath + "/feed.atom?bbox=530000,180000,531000,181000",
+		},
+		{
+			name: "BBox reordered, with a limit",
+			path: "/feed.atom?bbox=531000,181000.0,530000,180000&limit=10",
+			id:   id, self: "http://example.com" + BasePath + "/feed.atom?bbox=531000,181000.0,530000,180000&limit=10",
+		},
+		{
+			name: "Facets",
+			path: "/feed.atom?bbox=530000,180000,531000,181000&event_type=!ITEM_REVERTED,WORK_START",
+			id:   filteredID, self: "http://example.com" + BasePath + "/feed.atom?bbox=530000,180000,531000,181000&event_type=!ITEM_REVERTED,WORK_START",
+		},
+		{
+			name: "Facets in another order",
+			path: "/feed.atom?event_type=WORK_START&bbox=530000,180000,531000,181000&event_type__not=ITEM_REVERTED",
+			id:   filteredID, self: "http://example.com" + BasePath + "/feed.atom?event_type=WORK_START&bbox=530000,180000,531000,181000&event_type__not=ITEM_REVERTED",
+		},
+		{
+			name:    "Forwarded by a trusted proxy",
+			path:    "/feed.atom?bbox=530000,180000,531000,181000",
+			headers: map[string]string{"X-Forwarded-Host": "relay.example.org, proxy.internal", "X-Forwarded-Proto": "https"},
+			id:      id, self: "https://relay.example.org" + BasePath + "/feed.atom?bbox=530000,180000,531000,181000",
+		},
+		{
+			name:       "Forwarded by anything else",
+			path:       "/feed.atom?bbox=530000,180000,531000,181000",
+			remoteAddr: "203.0.113.1:1234",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.example.net", "X-Forwarded-Proto": "https"},
+			id:         id, self: "http://example.com" + BasePath + "/feed.atom?bbox=530000,180000,531000,181000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, BasePath+tt.path, nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+
+			var feed struct {
+				ID    string `xml:"id"`
+				Links []struct {
+					Href string `xml:"href,attr"`
+					Rel  string `xml:"rel,attr"`
+				} `xml:"link"`
+				Entries []struct {
+					ID string `xml:"id"`
+				} `xml:"entry"`
+			}
+			if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if feed.ID != tt.id {
+				t.Errorf("got id %q, want %q", feed.ID, tt.id)
+			}
+			if len(feed.Links) != 1 || feed.Links[0].Rel != "self" || feed.Links[0].Href != tt.self {
+				t.Errorf("got links %v, want self %q", feed.Links, tt.self)
+			}
+			if len(feed.Entries) != 1 {
+				t.Errorf("got %d entries, want 1", len(feed.Entries))
+			}
+		})
+	}
+}
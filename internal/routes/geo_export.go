@@ -0,0 +1,263 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/gpx"
+	"github.com/rm-hull/street-manager-relay/internal/kml"
+	"github.com/rm-hull/street-manager-relay/internal/osgb"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+	"github.com/twpayne/go-geom"
+)
+
+const defaultTrafficManagementStyle = "tm-unknown"
+
+// trafficManagementColours are the KML (aabbggrr) colours for each
+// traffic_management_type_ref, from the most to the least disruptive.
+var trafficManagementColours = []struct{ ref, colour string }{
+	{"road_closure", "ff0000ff"},
+	{"lane_closure", "ff0080ff"},
+	{"contraflow", "ff0080ff"},
+	{"multi_way_signals", "ff00c0ff"},
+	{"two_way_signals", "ff00c0ff"},
+	{"convoy_workings", "ff00c0ff"},
+	{"stop_go_boards", "ff00c0ff"},
+	{"priority_working", "ff00ffff"},
+	{"give_and_take", "ff00ffff"},
+	{"some_carriageway_incursion", "ff00ffff"},
+	{"no_carriageway_incursion", "ff00c000"},
+	{"footway_closure", "ffff00aa"},
+}
+
+func trafficManagementStyles() []*kml.Style {
+	styles := make([]*kml.Style, 0, len(trafficManagementColours)+1)
+	add := func(id string, colour string) {
+		styles = append(styles, &kml.Style{
+			ID:        id,
+			IconStyle: &kml.IconStyle{Color: colour},
+			LineStyle: &kml.LineStyle{Color: colour, Width: 4},
+			// Semi-transparent fill
+			PolyStyle: &kml.PolyStyle{Color: "7f" + colour[2:]},
+		})
+	}
+
+	for _, tm := range trafficManagementColours {
+		add("tm-"+tm.ref, tm.colour)
+	}
+	add(defaultTrafficManagementStyle, "ff808080")
+	return styles
+}
+
+func trafficManagementStyleURL(event *models.Event) string {
+	if ref := event.TrafficManagementTypeRef; ref != nil {
+		for _, tm := range trafficManagementColours {
+			if tm.ref == *ref {
+				return "#tm-" + tm.ref
+			}
+		}
+	}
+	return "#" + defaultTrafficManagementStyle
+}
+
+// wgs84Geometry is the event's location reprojected to WGS84, or nil if it
+// has none (or it cannot be parsed), in which case it is left out of exports.
+func wgs84Geometry(event *models.Event) geom.T {
+	g, err := event.Geometry()
+	if err != nil {
+		return nil
+	}
+	reprojected, err := osgb.Reproject(g)
+	if err != nil {
+		return nil
+	}
+	return reprojected
+}
+
+// exportKML streams the search results as KML placemarks, styled by their
+// traffic management type, with the promoter's logo as the icon.
+func exportKML(c *gin.Context, repo *internal.DbRepository, organisations promoter.Organisations, criteria *searchCriteria) {
+	c.Header("Content-Type", "application/vnd.google-earth.kml+xml")
+	c.Header("Content-Disposition", `attachment; filename="search.kml"`)
+	c.Status(http.StatusOK)
+
+	w, err := kml.NewWriter(c.Writer, "Street works", trafficManagementStyles())
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error starting KML export"))
+		return
+	}
+
+	err = repo.SearchEach(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, func(event *models.Event) error {
+		g := wgs84Geometry(event)
+		if g == nil {
+			return nil
+		}
+
+		enriched := enrich(organisations, []*models.Event{event})[0]
+		placemark := &kml.Placemark{
+			Name:        eventSummary(event),
+			Description: eventDescription(enriched),
+			StyleURL:    trafficManagementStyleURL(event),
+			Begin:       event.StartsAt(),
+			End:         event.EndsAt(),
+			Data:        []kml.Data{{Name: "object_reference", Value: event.ObjectReference}, {Name: "event_type", Value: event.EventType}},
+			Geometry:    g,
+		}
+		if enriched.PromoterLogoURL != nil {
+			placemark.IconHref = *enriched.PromoterLogoURL
+		}
+		return w.WritePlacemark(placemark)
+	})
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error exporting events"))
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		_ = c.Error(errors.Wrap(err, "error completing export"))
+	}
+}
+
+// exportGPX streams the search results as GPX, with a waypoint at the start
+// of each event, followed by tracks for those located by a line or polygon.
+// As GPX requires all the waypoints first, the tracks are held back until the
+// waypoints have been written, rather than searching a second time, which
+// could see different results.
+func exportGPX(c *gin.Context, repo *internal.DbRepository, organisations promoter.Organisations, criteria *searchCriteria) {
+	c.Header("Content-Type", "application/gpx+xml")
+	c.Header("Content-Disposition", `attachment; filename="search.gpx"`)
+	c.Status(http.StatusOK)
+
+	w, err := gpx.NewWriter(c.Writer, "Street works", "street-manager-relay")
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error starting GPX export"))
+		return
+	}
+
+	var tracks []*gpx.Track
+	err = repo.SearchEach(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, func(event *models.Event) error {
+		g := wgs84Geometry(event)
+		if g == nil {
+			return nil
+		}
+		enriched := enrich(organisations, []*models.Event{event})[0]
+
+		if segments := gpxSegments(g); len(segments) > 0 {
+			tracks = append(tracks, &gpx.Track{
+				Name:        eventSummary(event),
+				Description: eventDescription(enriched),
+				Link:        gpxLink(enriched),
+				Type:        deref(event.TrafficManagementTypeRef),
+				Segments:    segments,
+			})
+		}
+
+		first, ok := firstCoord(g)
+		if !ok {
+			return nil
+		}
+		return w.WriteWaypoint(&gpx.Waypoint{
+			Lat:         first[1],
+			Lon:         first[0],
+			Name:        eventSummary(event),
+			Description: eventDescription(enriched),
+			Link:        gpxLink(enriched),
+			Type:        deref(event.TrafficManagementTypeRef),
+		})
+	})
+	if err == nil {
+		for _, track := range tracks {
+			if err = w.WriteTrack(track); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error exporting events"))
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		_ = c.Error(errors.Wrap(err, "error completing export"))
+	}
+}
+
+// firstCoord is the first vertex of a geometry, looking inside collections,
+// which have no flat coordinates of their own.
+func firstCoord(g geom.T) (geom.Coord, bool) {
+	if collection, ok := g.(*geom.GeometryCollection); ok {
+		for _, member := range collection.Geoms() {
+			if coord, ok := firstCoord(member); ok {
+				return coord, true
+			}
+		}
+		return nil, false
+	}
+
+	flatCoords := g.FlatCoords()
+	if len(flatCoords) < 2 {
+		return nil, false
+	}
+	return geom.Coord(flatCoords[:2]), true
+}
+
+func gpxLink(event *EnrichedEvent) *gpx.Link {
+	if event.PromoterWebsiteURL == nil {
+		return nil
+	}
+	return &gpx.Link{Href: *event.PromoterWebsiteURL, Text: deref(event.PromoterOrganisation)}
+}
+
+// gpxSegments are the lines and polygon rings of a geometry, as track
+// segments. Points have no segments.
+func gpxSegments(g geom.T) []gpx.Segment {
+	switch g := g.(type) {
+	case *geom.LineString:
+		return []gpx.Segment{gpxSegment(g.FlatCoords(), g.Stride())}
+	case *geom.Polygon:
+		segments := make([]gpx.Segment, g.NumLinearRings())
+		for i := range segments {
+			ring := g.LinearRing(i)
+			segments[i] = gpxSegment(ring.FlatCoords(), ring.Stride())
+		}
+		return segments
+	case *geom.MultiLineString:
+		segments := make([]gpx.Segment, 0, g.NumLineStrings())
+		for i := range g.NumLineStrings() {
+			segments = append(segments, gpxSegments(g.LineString(i))...)
+		}
+		return segments
+	case *geom.MultiPolygon:
+		segments := make([]gpx.Segment, 0, g.NumPolygons())
+		for i := range g.NumPolygons() {
+			segments = append(segments, gpxSegments(g.Polygon(i))...)
+		}
+		return segments
+	case *geom.GeometryCollection:
+		segments := make([]gpx.Segment, 0, g.NumGeoms())
+		for _, member := range g.Geoms() {
+			segments = append(segments, gpxSegments(member)...)
+		}
+		return segments
+	default:
+		return nil
+	}
+}
+
+func gpxSegment(flatCoords []float64, stride int) gpx.Segment {
+	points := make([]gpx.TrackPoint, 0, len(flatCoords)/stride)
+	for i := 0; i+1 < len(flatCoords); i += stride {
+		points = append(points, gpx.TrackPoint{Lon: flatCoords[i], Lat: flatCoords[i+1]})
+	}
+	return gpx.Segment{Points: points}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+func TestFirstCoord(t *testing.T) {
+	tests := []struct {
+		name     string
+		wkt      string
+		expected geom.Coord
+	}{
+		{name: "Point", wkt: "POINT(1 2)", expected: geom.Coord{1, 2}},
+		{name: "Point Z", wkt: "POINT Z (1 2 3)", expected: geom.Coord{1, 2}},
+		{name: "Line", wkt: "LINESTRING(3 4, 5 6)", expected: geom.Coord{3, 4}},
+		{name: "Collection", wkt: "GEOMETRYCOLLECTION(LINESTRING(3 4, 5 6), POINT(1 2))", expected: geom.Coord{3, 4}},
+		{name: "Collection starting empty", wkt: "GEOMETRYCOLLECTION(POINT EMPTY, GEOMETRYCOLLECTION(POINT(1 2)))", expected: geom.Coord{1, 2}},
+		{name: "Empty", wkt: "POINT EMPTY"},
+		{name: "Empty collection", wkt: "GEOMETRYCOLLECTION EMPTY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := wkt.Unmarshal(tt.wkt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			coord, ok := firstCoord(g)
+			if ok != (tt.expected != nil) || !slices.Equal(coord, tt.expected) {
+				t.Errorf("got %v, %v, want %v", coord, ok, tt.expected)
+			}
+		})
+	}
+}
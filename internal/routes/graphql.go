@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/graph"
+)
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// HandleGraphQL executes a GraphQL query, given either as a JSON body (POST)
+// or as query, operationName and variables parameters (GET). As per the
+// GraphQL over HTTP conventions, errors resolving fields are returned in the
+// response alongside any data, with a 200 status.
+func HandleGraphQL(schema *graphql.Schema, repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req graphQLRequest
+		if c.Request.Method == http.MethodGet {
+			req.Query = c.Query("query")
+			req.OperationName = c.Query("operationName")
+			if variables := c.Query("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "variables must be a JSON object"})
+					return
+				}
+			}
+		} else if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
+
+		if req.Query == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+			return
+		}
+
+		ctx := graph.WithLoaders(c.Request.Context(), repo)
+		response := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		response.Extensions = map[string]any{"attribution": internal.ATTRIBUTION}
+		c.JSON(http.StatusOK, response)
+	}
+}
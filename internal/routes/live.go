@@ -0,0 +1,270 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	pingInterval = 30 * time.Second
+	pongWait     = 2 * pingInterval
+	writeWait    = 10 * time.Second
+)
+
+// newUpgrader accepts connections only from the allowed origins or, if there
+// are none, from any origin, as for CORS. That is safe because the API key has
+// to be sent explicitly rather than as a cookie, so a page on another origin
+// can't open a connection with a visitor's credentials. Clients other than
+// browsers don't send an origin, and are always accepted.
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return len(allowedOrigins) == 0 || origin == "" || slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+				return strings.EqualFold(allowed, origin)
+			})
+		},
+	}
+}
+
+// SubscribeMessage is sent by the client to (re)define what it is watching,
+// e.g. whenever the map is panned. Facet values follow the same conventions
+// as the search parameters, including '!' exclusions and '*' wildcards.
+type SubscribeMessage struct {
+	Type          string              `json:"type"`
+	BBox          string              `json:"bbox"`
+	Facets        map[string][]string `json:"facets,omitempty"`
+	MaxDaysAhead  *int                `json:"max_days_ahead,omitempty"`
+	MaxDaysBehind *int                `json:"max_days_behind,omitempty"`
+}
+
+// LiveMessage is sent by the server: "add" when an object comes into view,
+// "update" when an object in view changes, "remove" when it leaves the view,
+// "subscribed" once the view has been brought up-to-date after subscribing,
+// and "error" when a subscription is rejected.
+type LiveMessage struct {
+	Type            string         `json:"type"`
+	ObjectReference string         `json:"object_reference,omitempty"`
+	Event           *EnrichedEvent `json:"event,omitempty"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// liveView tracks which objects a client has been sent, so that only the
+// differences need to be sent as the subscription or the objects change.
+type liveView struct {
+	bbox            *models.BBox
+	facets          *models.Facets
+	temporalFilters *models.TemporalFilters
+	visible         map[string]bool
+}
+
+func (view *liveView) includes(event *models.Event) bool {
+	return view.bbox != nil &&
+		matchesStream(event, view.bbox, view.facets) &&
+		view.temporalFilters.Includes(event, time.Now())
+}
+
+// HandleLive upgrades to a WebSocket over which clients subscribe to a
+// bounding box and facets, and are then sent incremental changes to the
+// objects within it, both as they are received and as the subscription changes.
+func HandleLive(repo *internal.DbRepository, broker *stream.Broker, organisations promoter.Organisations, allowedOrigins []string) gin.HandlerFunc {
+	upgrader := newUpgrader(allowedOrigins)
+	return func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has already responded
+			_ = c.Error(errors.Wrap(err, "error upgrading to websocket"))
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				log.Printf("Error closing websocket: %v", err)
+			}
+		}()
+
+		sub := broker.Subscribe()
+		defer sub.Close()
+
+		subscriptions := make(chan *SubscribeMessage)
+		done := make(chan struct{})
+		stop := make(chan struct{})
+		defer close(stop)
+		go readSubscriptions(conn, subscriptions, done, stop)
+
+		view := &liveView{visible: make(map[string]bool)}
+		ping := time.NewTicker(pingInterval)
+		defer ping.Stop()
+
+		for {
+			var err error
+			select {
+			case <-done:
+				return
+
+			case msg := <-subscriptions:
+				err = resubscribe(conn, repo, organisations, view, msg)
+
+			case change, ok := <-sub.C:
+				if !ok {
+					// Dropped for falling behind: the client should reconnect and resubscribe
+					_ = conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"),
+						time.Now().Add(writeWait))
+					return
+				}
+				err = applyChange(conn, organisations, view, change.Event)
+
+			case <-ping.C:
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			}
+
+			if err != nil {
+				if !errors.Is(err, websocket.ErrCloseSent) {
+					log.Printf("Error writing to websocket: %v", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// readSubscriptions reads messages from the client until the connection is
+// closed, or the client stops responding to pings.
+func readSubscriptions(conn *websocket.Conn, subscriptions chan<- *SubscribeMessage, done chan<- struct{}, stop <-chan struct{}) {
+	defer close(done)
+
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg SubscribeMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				msg = SubscribeMessage{Type: "invalid"}
+			} else {
+				return
+			}
+		}
+
+		select {
+		case subscriptions <- &msg:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func bindSubscription(msg *SubscribeMessage) (*liveView, error) {
+	if msg.Type != "subscribe" {
+		return nil, errors.New("message type must be one of: subscribe")
+	}
+
+	bbox, err := models.BoundingBoxFromCSV(msg.BBox)
+	if err != nil {
+		return nil, err
+	}
+
+	facets, err := models.FacetsFromMap(msg.Facets)
+	if err != nil {
+		return nil, err
+	}
+
+	temporalFilters := &models.TemporalFilters{MaxDaysAhead: 7, MaxDaysBehind: 0}
+	if msg.MaxDaysAhead != nil {
+		temporalFilters.MaxDaysAhead = *msg.MaxDaysAhead
+	}
+	if msg.MaxDaysBehind != nil {
+		temporalFilters.MaxDaysBehind = *msg.MaxDaysBehind
+	}
+	for _, days := range []int{temporalFilters.MaxDaysAhead, temporalFilters.MaxDaysBehind} {
+		if days < 0 || days > models.MaxWindowDays {
+			return nil, errors.Newf("max_days_ahead and max_days_behind must be between 0 and %d", models.MaxWindowDays)
+		}
+	}
+
+	return &liveView{bbox: bbox, facets: &facets, temporalFilters: temporalFilters}, nil
+}
+
+// resubscribe searches for the objects in the new view, and sends the
+// differences from what the client was previously sent.
+func resubscribe(conn *websocket.Conn, repo *internal.DbRepository, organisations promoter.Organisations, view *liveView, msg *SubscribeMessage) error {
+	next, err := bindSubscription(msg)
+	if err != nil {
+		return writeLive(conn, &LiveMessage{Type: "error", Error: err.Error()})
+	}
+
+	events, err := repo.Search(next.bbox, "", next.facets, next.temporalFilters)
+	if err != nil {
+		log.Printf("Error searching for live subscription: %v", err)
+		return writeLive(conn, &LiveMessage{Type: "error", Error: "Failed to search events"})
+	}
+
+	next.visible = make(map[string]bool, len(events))
+	for _, event := range enrich(organisations, events) {
+		next.visible[event.ObjectReference] = true
+		if !view.visible[event.ObjectReference] {
+			if err := writeLive(conn, &LiveMessage{Type: "add", ObjectReference: event.ObjectReference, Event: event}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for objectReference := range view.visible {
+		if !next.visible[objectReference] {
+			if err := writeLive(conn, &LiveMessage{Type: "remove", ObjectReference: objectReference}); err != nil {
+				return err
+			}
+		}
+	}
+
+	*view = *next
+	return writeLive(conn, &LiveMessage{Type: "subscribed"})
+}
+
+// applyChange sends a change to an object, if it affects the client's view.
+func applyChange(conn *websocket.Conn, organisations promoter.Organisations, view *liveView, event *models.Event) error {
+	objectReference := event.ObjectReference
+	wasVisible := view.visible[objectReference]
+
+	if !view.includes(event) {
+		if !wasVisible {
+			return nil
+		}
+		delete(view.visible, objectReference)
+		return writeLive(conn, &LiveMessage{Type: "remove", ObjectReference: objectReference})
+	}
+
+	msgType := "add"
+	if wasVisible {
+		msgType = "update"
+	}
+	view.visible[objectReference] = true
+	return writeLive(conn, &LiveMessage{
+		Type:            msgType,
+		ObjectReference: objectReference,
+		Event:           enrich(organisations, []*models.Event{event})[0],
+	})
+}
+
+func writeLive(conn *websocket.Conn, msg *LiveMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(msg)
+}
@@ -0,0 +1,82 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestHandleLive(t *testing.T) {
+	startsAt, endsAt := time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	event := func(ref string, coords string) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, EventType: "WORK_START", PromoterSWACode: ptr("7001"),
+			WorksLocationCoordinates: ptr(coords), ProposedStartDate: &startsAt, ProposedEndDate: &endsAt,
+		}
+	}
+	deps := newTestDependencies(t, event("OBJ-A", "POINT(530100 180100)"), event("OBJ-B", "POINT(400000 300000)"))
+	deps.AllowedOrigins = []string{"https://maps.example.com"}
+	server := httptest.NewServer(newTestRouterWith(t, deps))
+	t.Cleanup(server.Close)
+	liveURL := "ws" + strings.TrimPrefix(server.URL, "http") + BasePath + "/live"
+
+	t.Run("Disallowed origin", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(liveURL, http.Header{"Origin": {"https://elsewhere.example.com"}})
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected the handshake to be forbidden, got %v, %v", resp, err)
+		}
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(liveURL, http.Header{"Origin": {"https://maps.example.com"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	send := func(msg *SubscribeMessage) {
+		t.Helper()
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	expect := func(expected ...string) {
+		t.Helper()
+		for _, want := range expected {
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var msg LiveMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.TrimSuffix(msg.Type+" "+msg.ObjectReference, " "); got != want {
+				t.Fatalf("got %q (%s), want %q", got, msg.Error, want)
+			}
+		}
+	}
+
+	send(&SubscribeMessage{Type: "subscribe", BBox: "530000,180000,531000,181000"})
+	expect("add OBJ-A", "subscribed")
+
+	send(&SubscribeMessage{Type: "subscribe", BBox: "530000,180000,531000,181000", MaxDaysAhead: ptr(models.MaxWindowDays + 1)})
+	expect("error")
+
+	// The rejected subscription leaves the previous one in effect
+	moved := event("OBJ-B", "POINT(530200 180200)")
+	deps.Broker.Publish(&models.Change{ID: 10, Kind: models.ChangeUpdated, Event: moved})
+	expect("add OBJ-B")
+	deps.Broker.Publish(&models.Change{ID: 11, Kind: models.ChangeUpdated, Event: moved})
+	expect("update OBJ-B")
+	deps.Broker.Publish(&models.Change{ID: 12, Kind: models.ChangeUpdated, Event: event("OBJ-C", "POINT(400000 300000)")})
+	deps.Broker.Publish(&models.Change{ID: 13, Kind: models.ChangeUpdated, Event: event("OBJ-A", "POINT(400000 300000)")})
+	expect("remove OBJ-A")
+
+	// Only OBJ-A is in view in the database
+	send(&SubscribeMessage{Type: "subscribe", BBox: "530000,180000,530150,180150"})
+	expect("add OBJ-A", "remove OBJ-B", "subscribed")
+}
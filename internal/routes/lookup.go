@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	lookupLimitDefault = 100
+	lookupLimitMax     = 1000
+)
+
+// bindLookupPage binds the limit and offset of a street or promoter lookup,
+// which are always paged, by default to the first lookupLimitDefault events.
+func bindLookupPage(c *gin.Context) (*page, error) {
+	p, err := bindPage(c)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &page{}
+	}
+	if p.limit == 0 {
+		p.limit = lookupLimitDefault
+	}
+	if p.limit > lookupLimitMax {
+		return nil, errors.Newf("limit must be at most %d", lookupLimitMax)
+	}
+	return p, nil
+}
+
+func HandleObjectLookup(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event, err := repo.FindByObjectReference(c.Param("object_reference"))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up object"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up object"})
+			return
+		}
+
+		if event == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Object not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"result":      enrich(organisations, []*models.Event{event})[0],
+			"attribution": internal.ATTRIBUTION,
+		})
+	}
+}
+
+func HandleWorkLookup(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, err := repo.FindByWorkReference(c.Param("work_reference_number"))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up work"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up work"})
+			return
+		}
+
+		works, _ := models.GroupByWork(events)
+		if len(works) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Work not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"result":      enrichWorks(organisations, works)[0],
+			"attribution": internal.ATTRIBUTION,
+		})
+	}
+}
+
+func HandleStreetLookup(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		temporalFilters, err := bindTemporalFilters(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := bindLookupPage(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, total, err := repo.FindByUSRN(c.Param("usrn"), temporalFilters, page.limit, page.offset)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up street"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up street"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results":     enrich(organisations, events),
+			"total":       total,
+			"attribution": internal.ATTRIBUTION,
+		})
+	}
+}
+
+func HandlePromoterEvents(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		temporalFilters, err := bindTemporalFilters(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := bindLookupPage(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, total, err := repo.FindByPromoter(c.Param("swa_code"), temporalFilters, page.limit, page.offset)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up promoter events"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up promoter events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results":     enrich(organisations, events),
+			"total":       total,
+			"attribution": internal.ATTRIBUTION,
+		})
+	}
+}
@@ -0,0 +1,102 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestLookups(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	event := func(ref string, work string, usrn string, swaCode string, eventTime time.Time) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, PermitReferenceNumber: ptr(ref), EventType: "PERMIT_GRANTED", EventTime: &eventTime,
+			WorkReferenceNumber: ptr(work), USRN: ptr(usrn), PromoterSWACode: ptr(swaCode),
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		}
+	}
+	r := newTestRouter(t,
+		event("W1-01", "W1", "1001", "7001", start),
+		event("W1-02", "W1", "1001", "7001", start.Add(time.Minute)),
+		event("W2-01", "W2", "1001", "7002", start.Add(2*time.Minute)),
+		event("W3-01", "W3", "1002", "7001", start.Add(3*time.Minute)),
+	)
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		refs   []string
+		total  int
+		error  string
+	}{
+		{name: "Object", path: "/objects/W1-02", status: http.StatusOK, refs: []string{"W1-02"}},
+		{name: "Unknown object", path: "/objects/W9-01", status: http.StatusNotFound, error: "Object not found"},
+		{name: "Work", path: "/works/W1", status: http.StatusOK, refs: []string{"W1-01", "W1-02"}},
+		{name: "Unknown work", path: "/works/W9", status: http.StatusNotFound, error: "Work not found"},
+		{name: "Street", path: "/streets/1001", status: http.StatusOK, refs: []string{"W2-01", "W1-02", "W1-01"}, total: 3},
+		{name: "Street page", path: "/streets/1001?limit=2&offset=1", status: http.StatusOK, refs: []string{"W1-02", "W1-01"}, total: 3},
+		{name: "Street beyond the last page", path: "/streets/1001?offset=3", status: http.StatusOK, refs: []string{}, total: 3},
+		{name: "Unknown street", path: "/streets/9999", status: http.StatusOK, refs: []string{}, total: 0},
+		{name: "Promoter", path: "/promoters/7001/events", status: http.StatusOK, refs: []string{"W3-01", "W1-02", "W1-01"}, total: 3},
+		{name: "Promoter page", path: "/promoters/7001/events?limit=1", status: http.StatusOK, refs: []string{"W3-01"}, total: 3},
+		{name: "Past window", path: "/promoters/7001/events?as_at=2020-01-01T00:00:00Z", status: http.StatusOK, refs: []string{}, total: 0},
+		{name: "Limit too large", path: "/streets/1001?limit=1001", status: http.StatusBadRequest, error: "limit must be at most 1000"},
+		{name: "Invalid offset", path: "/promoters/7001/events?offset=-1", status: http.StatusBadRequest, error: "offset must be a non-negative integer"},
+		{name: "Window too wide", path: "/streets/1001?max_days_behind=10000", status: http.StatusBadRequest, error: "max_days_behind must be between 0 and 366"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(r, tt.path)
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.error != "" {
+				if !strings.Contains(w.Body.String(), tt.error) {
+					t.Errorf("got %s, want error %q", w.Body, tt.error)
+				}
+				return
+			}
+
+			var response struct {
+				Result *struct {
+					PermitReferenceNumber *string         `json:"permit_reference_number"`
+					Permits               []*models.Event `json:"permits"`
+				} `json:"result"`
+				Results []*models.Event `json:"results"`
+				Total   int             `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// As for an object, a work or a list of events
+			events := response.Results
+			if response.Result != nil {
+				events = response.Result.Permits
+				if events == nil {
+					events = []*models.Event{{PermitReferenceNumber: response.Result.PermitReferenceNumber}}
+				}
+			}
+			refs := make([]string, 0, len(events))
+			for _, event := range events {
+				refs = append(refs, *event.PermitReferenceNumber)
+			}
+			if !slices.Equal(refs, tt.refs) {
+				t.Errorf("got %v, want %v", refs, tt.refs)
+			}
+			if response.Total != tt.total {
+				t.Errorf("got total %d, want %d", response.Total, tt.total)
+			}
+		})
+	}
+}
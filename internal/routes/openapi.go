@@ -0,0 +1,409 @@
+package routes
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/apikey"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
+	"github.com/rm-hull/street-manager-relay/models"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+const (
+	openAPIVersion = "3.1.0"
+	apiVersion     = "1.0.0"
+)
+
+// openAPIParam is a query or header parameter read by a handler.
+type openAPIParam struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      gin.H
+}
+
+// openAPIOperation documents a route. Handler is the name of the function
+// that creates its handler, whose parameters are checked against Params by
+// the tests. Public routes need no API key.
+type openAPIOperation struct {
+	Method      string
+	Path        string
+	Handler     string
+	OperationID string
+	Summary     string
+	Description string
+	Public      bool
+	Params      []openAPIParam
+	RequestBody gin.H
+	Responses   gin.H
+}
+
+var stringSchema = gin.H{"type": "string"}
+
+func queryParam(name string, description string, schema gin.H) openAPIParam {
+	return openAPIParam{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func enumSchema(values ...string) gin.H {
+	return gin.H{"type": "string", "enum": values}
+}
+
+// searchCriteriaParams are the parameters bound by bindSearchCriteria, with
+// a parameter (and its __not form) for each facet in the registry.
+func searchCriteriaParams() []openAPIParam {
+	params := []openAPIParam{
+		queryParam("bbox", "A bounding box in British National Grid, as `minX,minY,maxX,maxY`. Required unless `q` is given.", stringSchema),
+		queryParam("q", "Free text matched against the street, area, town, location description, permit conditions, references and USRN. Every word must match, and the last word is matched as a prefix.", stringSchema),
+	}
+
+	values := gin.H{"type": "array", "items": stringSchema}
+	for _, facet := range models.FacetRegistry {
+		params = append(params,
+			queryParam(facet.Param, "Events with any of these values, given repeated or comma-separated. Values may use `*` as a wildcard, or be prefixed with `!` to exclude them.", values),
+			queryParam(facet.Param+"__not", "Events without any of these values.", values),
+		)
+	}
+
+	days := gin.H{"type": "integer", "minimum": 0, "maximum": models.MaxWindowDays}
+	return append(params,
+		queryParam("max_days_ahead", "Events active within this many days from now (default 7).", days),
+		queryParam("max_days_behind", "Events active within this many days before now (default 0).", days),
+		queryParam("as_at", "Each object's state as known at this instant, with the day windows relative to it.", gin.H{"type": "string", "format": "date-time"}),
+	)
+}
+
+func jsonContent(schema gin.H) gin.H {
+	return gin.H{"application/json": gin.H{"schema": schema}}
+}
+
+func errorResponse(description string) gin.H {
+	return gin.H{"description": description, "content": jsonContent(gin.H{"$ref": "#/components/schemas/Error"})}
+}
+
+func arrayOf(schema gin.H) gin.H {
+	return gin.H{"type": "array", "items": schema}
+}
+
+func openAPIOperations(schemas *schemaRegistry) []*openAPIOperation {
+	attribution := arrayOf(stringSchema)
+	refData := schemas.ref(reflect.TypeFor[models.RefData]())
+
+	return []*openAPIOperation{
+		{
+			Method:      http.MethodGet,
+			Path:        BasePath + "/search",
+			Handler:     "HandleSearch",
+			OperationID: "search",
+			Summary:     "Search for events",
+			Description: "Events within a bounding box and/or matching text, filtered by facets and active within a window of days. Other formats are streamed as an attachment.",
+			Params: append(searchCriteriaParams(),
+				queryParam("group_by", "Set to `work` to group permits into `works`, and other events by street into `streets`.", enumSchema("work")),
+				queryParam("facet_counts", "Set to `true` to include counts of each facet value over the matching events.", enumSchema("true", "false")),
+				queryParam("labels", "Set to `true` to include the label of each facet value in each result.", enumSchema("true", "false")),
+				queryParam("limit", "The number of results in a page, ordered by object reference. Not supported with `group_by` or other formats.", gin.H{"type": "integer", "minimum": 1}),
+				queryParam("offset", "The number of results to skip, ordered by object reference.", gin.H{"type": "integer", "minimum": 0}),
+				queryParam("format", "The format of the results (default `json`).", enumSchema("json", "csv", "xlsx", "kml", "gpx")),
+				queryParam("columns", "With `format=csv` or `xlsx`, the columns to include, in order.", arrayOf(stringSchema)),
+			),
+			Responses: gin.H{
+				"200": gin.H{
+					"description": "The matching events",
+					"content": gin.H{
+						"application/json": gin.H{"schema": gin.H{
+							"type": "object",
+							"properties": gin.H{
+								"results":     arrayOf(schemas.ref(reflect.TypeFor[EnrichedEvent]())),
+								"works":       arrayOf(schemas.ref(reflect.TypeFor[EnrichedWork]())),
+								"streets":     arrayOf(schemas.ref(reflect.TypeFor[models.Street]())),
+								"facets":      refData,
+								"total":       gin.H{"type": "integer", "description": "The number of matching events, when paged"},
+								"attribution": attribution,
+							},
+							"required": []string{"attribution"},
+						}},
+						"text/csv": gin.H{"schema": stringSchema},
+						"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": gin.H{"schema": gin.H{"type": "string", "contentEncoding": "binary"}},
+						"application/vnd.google-earth.kml+xml":                              gin.H{"schema": stringSchema},
+						"application/gpx+xml":                                               gin.H{"schema": stringSchema},
+					},
+				},
+				"400": errorResponse("Invalid parameters"),
+				"500": errorResponse("The search failed"),
+			},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        BasePath + "/refdata",
+			Handler:     "HandleRefData",
+			OperationID: "refData",
+			Summary:     "Counts of each facet value",
+			Description: "Counts of each facet value over all events, or, given a `bbox` or `q`, over the events matching the same parameters as a search.",
+			Params: append(searchCriteriaParams(),
+				queryParam("labels", "Set to `true` to include the label and description of every code.", enumSchema("true", "false")),
+			),
+			Responses: gin.H{
+				"200": gin.H{
+					"description": "The counts of each facet value",
+					"content": jsonContent(gin.H{
+						"type": "object",
+						"properties": gin.H{
+							"refdata":     refData,
+							"labels":      schemas.ref(reflect.TypeFor[codelist.Catalogue]()),
+							"attribution": attribution,
+						},
+						"required": []string{"refdata", "attribution"},
+					}),
+				},
+				"400": errorResponse("Invalid parameters"),
+				"500": errorResponse("The counts could not be fetched"),
+			},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        BasePath + "/sns",
+			Handler:     "HandleSNSMessage",
+			OperationID: "snsMessage",
+			Summary:     "Receive an SNS message",
+			Description: "Receives the subscription confirmations and event notifications published by Street Manager through Amazon SNS, whose signatures are verified.",
+			Public:      true,
+			Params: []openAPIParam{
+				{Name: "x-amz-sns-message-type", In: "header", Required: true, Description: "The type of the message.", Schema: enumSchema("SubscriptionConfirmation", "Notification", "UnsubscribeConfirmation")},
+			},
+			RequestBody: gin.H{
+				"required": true,
+				"content": gin.H{
+					"application/json": gin.H{"schema": schemas.ref(reflect.TypeFor[internal.SNSMessage]())},
+					"text/plain":       gin.H{"schema": schemas.ref(reflect.TypeFor[internal.SNSMessage]())},
+				},
+			},
+			Responses: gin.H{
+				"200": gin.H{
+					"description": "The message was handled",
+					"content":     jsonContent(gin.H{"type": "object", "properties": gin.H{"status": enumSchema("success")}}),
+				},
+				"400": errorResponse("The message is missing or malformed"),
+				"401": errorResponse("The message signature is not valid"),
+				"500": errorResponse("The message could not be handled"),
+			},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/healthz",
+			OperationID: "health",
+			Summary:     "Health check",
+			Description: "Whether the database is available.",
+			Public:      true,
+			Responses: gin.H{
+				"200": gin.H{"description": "Healthy", "content": jsonContent(arrayOf(gin.H{"$ref": "#/components/schemas/CheckStatus"}))},
+				"503": gin.H{"description": "Unhealthy", "content": jsonContent(arrayOf(gin.H{"$ref": "#/components/schemas/CheckStatus"}))},
+			},
+		},
+	}
+}
+
+// openAPIDocument builds the OpenAPI document, with the schemas of the
+// responses reflected from the types the handlers return.
+func openAPIDocument() gin.H {
+	schemas := newSchemaRegistry()
+	schemas.schemas["Error"] = gin.H{
+		"type":       "object",
+		"properties": gin.H{"error": stringSchema},
+		"required":   []string{"error"},
+	}
+	schemas.schemas["CheckStatus"] = gin.H{
+		"type":       "object",
+		"properties": gin.H{"name": stringSchema, "pass": gin.H{"type": "boolean"}},
+		"required":   []string{"name", "pass"},
+	}
+
+	paths := gin.H{}
+	for _, op := range openAPIOperations(schemas) {
+		params := make([]gin.H, 0, len(op.Params))
+		for _, param := range op.Params {
+			p := gin.H{"name": param.Name, "in": param.In, "description": param.Description, "schema": param.Schema}
+			if param.Required {
+				p["required"] = true
+			}
+			if param.Schema["type"] == "array" {
+				p["style"], p["explode"] = "form", true
+			}
+			params = append(params, p)
+		}
+
+		operation := gin.H{
+			"operationId": op.OperationID,
+			"summary":     op.Summary,
+			"description": op.Description,
+			"parameters":  params,
+			"responses":   op.Responses,
+		}
+		if op.RequestBody != nil {
+			operation["requestBody"] = op.RequestBody
+		}
+		if op.Public {
+			operation["security"] = []gin.H{}
+		} else {
+			op.Responses["401"] = errorResponse("The API key is missing or not valid")
+			op.Responses["429"] = gin.H{
+				"description": "The API key's rate limit is exceeded",
+				"headers":     gin.H{"Retry-After": gin.H{"description": "Seconds until a request is allowed", "schema": gin.H{"type": "integer"}}},
+				"content":     jsonContent(gin.H{"$ref": "#/components/schemas/Error"}),
+			}
+		}
+
+		item, ok := paths[op.Path].(gin.H)
+		if !ok {
+			item = gin.H{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return gin.H{
+		"openapi": openAPIVersion,
+		"info": gin.H{
+			"title":       "Street Manager Relay",
+			"version":     apiVersion,
+			"description": "Street works from the GOV.UK Street Manager open data feed. " + strings.Join(internal.ATTRIBUTION, " "),
+			"license":     gin.H{"name": "MIT", "identifier": "MIT"},
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": schemas.schemas,
+			"securitySchemes": gin.H{
+				"apiKeyHeader": gin.H{"type": "apiKey", "in": "header", "name": apikey.Header},
+				"apiKeyQuery":  gin.H{"type": "apiKey", "in": "query", "name": apikey.QueryParam},
+				"bearer":       gin.H{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []gin.H{{"apiKeyHeader": []string{}}, {"apiKeyQuery": []string{}}, {"bearer": []string{}}},
+	}
+}
+
+// HandleOpenAPI serves the OpenAPI document, which is built once.
+func HandleOpenAPI() gin.HandlerFunc {
+	document := sync.OnceValue(openAPIDocument)
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, document())
+	}
+}
+
+// HandleSwaggerUI serves the bundled Swagger UI (from a *filepath route),
+// configured to load the document at specURL.
+func HandleSwaggerUI(specURL string) gin.HandlerFunc {
+	initializer := `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "` + specURL + `",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+	files := http.FS(swaggerFiles.FS)
+	return func(c *gin.Context) {
+		if c.Param("filepath") == "/swagger-initializer.js" {
+			c.Data(http.StatusOK, "text/javascript; charset=utf-8", []byte(initializer))
+			return
+		}
+		c.FileFromFS(c.Param("filepath"), files)
+	}
+}
+
+// schemaRegistry reflects JSON schemas from Go types, as per how they are
+// encoded, adding each named struct to the components.
+type schemaRegistry struct {
+	schemas gin.H
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: gin.H{}}
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func (registry *schemaRegistry) ref(t reflect.Type) gin.H {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return gin.H{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := registry.schemas[t.Name()]; !ok {
+			// Registered before the properties, for recursive types
+			registry.schemas[t.Name()] = gin.H{}
+			registry.schemas[t.Name()] = registry.object(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Slice:
+		return arrayOf(registry.ref(t.Elem()))
+	case t.Kind() == reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": registry.ref(t.Elem())}
+	case t.Kind() == reflect.String:
+		return gin.H{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return gin.H{"type": "number"}
+	default:
+		return gin.H{}
+	}
+}
+
+// object is the schema of a struct, where embedded structs are flattened and
+// fields are required unless omitempty. Pointers, slices and maps without
+// omitempty may be null.
+func (registry *schemaRegistry) object(t reflect.Type) gin.H {
+	properties := gin.H{}
+	required := make([]string, 0)
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag, hasTag := field.Tag.Lookup("json")
+			name, options, _ := strings.Cut(tag, ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+
+			if field.Anonymous && !hasTag {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				addFields(embedded)
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+			schema := registry.ref(field.Type)
+			omitEmpty := strings.Contains(options, "omitempty")
+			if kind := field.Type.Kind(); !omitEmpty && (kind == reflect.Pointer || kind == reflect.Slice || kind == reflect.Map) {
+				schema = gin.H{"anyOf": []gin.H{schema, {"type": "null"}}}
+			}
+			properties[name] = schema
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	return gin.H{"type": "object", "properties": properties, "required": required}
+}
@@ -0,0 +1,245 @@
+package routes
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// paramReaders are the gin.Context methods that read a parameter, and where
+// it is read from.
+var paramReaders = map[string]string{
+	"Query":        "query",
+	"DefaultQuery": "query",
+	"QueryArray":   "query",
+	"GetQuery":     "query",
+	"GetHeader":    "header",
+}
+
+// handlerParams finds the parameters read by the named function and the
+// functions of the package it calls, as "in:name".
+func handlerParams(t *testing.T, funcs map[string]*ast.FuncDecl, name string) []string {
+	t.Helper()
+
+	params := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		decl, ok := funcs[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+
+		// Keys of map literals ranged over, e.g. in bindTemporalFilters
+		literals := make(map[string]*ast.CompositeLit)
+		rangedKeys := make(map[string][]string)
+
+		ast.Inspect(decl.Body, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.AssignStmt:
+				for idx, rhs := range node.Rhs {
+					if lit, ok := rhs.(*ast.CompositeLit); ok && idx < len(node.Lhs) {
+						if ident, ok := node.Lhs[idx].(*ast.Ident); ok {
+							literals[ident.Name] = lit
+						}
+					}
+				}
+			case *ast.RangeStmt:
+				key, _ := node.Key.(*ast.Ident)
+				x, _ := node.X.(*ast.Ident)
+				if key != nil && x != nil && literals[x.Name] != nil {
+					for _, elt := range literals[x.Name].Elts {
+						if kv, ok := elt.(*ast.KeyValueExpr); ok {
+							if lit, ok := kv.Key.(*ast.BasicLit); ok {
+								value, _ := strconv.Unquote(lit.Value)
+								rangedKeys[key.Name] = append(rangedKeys[key.Name], value)
+							}
+						}
+					}
+				}
+			case *ast.CallExpr:
+				switch fun := node.Fun.(type) {
+				case *ast.Ident:
+					visit(fun.Name)
+				case *ast.SelectorExpr:
+					in, ok := paramReaders[fun.Sel.Name]
+					if !ok || len(node.Args) == 0 {
+						return true
+					}
+					if x, ok := fun.X.(*ast.Ident); !ok || x.Name != "c" {
+						return true
+					}
+
+					switch arg := node.Args[0].(type) {
+					case *ast.BasicLit:
+						value, _ := strconv.Unquote(arg.Value)
+						params[in+":"+value] = true
+						return true
+					case *ast.Ident:
+						if keys, ok := rangedKeys[arg.Name]; ok {
+							for _, key := range keys {
+								params[in+":"+key] = true
+							}
+							return true
+						}
+					}
+
+					// Facet parameters, as read by bindFacets
+					switch types.ExprString(node.Args[0]) {
+					case "facet.Param":
+						for _, facet := range models.FacetRegistry {
+							params[in+":"+facet.Param] = true
+						}
+					case `facet.Param + "__not"`:
+						for _, facet := range models.FacetRegistry {
+							params[in+":"+facet.Param+"__not"] = true
+						}
+					default:
+						t.Errorf("%s: cannot resolve parameter %s", name, types.ExprString(node.Args[0]))
+					}
+				}
+			}
+			return true
+		})
+	}
+	visit(name)
+
+	return slices.Sorted(maps.Keys(params))
+}
+
+func TestOpenAPIParamsMatchHandlers(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, file := range pkgs["routes"].Files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+
+	for _, op := range openAPIOperations(newSchemaRegistry()) {
+		if op.Handler == "" {
+			continue
+		}
+		t.Run(op.OperationID, func(t *testing.T) {
+			if _, ok := funcs[op.Handler]; !ok {
+				t.Fatalf("no handler %s", op.Handler)
+			}
+
+			documented := make([]string, 0, len(op.Params))
+			for _, param := range op.Params {
+				documented = append(documented, param.In+":"+param.Name)
+			}
+			slices.Sort(documented)
+
+			read := handlerParams(t, funcs, op.Handler)
+			for _, param := range read {
+				if !slices.Contains(documented, param) {
+					t.Errorf("%s reads %s, which is not in the spec", op.Handler, param)
+				}
+			}
+			for _, param := range documented {
+				if !slices.Contains(read, param) {
+					t.Errorf("spec has %s, which %s does not read", param, op.Handler)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPISchemasMatchResponses(t *testing.T) {
+	data, err := json.Marshal(openAPIDocument())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource("openapi.json", doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startsAt := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		schema string
+		value  any
+	}{
+		{
+			name:   "Sparse event",
+			schema: "EnrichedEvent",
+			value:  &EnrichedEvent{Event: &models.Event{ObjectReference: "ABC-1", EventType: "WORK_START"}},
+		},
+		{
+			name:   "Enriched event",
+			schema: "EnrichedEvent",
+			value: &EnrichedEvent{
+				Event: &models.Event{
+					ObjectReference:      "ABC-1",
+					EventType:            "WORK_START",
+					USRN:                 ptr("12345678"),
+					ProposedStartDate:    &startsAt,
+					PermitConditionCodes: []string{"NCT01A"},
+				},
+				PromoterWebsiteURL: ptr("https://water.example.com"),
+				Labels:             map[string]string{"work_category": "Standard"},
+			},
+		},
+		{
+			name:   "Street",
+			schema: "Street",
+			value:  &models.Street{USRN: "12345678", StreetName: ptr("HIGH STREET")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := compiler.Compile("openapi.json#/components/schemas/" + tt.schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			instance, err := jsonschema.UnmarshalJSON(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := schema.Validate(instance); err != nil {
+				t.Errorf("%s does not conform: %v", data, err)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// baseURL is the scheme and host the request was made to or, from a trusted
+// proxy, that it was forwarded for (see forwardedHeaders).
+func baseURL(c *gin.Context) string {
+	scheme := c.Request.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// forwardedHeaders applies the X-Forwarded-Proto and X-Forwarded-Host headers
+// set by the trusted proxies (IP addresses or CIDR ranges), so that links in
+// responses point back through the proxy. From anywhere else they are ignored,
+// as a client could otherwise point the links at a host of its choosing.
+func forwardedHeaders(trustedProxies []string) (gin.HandlerFunc, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, errors.Wrapf(err, "invalid trusted proxy '%s'", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(c *gin.Context) {
+		addr, err := netip.ParseAddr(c.RemoteIP())
+		if err == nil && slices.ContainsFunc(prefixes, func(prefix netip.Prefix) bool { return prefix.Contains(addr.Unmap()) }) {
+			if proto := firstForwarded(c, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+				c.Request.URL.Scheme = proto
+			}
+			if host := firstForwarded(c, "X-Forwarded-Host"); host != "" {
+				c.Request.Host = host
+			}
+		}
+		c.Next()
+	}, nil
+}
+
+// firstForwarded is the first value of a forwarded header: each proxy appends
+// to the list, so the first is what the client used.
+func firstForwarded(c *gin.Context, header string) string {
+	value, _, _ := strings.Cut(c.GetHeader(header), ",")
+	return strings.TrimSpace(value)
+}
@@ -2,15 +2,23 @@ package routes
 
 import (
 	"log"
+	"net/http"
 
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/kofalt/go-memoize"
 	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
 	"github.com/rm-hull/street-manager-relay/models"
 )
 
-func HandleRefData(repo *internal.DbRepository, cache *memoize.Memoizer) gin.HandlerFunc {
+func HandleRefData(repo *internal.DbRepository, cache *memoize.Memoizer, catalogue codelist.Catalogue) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Counts scoped to a search are too varied to be worth caching
+		if c.Query("bbox") != "" || c.Query("q") != "" {
+			handleScopedRefData(c, repo, catalogue)
+			return
+		}
 
 		refData, err, _ := memoize.Call(cache, "refdata", func() (*models.RefData, error) {
 			return repo.RefData()
@@ -21,9 +29,34 @@ func HandleRefData(repo *internal.DbRepository, cache *memoize.Memoizer) gin.Han
 			return
 		}
 
-		c.JSON(200, gin.H{
-			"refdata":     refData,
-			"attribution": internal.ATTRIBUTION,
-		})
+		c.JSON(200, refDataResponse(c, refData, catalogue))
+	}
+}
+
+func handleScopedRefData(c *gin.Context, repo *internal.DbRepository, catalogue codelist.Catalogue) {
+	criteria, err := bindSearchCriteria(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refData, err := repo.FacetCounts(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters)
+	if err != nil {
+		_ = c.Error(errors.Wrap(err, "error counting facets"))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reference data"})
+		return
+	}
+
+	c.JSON(http.StatusOK, refDataResponse(c, refData, catalogue))
+}
+
+func refDataResponse(c *gin.Context, refData *models.RefData, catalogue codelist.Catalogue) gin.H {
+	response := gin.H{
+		"refdata":     refData,
+		"attribution": internal.ATTRIBUTION,
+	}
+	if c.Query("labels") == "true" {
+		response["labels"] = catalogue
 	}
+	return response
 }
@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/kofalt/go-memoize"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/apikey"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
+	"github.com/rm-hull/street-manager-relay/internal/graph"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/tavsec/gin-healthcheck/checks"
+
+	healthcheck "github.com/tavsec/gin-healthcheck"
+	hc_config "github.com/tavsec/gin-healthcheck/config"
+)
+
+// BasePath is the prefix of every API route, other than the health check.
+const BasePath = "/v1/street-manager-relay"
+
+// Dependencies are the services shared by the handlers.
+type Dependencies struct {
+	Repo          *internal.DbRepository
+	Organisations promoter.Organisations
+	Catalogue     codelist.Catalogue
+	CertManager   internal.CertManager
+	Broker        *stream.Broker
+	// AllowedOrigins, if set, are the only origins from which browsers may
+	// open a live connection
+	AllowedOrigins []string
+	// TrustedProxies are the addresses (or CIDR ranges) of the proxies whose
+	// X-Forwarded-Proto and X-Forwarded-Host headers are used in links
+	TrustedProxies []string
+	// Authenticator, if set, requires an API key for every route other than
+	// SNS (whose messages are signed) and the API documentation
+	Authenticator *apikey.Authenticator
+}
+
+// Register adds the health check and the API routes to the router, after any
+// middleware it already has.
+func Register(r *gin.Engine, deps *Dependencies) error {
+	repo, organisations, catalogue := deps.Repo, deps.Organisations, deps.Catalogue
+
+	schema, err := graph.NewSchema(repo, organisations)
+	if err != nil {
+		return err
+	}
+
+	err = healthcheck.New(r, hc_config.DefaultConfig(), []checks.Check{
+		repo.HealthCheck(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize healthcheck")
+	}
+
+	forwarded, err := forwardedHeaders(deps.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	public := r.Group(BasePath, forwarded)
+	public.POST("/sns", HandleSNSMessage(repo, deps.CertManager, deps.Broker))
+	public.GET("/openapi.json", HandleOpenAPI())
+	public.GET("/docs/*filepath", HandleSwaggerUI(BasePath+"/openapi.json"))
+
+	api := r.Group(BasePath, forwarded)
+	if deps.Authenticator != nil {
+		api.Use(deps.Authenticator.Middleware())
+	}
+
+	api.GET("/search", HandleSearch(repo, organisations, catalogue))
+	api.GET("/refdata", HandleRefData(repo, memoize.NewMemoizer(10*time.Minute, 1*time.Hour), catalogue))
+	api.GET("/objects/:object_reference", HandleObjectLookup(repo, organisations))
+	api.GET("/works/:work_reference_number", HandleWorkLookup(repo, organisations))
+	api.GET("/streets/:usrn", HandleStreetLookup(repo, organisations))
+	api.GET("/promoters/:swa_code/events", HandlePromoterEvents(repo, organisations))
+	api.GET("/calendar.ics", HandleCalendar(repo, organisations))
+	api.GET("/feed.atom", HandleFeed(repo, organisations))
+	api.GET("/stream", HandleStream(repo, deps.Broker, organisations))
+	api.GET("/live", HandleLive(repo, deps.Broker, organisations, deps.AllowedOrigins))
+
+	api.GET("/ogc", HandleFeaturesLanding())
+	api.GET("/ogc/conformance", HandleFeaturesConformance())
+	api.GET("/ogc/collections", HandleFeaturesCollections())
+	api.GET("/ogc/collections/events", HandleFeaturesCollection())
+	api.GET("/ogc/collections/events/items", HandleFeatureItems(repo, organisations))
+	api.GET("/ogc/collections/events/items/:featureId", HandleFeatureItem(repo, organisations))
+	api.GET("/wfs", HandleWFS(repo, organisations))
+	api.GET("/wzdx.geojson", HandleWZDx(repo))
+
+	api.GET("/graphql", HandleGraphQL(schema, repo))
+	api.POST("/graphql", HandleGraphQL(schema, repo))
+
+	api.POST("/webhooks", HandleCreateWebhook(repo))
+	api.GET("/webhooks", HandleListWebhooks(repo))
+	api.GET("/webhooks/:id", HandleGetWebhook(repo))
+	api.PUT("/webhooks/:id", HandleUpdateWebhook(repo))
+	api.DELETE("/webhooks/:id", HandleDeleteWebhook(repo))
+	api.GET("/webhooks/:id/deliveries", HandleWebhookDeliveries(repo))
+
+	return nil
+}
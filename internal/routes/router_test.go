@@ -0,0 +1,82 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// newTestRouter registers the routes, without requiring API keys, over a
+// database of the events.
+func newTestRouter(t *testing.T, events ...*models.Event) *gin.Engine {
+	t.Helper()
+	return newTestRouterWith(t, newTestDependencies(t, events...))
+}
+
+// newTestDependencies opens a database of the events, for tests that need to
+// change the dependencies, or publish changes to the broker.
+func newTestDependencies(t *testing.T, events ...*models.Event) *Dependencies {
+	t.Helper()
+
+	repo, err := internal.NewDbRepository(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	batch, err := repo.BatchUpsert()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for idx, event := range events {
+		if event.EventReference == nil {
+			event.EventReference = ptr(int64(idx + 1))
+		}
+		if _, err := batch.Upsert(event); err != nil {
+			t.Fatalf("unexpected error: %v", batch.Abort(err))
+		}
+	}
+	if err := batch.Done(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	catalogue, err := codelist.GetCatalogue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &Dependencies{
+		Repo:          repo,
+		Organisations: promoter.Organisations{"7001": {Id: "7001", Name: "Water Co", Url: "https://water.example.com"}},
+		Catalogue:     catalogue,
+		Broker:        stream.NewBroker(10),
+	}
+}
+
+func newTestRouterWith(t *testing.T, deps *Dependencies) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	if err := Register(r, deps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r
+}
+
+// get serves a GET request for the path, under the BasePath.
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, BasePath+path, nil))
+	return w
+}
@@ -8,63 +8,182 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/codelist"
 	"github.com/rm-hull/street-manager-relay/internal/promoter"
 	"github.com/rm-hull/street-manager-relay/models"
 )
 
-func HandleSearch(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
-	return func(c *gin.Context) {
+// searchCriteria are the filters common to every endpoint that searches events.
+type searchCriteria struct {
+	bbox            *models.BBox
+	text            string
+	facets          *models.Facets
+	temporalFilters *models.TemporalFilters
+}
+
+func bindSearchCriteria(c *gin.Context) (*searchCriteria, error) {
+	// A bounding box is optional only when searching by text
+	criteria := &searchCriteria{text: strings.TrimSpace(c.Query("q"))}
+	if c.Query("bbox") != "" || criteria.text == "" {
 		bbox, err := models.BoundingBoxFromCSV(c.Query("bbox"))
+		if err != nil {
+			return nil, err
+		}
+		criteria.bbox = bbox
+	}
+
+	facets, err := bindFacets(c)
+	if err != nil {
+		return nil, errors.New("Malformed facets")
+	}
+	criteria.facets = facets
+
+	temporalFilters, err := bindTemporalFilters(c)
+	if err != nil {
+		return nil, err
+	}
+	criteria.temporalFilters = temporalFilters
+
+	return criteria, nil
+}
+
+func HandleSearch(repo *internal.DbRepository, organisations promoter.Organisations, catalogue codelist.Catalogue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		criteria, err := bindSearchCriteria(c)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		facets, err := bindFacets(c)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Malformed facets"})
+		groupBy := c.Query("group_by")
+		if groupBy != "" && groupBy != "work" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "group_by must be one of: work"})
 			return
 		}
 
-		temporalFilters, err := bindTemporalFilters(c)
+		page, err := bindPage(c)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if page != nil && groupBy != "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit and offset are not supported with group_by"})
+			return
+		}
 
-		events, err := repo.Search(bbox, facets, temporalFilters)
+		switch format := c.DefaultQuery("format", "json"); format {
+		case "json":
+		case "csv", "xlsx", "kml", "gpx":
+			if groupBy != "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "group_by is not supported with format=" + format})
+				return
+			}
+			if page != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit and offset are not supported with format=" + format})
+				return
+			}
+			switch format {
+			case "kml":
+				exportKML(c, repo, organisations, criteria)
+			case "gpx":
+				exportGPX(c, repo, organisations, criteria)
+			default:
+				exportSearch(c, repo, organisations, criteria, format)
+			}
+			return
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be one of: json, csv, xlsx, kml, gpx"})
+			return
+		}
+
+		response := gin.H{"attribution": internal.ATTRIBUTION}
+		var events []*models.Event
+		if page != nil {
+			var total int
+			events, total, err = repo.SearchPage(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, page.limit, page.offset)
+			response["total"] = total
+		} else {
+			events, err = repo.Search(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters)
+		}
 		if err != nil {
 			_ = c.Error(errors.Wrap(err, "error searching events"))
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"results":     enrich(organisations, events),
-			"attribution": internal.ATTRIBUTION,
-		})
+		if groupBy == "work" {
+			// Summarised from all their permits, not only those matching the search
+			works, ungrouped, err := repo.GroupByWork(events, criteria.temporalFilters)
+			if err != nil {
+				_ = c.Error(errors.Wrap(err, "error grouping works"))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
+				return
+			}
+			response["works"] = enrichWorks(organisations, works)
+			response["streets"] = models.GroupByStreet(ungrouped)
+		} else {
+			results := enrich(organisations, events)
+			if c.Query("labels") == "true" {
+				withLabels(catalogue, results)
+			}
+			response["results"] = results
+		}
+
+		if c.Query("facet_counts") == "true" {
+			counts, err := repo.FacetCounts(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters)
+			if err != nil {
+				_ = c.Error(errors.Wrap(err, "error counting facets"))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to count facets"})
+				return
+			}
+			response["facets"] = counts
+		}
+
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func bindFacets(c *gin.Context) (*models.Facets, error) {
-	facets := &models.Facets{}
-	binders := map[string]func([]string){
-		"permit_status":               func(v []string) { facets.PermitStatus = v },
-		"traffic_management_type_ref": func(v []string) { facets.TrafficManagementTypeRef = v },
-		"work_status_ref":             func(v []string) { facets.WorkStatusRef = v },
-		"work_category_ref":           func(v []string) { facets.WorkCategoryRef = v },
-		"road_category":               func(v []string) { facets.RoadCategory = v },
-		"highway_authority":           func(v []string) { facets.HighwayAuthority = v },
-		"promoter_organisation":       func(v []string) { facets.PromoterOrganisation = v },
+// page is a slice of the results, from offset, of at most limit (or all, if
+// zero) results.
+type page struct {
+	limit  int
+	offset int
+}
+
+// bindPage binds the limit and offset, or is nil if neither is given.
+func bindPage(c *gin.Context) (*page, error) {
+	if c.Query("limit") == "" && c.Query("offset") == "" {
+		return nil, nil
 	}
 
-	for param, setter := range binders {
-		if values := c.QueryArray(param); len(values) > 0 {
-			setter(expandCommaSeparated(values))
+	p := &page{}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		p.limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative integer")
 		}
+		p.offset = offset
 	}
+	return p, nil
+}
 
-	return facets, nil
+func bindFacets(c *gin.Context) (*models.Facets, error) {
+	facets := make(models.Facets)
+	for _, facet := range models.FacetRegistry {
+		for _, value := range expandCommaSeparated(c.QueryArray(facet.Param)) {
+			facets.Add(facet.Param, value)
+		}
+		facets.Exclude(facet.Param, expandCommaSeparated(c.QueryArray(facet.Param+"__not"))...)
+	}
+
+	return &facets, nil
 }
 
 // expandCommaSeparated handles both multiple query params and comma-separated values
@@ -99,13 +218,21 @@ func bindTemporalFilters(c *gin.Context) (*models.TemporalFilters, error) {
 			if err != nil {
 				return nil, errors.Wrapf(err, "failed to convert %s", key)
 			}
-			if num < 0 {
-				return nil, errors.Newf("%s must be non-negative, but got %d", key, num)
+			if num < 0 || num > models.MaxWindowDays {
+				return nil, errors.Newf("%s must be between 0 and %d, but got %d", key, models.MaxWindowDays, num)
 			}
 			*target = num
 		}
 	}
 
+	if value := c.Query("as_at"); value != "" {
+		asAt, err := models.ParseTimestamp(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert as_at")
+		}
+		filters.AsAt = &asAt
+	}
+
 	return &filters, nil
 }
 
@@ -113,6 +240,15 @@ type EnrichedEvent struct {
 	*models.Event
 	PromoterWebsiteURL *string `json:"promoter_website_url,omitempty"`
 	PromoterLogoURL    *string `json:"promoter_logo_url,omitempty"`
+
+	// Labels for facet values, keyed by facet, when requested
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type EnrichedWork struct {
+	*models.Work
+	PromoterWebsiteURL *string `json:"promoter_website_url,omitempty"`
+	PromoterLogoURL    *string `json:"promoter_logo_url,omitempty"`
 }
 
 func enrich(promoterOrgs promoter.Organisations, events []*models.Event) []*EnrichedEvent {
@@ -121,14 +257,35 @@ func enrich(promoterOrgs promoter.Organisations, events []*models.Event) []*Enri
 	for idx, event := range events {
 
 		enrichedEvent := &EnrichedEvent{Event: event}
-
-		if event.PromoterSWACode != nil {
-			if org, ok := promoterOrgs[*event.PromoterSWACode]; ok {
-				enrichedEvent.PromoterWebsiteURL = &org.Url
-				enrichedEvent.PromoterLogoURL = org.Favicon
-			}
-		}
+		enrichedEvent.PromoterWebsiteURL, enrichedEvent.PromoterLogoURL = promoterLinks(promoterOrgs, event.PromoterSWACode)
 		out[idx] = enrichedEvent
 	}
 	return out
 }
+
+func withLabels(catalogue codelist.Catalogue, events []*EnrichedEvent) {
+	for _, event := range events {
+		event.Labels = catalogue.Labels(event.Event)
+	}
+}
+
+func enrichWorks(promoterOrgs promoter.Organisations, works []*models.Work) []*EnrichedWork {
+	out := make([]*EnrichedWork, len(works))
+
+	for idx, work := range works {
+		enrichedWork := &EnrichedWork{Work: work}
+		enrichedWork.PromoterWebsiteURL, enrichedWork.PromoterLogoURL = promoterLinks(promoterOrgs, work.PromoterSWACode)
+		out[idx] = enrichedWork
+	}
+	return out
+}
+
+func promoterLinks(promoterOrgs promoter.Organisations, swaCode *string) (websiteURL *string, logoURL *string) {
+	if swaCode == nil {
+		return nil, nil
+	}
+	if org, ok := promoterOrgs[*swaCode]; ok {
+		return &org.Url, org.Favicon
+	}
+	return nil, nil
+}
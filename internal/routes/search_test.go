@@ -0,0 +1,92 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestHandleSearchGroupsWholeWorks(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	laterEnd := end.Add(48 * time.Hour)
+	r := newTestRouter(t,
+		&models.Event{
+			ObjectReference: "W1-01", EventType: "PERMIT_GRANTED", WorkReferenceNumber: ptr("W1"), PermitStatus: ptr("granted"),
+			EventTime: &start, WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		},
+		// Outside the bbox, but part of the same work
+		&models.Event{
+			ObjectReference: "W1-02", EventType: "PERMIT_SUBMITTED", WorkReferenceNumber: ptr("W1"), PermitStatus: ptr("submitted"),
+			EventTime: &end, WorksLocationCoordinates: ptr("POINT(540000 190000)"), ProposedStartDate: &start, ProposedEndDate: &laterEnd,
+		},
+	)
+
+	w := get(r, "/search?bbox=530000,180000,531000,181000&group_by=work")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var response struct {
+		Works []*models.Work `json:"works"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.Works) != 1 {
+		t.Fatalf("got %d works, want 1", len(response.Works))
+	}
+
+	work := response.Works[0]
+	if len(work.Permits) != 2 {
+		t.Errorf("got %d permits, want both", len(work.Permits))
+	}
+	if work.PermitStatus == nil || *work.PermitStatus != "submitted" {
+		t.Errorf("got permit status %v, want that of the latest permit", work.PermitStatus)
+	}
+	if work.ActiveTo == nil || !work.ActiveTo.Equal(laterEnd) {
+		t.Errorf("got active to %v, want %v", work.ActiveTo, laterEnd)
+	}
+}
+
+func TestHandleSearchExportsGPX(t *testing.T) {
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	event := func(ref string, coords string) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, EventType: "WORK_START", PromoterSWACode: ptr("7001"),
+			WorksLocationCoordinates: ptr(coords), ProposedStartDate: &start, ProposedEndDate: &end,
+		}
+	}
+	r := newTestRouter(t,
+		event("OBJ-A", "POINT(530100 180100)"),
+		event("OBJ-B", "LINESTRING(530100 180100, 530200 180200)"),
+		event("OBJ-C", "POLYGON((530100 180100, 530200 180100, 530200 180200, 530100 180100))"),
+	)
+
+	w := get(r, "/search?bbox=530000,180000,531000,181000&format=gpx")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var doc struct {
+		Waypoints []struct{} `xml:"wpt"`
+		Tracks    []struct{} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Waypoints) != 3 || len(doc.Tracks) != 2 {
+		t.Errorf("got %d waypoints and %d tracks, want 3 and 2", len(doc.Waypoints), len(doc.Tracks))
+	}
+	if body := w.Body.String(); strings.LastIndex(body, "<wpt") > strings.Index(body, "<trk") {
+		t.Errorf("expected every waypoint before the tracks, got %s", body)
+	}
+}
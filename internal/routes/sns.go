@@ -9,10 +9,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rm-hull/street-manager-relay/generated"
 	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
 	"github.com/rm-hull/street-manager-relay/models"
 )
 
-func HandleSNSMessage(repo *internal.DbRepository, certManager internal.CertManager) gin.HandlerFunc {
+func HandleSNSMessage(repo *internal.DbRepository, certManager internal.CertManager, broker *stream.Broker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		messageType := c.GetHeader("x-amz-sns-message-type")
 		if messageType == "" {
@@ -48,7 +49,7 @@ func HandleSNSMessage(repo *internal.DbRepository, certManager internal.CertMana
 			return
 		}
 
-		if err := handleMessage(repo, &body); err != nil {
+		if err := handleMessage(repo, broker, &body); err != nil {
 			_ = c.Error(errors.Wrap(err, "failed to handle message "))
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle message"})
 			return
@@ -58,12 +59,12 @@ func HandleSNSMessage(repo *internal.DbRepository, certManager internal.CertMana
 	}
 }
 
-func handleMessage(repo *internal.DbRepository, body *internal.SNSMessage) error {
+func handleMessage(repo *internal.DbRepository, broker *stream.Broker, body *internal.SNSMessage) error {
 	switch body.Type {
 	case "SubscriptionConfirmation":
 		return confirmSubscription(body.SubscribeURL)
 	case "Notification":
-		return handleNotification(repo, body)
+		return handleNotification(repo, broker, body)
 	default:
 		log.Printf("Unknown message type: %s", body.Type)
 		return nil
@@ -90,7 +91,7 @@ func confirmSubscription(subscriptionURL string) error {
 	return nil
 }
 
-func handleNotification(repo *internal.DbRepository, body *internal.SNSMessage) error {
+func handleNotification(repo *internal.DbRepository, broker *stream.Broker, body *internal.SNSMessage) error {
 	event, err := generated.UnmarshalEventNotifierMessage([]byte(body.Message))
 	if err != nil {
 		return errors.Wrap(err, "failed to unmarshal event")
@@ -105,5 +106,10 @@ func handleNotification(repo *internal.DbRepository, body *internal.SNSMessage)
 		return errors.Wrap(batch.Abort(err), "failed to upsert")
 	}
 
-	return batch.Done()
+	if err := batch.Done(); err != nil {
+		return err
+	}
+
+	broker.Publish(batch.Changes()...)
+	return nil
 }
@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+
+	// resumePageSize is how many missed changes are read at a time when resuming
+	resumePageSize = 500
+)
+
+type StreamedChange struct {
+	ObjectReference string         `json:"object_reference"`
+	Event           *EnrichedEvent `json:"event"`
+}
+
+// HandleStream pushes changes to the client as server-sent events, as soon as
+// they are committed. Each is sent with its event history id, so that clients
+// reconnecting with a Last-Event-ID header first receive the changes they
+// missed from the history.
+func HandleStream(repo *internal.DbRepository, broker *stream.Broker, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bbox, facets, err := bindStreamFilters(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lastEventID, err := bindLastEventID(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Subscribe before resuming, so nothing is missed in between
+		sub := broker.Subscribe()
+		defer sub.Close()
+
+		var missed []*models.Change
+		if lastEventID > 0 {
+			missed, err = repo.ChangesSince(lastEventID, bbox, facets, resumePageSize)
+			if err != nil {
+				_ = c.Error(errors.Wrap(err, "error reading missed changes"))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume stream"})
+				return
+			}
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		for len(missed) > 0 {
+			for _, change := range missed {
+				if err := writeChange(c, organisations, change); err != nil {
+					return
+				}
+				lastEventID = change.ID
+			}
+			if len(missed) < resumePageSize {
+				break
+			}
+			if missed, err = repo.ChangesSince(lastEventID, bbox, facets, resumePageSize); err != nil {
+				_ = c.Error(errors.Wrap(err, "error reading missed changes"))
+				return
+			}
+		}
+		resumedUpTo := lastEventID
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+
+			case <-heartbeat.C:
+				if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+
+			case change, ok := <-sub.C:
+				if !ok {
+					// Dropped for falling behind: the client will reconnect and resume
+					return
+				}
+				if change.ID <= resumedUpTo || !matchesStream(change.Event, bbox, facets) {
+					continue
+				}
+				if err := writeChange(c, organisations, change); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+func bindStreamFilters(c *gin.Context) (*models.BBox, *models.Facets, error) {
+	var bbox *models.BBox
+	if c.Query("bbox") != "" {
+		var err error
+		if bbox, err = models.BoundingBoxFromCSV(c.Query("bbox")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	facets, err := bindFacets(c)
+	if err != nil {
+		return nil, nil, errors.New("Malformed facets")
+	}
+	return bbox, facets, nil
+}
+
+// bindLastEventID reads the id of the last change received, which browsers send
+// as a header when reconnecting, or may be given explicitly as a parameter.
+func bindLastEventID(c *gin.Context) (int64, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.Newf("invalid last event id '%s'", value)
+	}
+	return id, nil
+}
+
+// matchesStream applies the same bounding box and facet filters as a search
+// to an event that has just been received.
+func matchesStream(event *models.Event, bbox *models.BBox, facets *models.Facets) bool {
+	if bbox != nil {
+		eventBBox, err := event.BoundingBox()
+		if err != nil || !bbox.Intersects(*eventBBox) {
+			return false
+		}
+	}
+	return facets == nil || facets.Matches(event)
+}
+
+func writeChange(c *gin.Context, organisations promoter.Organisations, change *models.Change) error {
+	data, err := json.Marshal(StreamedChange{
+		ObjectReference: change.Event.ObjectReference,
+		Event:           enrich(organisations, []*models.Event{change.Event})[0],
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal change")
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", change.ID, change.Kind, data)
+	return err
+}
@@ -0,0 +1,101 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestHandleStream(t *testing.T) {
+	startsAt, endsAt := time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	event := func(ref string, coords string) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, EventType: "WORK_START", PromoterSWACode: ptr("7001"),
+			WorksLocationCoordinates: ptr(coords), ProposedStartDate: &startsAt, ProposedEndDate: &endsAt,
+		}
+	}
+	deps := newTestDependencies(t,
+		event("OBJ-A", "POINT(530100 180100)"),
+		event("OBJ-B", "POINT(400000 300000)"),
+		event("OBJ-C", "POINT(530200 180200)"),
+	)
+	r := newTestRouterWith(t, deps)
+
+	t.Run("Invalid last event id", func(t *testing.T) {
+		w := get(r, "/stream?last_event_id=-1")
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid last event id '-1'") {
+			t.Errorf("got status %d: %s", w.Code, w.Body)
+		}
+	})
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+BasePath+"/stream?bbox=530000,180000,531000,181000", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Each event as its id and kind, skipping heartbeats
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		var id, kind string
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				kind = strings.TrimPrefix(line, "event: ")
+			case line == "" && id != "":
+				events <- id + " " + kind
+				id, kind = "", ""
+			}
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	// Missed since the last event id, within the bbox
+	expect("3 create")
+
+	deps.Broker.Publish(
+		// Already sent when resuming
+		&models.Change{ID: 3, Kind: models.ChangeCreated, Event: event("OBJ-C", "POINT(530200 180200)")},
+		// Outside the bbox
+		&models.Change{ID: 4, Kind: models.ChangeUpdated, Event: event("OBJ-B", "POINT(400000 300000)")},
+		&models.Change{ID: 5, Kind: models.ChangeUpdated, Event: event("OBJ-A", "POINT(530100 180100)")},
+	)
+	expect("5 update")
+}
@@ -0,0 +1,222 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/apikey"
+	"github.com/rm-hull/street-manager-relay/internal/webhook"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const maxDeliveries = 100
+
+// WebhookRequest registers (or replaces) a subscription for an area, given as
+// either a bbox or a WKT polygon, and optional facets.
+type WebhookRequest struct {
+	CallbackURL string              `json:"callback_url"`
+	BBox        string              `json:"bbox,omitempty"`
+	Polygon     string              `json:"polygon,omitempty"`
+	Facets      map[string][]string `json:"facets,omitempty"`
+}
+
+func HandleCreateWebhook(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, err := bindWebhookRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			_ = c.Error(errors.Wrap(err, "error generating webhook secret"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+		sub.Secret = hex.EncodeToString(secret)
+		sub.APIKeyID = apikey.KeyID(c)
+
+		if err := repo.CreateWebhookSubscription(sub); err != nil {
+			_ = c.Error(errors.Wrap(err, "error creating webhook"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"result": sub})
+	}
+}
+
+func HandleListWebhooks(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subs, err := repo.WebhookSubscriptions(apikey.KeyID(c))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error listing webhooks"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"results": subs})
+	}
+}
+
+func HandleGetWebhook(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		sub, err := repo.FindWebhookSubscription(id, apikey.KeyID(c))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up webhook"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up webhook"})
+			return
+		}
+
+		if sub == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"result": sub})
+	}
+}
+
+func HandleUpdateWebhook(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		sub, err := bindWebhookRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sub.ID = id
+		sub.APIKeyID = apikey.KeyID(c)
+
+		found, err := repo.UpdateWebhookSubscription(sub)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error updating webhook"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+			return
+		}
+
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"result": sub})
+	}
+}
+
+func HandleDeleteWebhook(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		found, err := repo.DeleteWebhookSubscription(id, apikey.KeyID(c))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error deleting webhook"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+			return
+		}
+
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func HandleWebhookDeliveries(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		sub, err := repo.FindWebhookSubscription(id, apikey.KeyID(c))
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error looking up webhook"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up webhook"})
+			return
+		}
+
+		if sub == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		deliveries, err := repo.WebhookDeliveries(id, maxDeliveries)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error listing webhook deliveries"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhook deliveries"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"results": deliveries})
+	}
+}
+
+func bindWebhookRequest(c *gin.Context) (*models.WebhookSubscription, error) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, errors.New("Invalid JSON")
+	}
+
+	callbackURL, err := webhook.CheckCallbackURL(c.Request.Context(), req.CallbackURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var area *models.Area
+	switch {
+	case req.BBox != "" && req.Polygon != "":
+		return nil, errors.New("only one of bbox or polygon may be given")
+	case req.BBox != "":
+		bbox, err := models.BoundingBoxFromCSV(req.BBox)
+		if err != nil {
+			return nil, err
+		}
+		area = models.AreaFromBBox(*bbox)
+	case req.Polygon != "":
+		if area, err = models.AreaFromWKT(req.Polygon); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("one of bbox or polygon is required")
+	}
+
+	areaWKT, err := area.WKT()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to format area")
+	}
+
+	if _, err := models.FacetsFromMap(req.Facets); err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookSubscription{
+		CallbackURL: callbackURL.String(),
+		Area:        areaWKT,
+		Facets:      req.Facets,
+	}, nil
+}
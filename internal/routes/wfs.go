@@ -0,0 +1,409 @@
+package routes
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/promoter"
+	"github.com/rm-hull/street-manager-relay/internal/tabular"
+	"github.com/rm-hull/street-manager-relay/internal/wfs"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	wfsPath         = BasePath + "/wfs"
+	wfsCountDefault = 1000
+)
+
+// wfsFeatureType serves events with the same properties as the CSV export.
+var wfsFeatureType = &wfs.FeatureType{
+	Prefix:           "smr",
+	Namespace:        "https://github.com/rm-hull/street-manager-relay",
+	Name:             "events",
+	Title:            "Street works events",
+	Abstract:         "The current state of each permit, activity and section 58 restriction",
+	GeometryName:     "geometry",
+	Properties:       wfsProperties(exportColumns),
+	WGS84BoundingBox: greatBritain,
+}
+
+func wfsProperties(columns []tabular.Column[EnrichedEvent]) []wfs.Property {
+	properties := make([]wfs.Property, len(columns))
+	for idx, column := range columns {
+		properties[idx] = wfs.Property{Name: column.Name, Type: "string"}
+		switch column.Type {
+		case "INTEGER":
+			properties[idx].Type = "integer"
+		case "DATETIME":
+			properties[idx].Type = "dateTime"
+		}
+	}
+	return properties
+}
+
+// wfsError is reported to the client as an OWS exception.
+type wfsError struct {
+	code    string
+	locator string
+	text    string
+}
+
+func (err *wfsError) Error() string {
+	return err.text
+}
+
+func invalidParameter(locator string, text string) error {
+	return &wfsError{code: wfs.InvalidParameterValue, locator: locator, text: text}
+}
+
+// wfsQuery is a GetFeature request, mapped onto the search.
+type wfsQuery struct {
+	bbox            *models.BBox
+	facets          *models.Facets
+	temporalFilters *models.TemporalFilters
+	// equals are applied to the search results, as they could not be pushed
+	// down as facets
+	equals     []*wfs.PropertyIsEqualTo
+	count      int
+	startIndex int
+	hits       bool
+}
+
+// HandleWFS is a minimal WFS 2.0 service over the events, using the KVP
+// encoding, with GetCapabilities, DescribeFeatureType and GetFeature.
+func HandleWFS(repo *internal.DbRepository, organisations promoter.Organisations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := bindWFSParams(c)
+
+		var err error
+		switch request := params["request"]; {
+		case params["service"] == "":
+			err = &wfsError{code: wfs.MissingParameterValue, locator: "service", text: "service is required"}
+		case !strings.EqualFold(params["service"], "WFS"):
+			err = invalidParameter("service", "service must be WFS")
+		case strings.EqualFold(request, "GetCapabilities"):
+			err = wfsGetCapabilities(c, params)
+		case strings.EqualFold(request, "DescribeFeatureType"):
+			err = wfsDescribeFeatureType(c, params)
+		case strings.EqualFold(request, "GetFeature"):
+			err = wfsGetFeature(c, repo, organisations, params)
+		case request == "":
+			err = &wfsError{code: wfs.MissingParameterValue, locator: "request", text: "request is required"}
+		default:
+			err = &wfsError{code: wfs.OperationNotSupported, locator: "request", text: "request must be one of: GetCapabilities, DescribeFeatureType, GetFeature"}
+		}
+
+		if err != nil {
+			writeWFSException(c, err)
+		}
+	}
+}
+
+// bindWFSParams reads the KVP parameters, whose names are case-insensitive.
+func bindWFSParams(c *gin.Context) map[string]string {
+	params := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		params[strings.ToLower(key)] = values[0]
+	}
+	return params
+}
+
+func writeWFSException(c *gin.Context, err error) {
+	var wfsErr *wfsError
+	if !errors.As(err, &wfsErr) {
+		_ = c.Error(err)
+		wfsErr = &wfsError{code: wfs.OperationProcessingFailed, text: "Failed to process request"}
+	}
+
+	status := http.StatusBadRequest
+	switch wfsErr.code {
+	case wfs.OperationNotSupported:
+		status = http.StatusNotImplemented
+	case wfs.OperationProcessingFailed:
+		status = http.StatusInternalServerError
+	}
+
+	if c.Writer.Written() {
+		// Too late to report it to the client, which will see a truncated response
+		return
+	}
+	c.Header("Content-Type", "application/xml")
+	c.Status(status)
+	if err := wfs.WriteException(c.Writer, wfsErr.code, wfsErr.locator, wfsErr.text); err != nil {
+		_ = c.Error(errors.Wrap(err, "error writing WFS exception"))
+	}
+	c.Abort()
+}
+
+func checkWFSVersion(params map[string]string) error {
+	if version, ok := params["version"]; ok && version != wfs.Version && version != "2.0" {
+		return invalidParameter("version", "version must be "+wfs.Version)
+	}
+	return nil
+}
+
+func checkWFSTypeNames(params map[string]string, required bool) error {
+	typeNames, ok := params["typenames"]
+	if !ok {
+		// As used by WFS 1.x clients
+		typeNames, ok = params["typename"]
+	}
+	if !ok && required {
+		return &wfsError{code: wfs.MissingParameterValue, locator: "typeNames", text: "typeNames is required"}
+	}
+
+	for _, typeName := range expandCommaSeparated([]string{typeNames}) {
+		if !wfsFeatureType.Matches(strings.Trim(typeName, "()")) {
+			return invalidParameter("typeNames", "typeNames must be "+wfsFeatureType.QualifiedName())
+		}
+	}
+	return nil
+}
+
+func wfsGetCapabilities(c *gin.Context, params map[string]string) error {
+	if versions, ok := params["acceptversions"]; ok {
+		accepted := expandCommaSeparated([]string{versions})
+		if !slices.Contains(accepted, wfs.Version) && !slices.Contains(accepted, "2.0") {
+			return &wfsError{code: wfs.VersionNegotiationFailed, locator: "acceptVersions", text: "only version " + wfs.Version + " is supported"}
+		}
+	}
+
+	c.Header("Content-Type", "application/xml")
+	c.Status(http.StatusOK)
+	return wfs.WriteCapabilities(c.Writer, &wfs.Service{
+		Title:             "Street Manager Relay",
+		Abstract:          "Street works permits, activities and section 58 restrictions from GOV.UK Street Manager",
+		AccessConstraints: strings.Join(internal.ATTRIBUTION, " "),
+		ProviderName:      "Street Manager Relay",
+		URL:               baseURL(c) + wfsPath + "?",
+		CountDefault:      wfsCountDefault,
+		FeatureTypes:      []*wfs.FeatureType{wfsFeatureType},
+	})
+}
+
+func wfsDescribeFeatureType(c *gin.Context, params map[string]string) error {
+	if err := checkWFSVersion(params); err != nil {
+		return err
+	}
+	if err := checkWFSTypeNames(params, false); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/xml")
+	c.Status(http.StatusOK)
+	return wfs.WriteSchema(c.Writer, wfsFeatureType)
+}
+
+func wfsGetFeature(c *gin.Context, repo *internal.DbRepository, organisations promoter.Organisations, params map[string]string) error {
+	query, err := bindWFSQuery(c, params)
+	if err != nil {
+		return err
+	}
+
+	page, matched, err := searchWFS(repo, organisations, query)
+	if err != nil {
+		return errors.Wrap(err, "error searching events")
+	}
+
+	c.Header("Content-Type", wfs.OutputFormat)
+	c.Status(http.StatusOK)
+	writer, err := wfs.NewFeatureCollectionWriter(c.Writer, &wfs.FeatureCollection{
+		FeatureType:    wfsFeatureType,
+		SchemaURL:      baseURL(c) + wfsPath + "?service=WFS&version=2.0.0&request=DescribeFeatureType&typeNames=" + wfsFeatureType.QualifiedName(),
+		NumberMatched:  matched,
+		NumberReturned: len(page),
+		TimeStamp:      time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range page {
+		feature := &wfs.Feature{ID: event.ObjectReference, Values: make([]string, len(exportColumns))}
+		if g, err := event.Geometry(); err == nil {
+			feature.Geometry = g
+		}
+		for idx, column := range exportColumns {
+			feature.Values[idx] = column.Value(event)
+		}
+		if err := writer.WriteFeature(feature); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// searchWFS finds the page of events for the query, along with the number
+// matching in all. This is done in SQL, unless some conditions could not be
+// pushed down as facets, when the events are filtered and paged as read.
+func searchWFS(repo *internal.DbRepository, organisations promoter.Organisations, query *wfsQuery) ([]*EnrichedEvent, int, error) {
+	if len(query.equals) == 0 {
+		if query.hits {
+			matched, err := repo.SearchCount(query.bbox, "", query.facets, query.temporalFilters)
+			return nil, matched, err
+		}
+		events, matched, err := repo.SearchPage(query.bbox, "", query.facets, query.temporalFilters, query.count, query.startIndex)
+		if err != nil {
+			return nil, 0, err
+		}
+		return enrich(organisations, events), matched, nil
+	}
+
+	page := make([]*EnrichedEvent, 0)
+	matched := 0
+	err := repo.SearchEachByReference(query.bbox, "", query.facets, query.temporalFilters, func(event *models.Event) error {
+		enriched := enrich(organisations, []*models.Event{event})[0]
+		if !matchesAll(enriched, query.equals) {
+			return nil
+		}
+		if !query.hits && matched >= query.startIndex && matched < query.startIndex+query.count {
+			page = append(page, enriched)
+		}
+		matched++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, matched, nil
+}
+
+func bindWFSQuery(c *gin.Context, params map[string]string) (*wfsQuery, error) {
+	if err := checkWFSVersion(params); err != nil {
+		return nil, err
+	}
+	if err := checkWFSTypeNames(params, true); err != nil {
+		return nil, err
+	}
+	if srsName, ok := params["srsname"]; ok && !wfs.IsSRSName(srsName) {
+		return nil, invalidParameter("srsName", "srsName must be "+wfs.SRSName)
+	}
+	if format, ok := params["outputformat"]; ok && !wfs.IsOutputFormat(format) {
+		return nil, invalidParameter("outputFormat", "outputFormat must be "+wfs.OutputFormat)
+	}
+
+	query := &wfsQuery{bbox: &nationalGrid, count: wfsCountDefault}
+	switch resultType := params["resulttype"]; {
+	case resultType == "" || strings.EqualFold(resultType, "results"):
+	case strings.EqualFold(resultType, "hits"):
+		query.hits = true
+	default:
+		return nil, invalidParameter("resultType", "resultType must be one of: results, hits")
+	}
+
+	for _, param := range []struct {
+		name   string
+		target *int
+		min    int
+	}{{name: "count", target: &query.count, min: 1}, {name: "startindex", target: &query.startIndex, min: 0}} {
+		if value, ok := params[param.name]; ok {
+			num, err := strconv.Atoi(value)
+			if err != nil || num < param.min {
+				return nil, invalidParameter(param.name, param.name+" must be an integer of at least "+strconv.Itoa(param.min))
+			}
+			*param.target = num
+		}
+	}
+	query.count = min(query.count, wfsCountDefault)
+
+	_, hasBBox := params["bbox"]
+	_, hasFilter := params["filter"]
+	if hasBBox && hasFilter {
+		return nil, invalidParameter("filter", "bbox and filter are mutually exclusive")
+	}
+
+	if hasBBox {
+		bbox, err := parseWFSBBox(params["bbox"])
+		if err != nil {
+			return nil, err
+		}
+		query.bbox = bbox
+	}
+
+	facets := make(models.Facets)
+	query.facets = &facets
+	if hasFilter {
+		filter, err := wfs.ParseFilter(params["filter"])
+		if err != nil {
+			return nil, invalidParameter("filter", err.Error())
+		}
+
+		if envelope := filter.BBox; envelope != nil {
+			if envelope.SRSName != "" && !wfs.IsSRSName(envelope.SRSName) {
+				return nil, invalidParameter("filter", "BBOX srsName must be "+wfs.SRSName)
+			}
+			query.bbox = &models.BBox{MinX: envelope.MinX, MinY: envelope.MinY, MaxX: envelope.MaxX, MaxY: envelope.MaxY}
+		}
+
+		for _, equals := range filter.Equals {
+			if !slices.ContainsFunc(exportColumns, func(column tabular.Column[EnrichedEvent]) bool { return column.Name == equals.ValueReference }) {
+				return nil, invalidParameter("filter", "unknown property '"+equals.ValueReference+"'")
+			}
+			if !pushDownFacet(facets, equals) {
+				query.equals = append(query.equals, equals)
+			}
+		}
+	}
+
+	temporalFilters, err := bindTemporalFilters(c)
+	if err != nil {
+		return nil, invalidParameter("", err.Error())
+	}
+	query.temporalFilters = temporalFilters
+
+	return query, nil
+}
+
+// parseWFSBBox parses a bbox of minX,minY,maxX,maxY, optionally followed by
+// the CRS, which must be British National Grid.
+func parseWFSBBox(value string) (*models.BBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) == 5 {
+		if !wfs.IsSRSName(parts[4]) {
+			return nil, invalidParameter("bbox", "bbox CRS must be "+wfs.SRSName)
+		}
+		parts = parts[:4]
+	}
+
+	bbox, err := models.BoundingBoxFromCSV(strings.Join(parts, ","))
+	if err != nil {
+		return nil, invalidParameter("bbox", err.Error())
+	}
+	return bbox, nil
+}
+
+// pushDownFacet narrows the search when a PropertyIsEqualTo is on a
+// single-valued facet, and the literal has no special meaning as a facet value,
+// reporting whether it did so. A second condition on the same facet is not
+// pushed down, as the facet would match either value rather than both.
+func pushDownFacet(facets models.Facets, equals *wfs.PropertyIsEqualTo) bool {
+	if !equals.MatchCase || equals.Literal == "" || models.IsWildcard(equals.Literal) || strings.HasPrefix(equals.Literal, "!") {
+		return false
+	}
+	for _, facet := range models.FacetRegistry {
+		if facet.Table == "" && facet.Column == equals.ValueReference {
+			if _, ok := facets[facet.Param]; ok {
+				return false
+			}
+			facets.Add(facet.Param, equals.Literal)
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(event *EnrichedEvent, equals []*wfs.PropertyIsEqualTo) bool {
+	for _, condition := range equals {
+		idx := slices.IndexFunc(exportColumns, func(column tabular.Column[EnrichedEvent]) bool { return column.Name == condition.ValueReference })
+		if idx < 0 || !condition.Matches(exportColumns[idx].Value(event)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestWFSGetFeature(t *testing.T) {
+	startsAt, endsAt := time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	event := func(ref string, permitStatus string, usrn string) *models.Event {
+		return &models.Event{
+			ObjectReference: ref, EventType: "WORK_START", PromoterSWACode: ptr("7001"),
+			PermitStatus: ptr(permitStatus), USRN: ptr(usrn),
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &startsAt, ProposedEndDate: &endsAt,
+		}
+	}
+	r := newTestRouter(t,
+		event("OBJ-A", "granted", "1001"),
+		event("OBJ-B", "submitted", "1001"),
+		event("OBJ-C", "granted", "1002"),
+		event("OBJ-D", "granted", "1001"),
+	)
+
+	equals := func(property string, literal string, matchCase bool) string {
+		return `<PropertyIsEqualTo matchCase="` + map[bool]string{true: "true", false: "false"}[matchCase] + `"><ValueReference>` + property + `</ValueReference><Literal>` + literal + `</Literal></PropertyIsEqualTo>`
+	}
+	and := func(conditions ...string) string {
+		return "<Filter><And>" + strings.Join(conditions, "") + "</And></Filter>"
+	}
+
+	tests := []struct {
+		name     string
+		params   url.Values
+		ids      []string
+		matched  string
+		returned string
+	}{
+		{
+			name:   "All",
+			params: url.Values{},
+			ids:    []string{"OBJ-A", "OBJ-B", "OBJ-C", "OBJ-D"}, matched: "4", returned: "4",
+		},
+		{
+			name:   "Paged",
+			params: url.Values{"count": {"2"}, "startIndex": {"1"}},
+			ids:    []string{"OBJ-B", "OBJ-C"}, matched: "4", returned: "2",
+		},
+		{
+			name:   "Beyond the last page",
+			params: url.Values{"startIndex": {"10"}},
+			ids:    []string{}, matched: "4", returned: "0",
+		},
+		{
+			name:   "Hits",
+			params: url.Values{"resultType": {"hits"}, "count": {"1"}},
+			ids:    []string{}, matched: "4", returned: "0",
+		},
+		{
+			name:   "Facet",
+			params: url.Values{"filter": {"<Filter>" + equals("permit_status", "granted", true) + "</Filter>"}, "count": {"1"}, "startIndex": {"1"}},
+			ids:    []string{"OBJ-C"}, matched: "3", returned: "1",
+		},
+		{
+			name:   "Facet and property",
+			params: url.Values{"filter": {and(equals("permit_status", "granted", true), equals("usrn", "1001", true))}, "count": {"1"}, "startIndex": {"1"}},
+			ids:    []string{"OBJ-D"}, matched: "2", returned: "1",
+		},
+		{
+			name:   "Facet ignoring case",
+			params: url.Values{"filter": {"<Filter>" + equals("permit_status", "GRANTED", false) + "</Filter>"}},
+			ids:    []string{"OBJ-A", "OBJ-C", "OBJ-D"}, matched: "3", returned: "3",
+		},
+		{
+			name:   "Facet with different values",
+			params: url.Values{"filter": {and(equals("permit_status", "granted", true), equals("permit_status", "submitted", true))}},
+			ids:    []string{}, matched: "0", returned: "0",
+		},
+		{
+			name:   "Hits for a property",
+			params: url.Values{"filter": {"<Filter>" + equals("usrn", "1001", true) + "</Filter>"}, "resultType": {"hits"}},
+			ids:    []string{}, matched: "3", returned: "0",
+		},
+	}
+
+	featureID := regexp.MustCompile(`<smr:events gml:id="events\.([^"]+)">`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{"service": {"WFS"}, "request": {"GetFeature"}, "typeNames": {"smr:events"}}
+			for key, values := range tt.params {
+				params[key] = values
+			}
+			w := get(r, "/wfs?"+params.Encode())
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body)
+			}
+
+			doc := w.Body.String()
+			if expected := `numberMatched="` + tt.matched + `" numberReturned="` + tt.returned + `"`; !strings.Contains(doc, expected) {
+				t.Errorf("expected %s in %s", expected, doc)
+			}
+			ids := make([]string, 0)
+			for _, match := range featureID.FindAllStringSubmatch(doc, -1) {
+				ids = append(ids, match[1])
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("got %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
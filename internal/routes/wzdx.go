@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/rm-hull/street-manager-relay/internal"
+	"github.com/rm-hull/street-manager-relay/internal/wzdx"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const wzdxPublisher = "Street Manager Relay"
+
+// HandleWZDx streams the permits and activities within a bounding box (the
+// whole of Great Britain by default, with the usual facets and day windows)
+// as a WZDx work zone feed, for navigation and traffic management systems.
+func HandleWZDx(repo *internal.DbRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		criteria := &searchCriteria{bbox: &nationalGrid}
+		if c.Query("bbox") != "" {
+			bbox, err := models.BoundingBoxFromCSV(c.Query("bbox"))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			criteria.bbox = bbox
+		}
+
+		facets, err := bindFacets(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Malformed facets"})
+			return
+		}
+		criteria.facets = facets
+
+		if criteria.temporalFilters, err = bindTemporalFilters(c); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", wzdx.ContentType)
+		c.Status(http.StatusOK)
+
+		w, err := wzdx.NewWriter(c.Writer, wzdx.NewFeedInfo(wzdxPublisher, time.Now()), internal.ATTRIBUTION)
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error starting WZDx feed"))
+			return
+		}
+
+		err = repo.SearchEach(criteria.bbox, criteria.text, criteria.facets, criteria.temporalFilters, func(event *models.Event) error {
+			if feature := wzdx.NewRoadEvent(event); feature != nil {
+				return w.WriteRoadEvent(feature)
+			}
+			return nil
+		})
+		if err != nil {
+			_ = c.Error(errors.Wrap(err, "error exporting events"))
+			return
+		}
+
+		if err := w.Close(); err != nil {
+			_ = c.Error(errors.Wrap(err, "error completing WZDx feed"))
+		}
+	}
+}
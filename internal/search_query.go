@@ -0,0 +1,370 @@
+package internal
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+//go:embed sql/search_as_at.sql
+var searchAsAtSQL string
+
+// searchQuery incrementally assembles a SELECT over events. Column and table
+// names only ever come from code; all user-supplied values are bound as params.
+type searchQuery struct {
+	ctes       []string
+	cteParams  []any
+	from       string
+	rtree      string
+	children   string
+	joins      []string
+	conditions []string
+	params     []any
+	orderBy    string
+	limit      int
+	offset     int
+	historic   bool
+}
+
+// newSearchQuery selects from the current state of events, or - when time
+// travelling - from the latest state of each object recorded in the history.
+func newSearchQuery(temporalFilters *models.TemporalFilters) *searchQuery {
+	if temporalFilters != nil && temporalFilters.AsAt != nil {
+		return &searchQuery{
+			ctes:      []string{searchAsAtSQL},
+			cteParams: []any{temporalFilters.AsAt.UTC()},
+			from:      "event_history AS e INNER JOIN latest l ON e.id = l.id",
+			rtree:     "event_history_rtree",
+			children:  "event_history_",
+			historic:  true,
+		}
+	}
+
+	return &searchQuery{
+		from:     "events AS e",
+		rtree:    "events_rtree",
+		children: "event_",
+	}
+}
+
+// newHistoryQuery selects from every event recorded in the history, rather
+// than just the latest state of each object.
+func newHistoryQuery() *searchQuery {
+	return &searchQuery{
+		from:     "event_history AS e",
+		rtree:    "event_history_rtree",
+		children: "event_history_",
+		historic: true,
+	}
+}
+
+func (q *searchQuery) where(condition string, params ...any) *searchQuery {
+	q.conditions = append(q.conditions, condition)
+	q.params = append(q.params, params...)
+	return q
+}
+
+func (q *searchQuery) ordered(orderBy string) *searchQuery {
+	q.orderBy = orderBy
+	return q
+}
+
+func (q *searchQuery) limited(limit int) *searchQuery {
+	q.limit = limit
+	return q
+}
+
+func (q *searchQuery) skipping(offset int) *searchQuery {
+	q.offset = offset
+	return q
+}
+
+// limitedPer keeps up to limit of the matching events from offset for each
+// value of the partition, in order, so that a batch of lookups is paged as if
+// each were made separately. It must be the last condition added.
+func (q *searchQuery) limitedPer(partitionBy string, orderBy string, limit int, offset int) *searchQuery {
+	unpaged := *q
+	unpaged.orderBy, unpaged.limit, unpaged.offset = "", 0, 0
+	ranked, params := unpaged.buildSelect(fmt.Sprintf("SELECT e.id, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS row_number", partitionBy, orderBy), "")
+	return q.
+		where(fmt.Sprintf("e.id IN (SELECT id FROM (%s) WHERE row_number > %d AND row_number <= %d)", ranked, offset, offset+limit), slices.Clone(params)...).
+		ordered(orderBy)
+}
+
+func (q *searchQuery) withinBoundingBox(bbox *models.BBox) *searchQuery {
+	if bbox == nil {
+		return q
+	}
+
+	q.joins = append(q.joins, fmt.Sprintf("INNER JOIN %s r ON e.id = r.id", q.rtree))
+	// Correct parameter order: maxX, minX, maxY, minY (which seems counterintuitive)
+	return q.where("r.minx <= ? AND r.maxx >= ? AND r.miny <= ? AND r.maxy >= ?", bbox.MaxX, bbox.MinX, bbox.MaxY, bbox.MinY)
+}
+
+// The best known start and end of an event, preferring actual over planned,
+// as per models.Event StartsAt and EndsAt
+const (
+	startsAtSQL = `COALESCE(e.actual_start_date_time, e.start_date, e.start_time, e.proposed_start_date, e.proposed_start_time)`
+	endsAtSQL   = `COALESCE(e.actual_end_date_time, e.end_date, e.end_time, e.proposed_end_date, e.proposed_end_time)`
+)
+
+func (q *searchQuery) withinTemporalWindow(temporalFilters *models.TemporalFilters) *searchQuery {
+	if temporalFilters.From != nil || temporalFilters.To != nil {
+		return q.activeBetween(temporalFilters.From, temporalFilters.To)
+	}
+
+	// Relative date windows are anchored on the as-at instant when time-travelling
+	anchor := "now"
+	if temporalFilters.AsAt != nil {
+		anchor = temporalFilters.AsAt.UTC().Format(time.DateTime)
+	}
+
+	q.where(startsAtSQL+` <= DATE(?, ?)`, anchor, fmt.Sprintf("+%d days", temporalFilters.MaxDaysAhead))
+	return q.where(`(`+endsAtSQL+` IS NULL OR `+endsAtSQL+` >= DATE(?, ?))`, anchor, fmt.Sprintf("-%d days", temporalFilters.MaxDaysBehind))
+}
+
+// activeBetween restricts results to events active at some point between
+// from and to, either of which may be nil to leave that end open.
+func (q *searchQuery) activeBetween(from *time.Time, to *time.Time) *searchQuery {
+	if to != nil {
+		q.where(startsAtSQL+` <= ?`, to.UTC())
+	}
+	if from != nil {
+		q.where(`(`+endsAtSQL+` IS NULL OR `+endsAtSQL+` >= ?)`, from.UTC())
+	}
+	return q
+}
+
+// matchingText restricts results to those whose indexed text matches every
+// term. The index only holds the current text for an object, so historic
+// searches match on that rather than the text at the as-at instant.
+func (q *searchQuery) matchingText(text string) *searchQuery {
+	match := ftsQuery(text)
+	if match == "" {
+		return q
+	}
+
+	if q.historic {
+		return q.where(`e.object_reference IN (
+			SELECT object_reference FROM events WHERE id IN (SELECT rowid FROM events_fts WHERE events_fts MATCH ?)
+		)`, match)
+	}
+	return q.where("e.id IN (SELECT rowid FROM events_fts WHERE events_fts MATCH ?)", match)
+}
+
+// matchingFacets requires events to match at least one included value (if
+// any) and none of the excluded values of each facet. Events without a value
+// are never excluded, so e.g. "everything except cancelled" keeps them.
+func (q *searchQuery) matchingFacets(facets *models.Facets) *searchQuery {
+	if facets == nil {
+		return q
+	}
+
+	for _, facet := range models.FacetRegistry {
+		filter, ok := (*facets)[facet.Param]
+		if !ok {
+			continue
+		}
+
+		if facet.Table != "" {
+			q.matchingChildFacet(facet, filter)
+			continue
+		}
+
+		column := "e." + facet.Column
+		if condition, params := anyValueMatches(column, filter.Include); condition != "" {
+			q.where(condition, params...)
+		}
+		if condition, params := anyValueMatches(column, filter.Exclude); condition != "" {
+			q.where(fmt.Sprintf("(%s IS NULL OR NOT %s)", column, condition), params...)
+		}
+	}
+	return q
+}
+
+// matchingChildFacet filters on a multi-valued facet: an event is included if
+// any of its values match, and excluded if any of its values match.
+func (q *searchQuery) matchingChildFacet(facet models.FacetDefinition, filter *models.FacetFilter) {
+	exists := fmt.Sprintf("EXISTS (SELECT 1 FROM %s fv WHERE fv.id = e.id AND %%s)", q.children+facet.Table)
+	column := "fv." + facet.Column
+
+	if condition, params := anyValueMatches(column, filter.Include); condition != "" {
+		q.where(fmt.Sprintf(exists, condition), params...)
+	}
+	if condition, params := anyValueMatches(column, filter.Exclude); condition != "" {
+		q.where("NOT "+fmt.Sprintf(exists, condition), params...)
+	}
+}
+
+// anyValueMatches builds a condition on the column matching any of the values,
+// exactly or - for those with wildcards - as a GLOB pattern. The values are
+// bound as JSON arrays, so only the column name is interpolated.
+func anyValueMatches(column string, values []string) (string, []any) {
+	exact := make([]string, 0, len(values))
+	patterns := make([]string, 0)
+	for _, value := range values {
+		if models.IsWildcard(value) {
+			patterns = append(patterns, globPattern(value))
+		} else {
+			exact = append(exact, value)
+		}
+	}
+
+	conditions := make([]string, 0, 2)
+	params := make([]any, 0, 2)
+	if len(exact) > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s IN (SELECT value FROM json_each(?))", column))
+		params = append(params, toJSONOrNil(exact))
+	}
+	if len(patterns) > 0 {
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(?) WHERE %s GLOB value)", column))
+		params = append(params, toJSONOrNil(patterns))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", params
+}
+
+// globPattern converts a facet value using '*' wildcards into a case-sensitive
+// GLOB pattern, escaping the other characters GLOB treats specially.
+func globPattern(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		switch r {
+		case '?', '[':
+			sb.WriteString("[" + string(r) + "]")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func (q *searchQuery) build() (string, []any) {
+	body, params := q.buildSelect(searchSQL, "")
+	return q.withCTEs(body, params)
+}
+
+// buildSelect renders the query without its CTEs, so that several may be
+// combined under a common WITH clause.
+func (q *searchQuery) buildSelect(selectClause string, groupBy string) (string, []any) {
+	var sb strings.Builder
+	sb.WriteString(selectClause)
+	sb.WriteString("\nFROM ")
+	sb.WriteString(q.from)
+	for _, join := range q.joins {
+		sb.WriteString("\n")
+		sb.WriteString(join)
+	}
+
+	if len(q.conditions) > 0 {
+		sb.WriteString("\nWHERE ")
+		sb.WriteString(strings.Join(q.conditions, "\nAND "))
+	}
+
+	if groupBy != "" {
+		sb.WriteString("\nGROUP BY ")
+		sb.WriteString(groupBy)
+	}
+
+	if q.orderBy != "" {
+		sb.WriteString("\nORDER BY ")
+		sb.WriteString(q.orderBy)
+	}
+
+	if q.limit > 0 {
+		sb.WriteString(fmt.Sprintf("\nLIMIT %d", q.limit))
+	} else if q.offset > 0 {
+		// SQLite only allows an offset after a limit, where negative is none
+		sb.WriteString("\nLIMIT -1")
+	}
+	if q.offset > 0 {
+		sb.WriteString(fmt.Sprintf(" OFFSET %d", q.offset))
+	}
+
+	return sb.String(), q.params
+}
+
+// buildCount renders a query counting the matching events, regardless of any
+// order, limit or offset.
+func (q *searchQuery) buildCount() (string, []any) {
+	unpaged := *q
+	unpaged.orderBy, unpaged.limit, unpaged.offset = "", 0, 0
+	return unpaged.withCTEs(unpaged.buildSelect("SELECT COUNT(*)", ""))
+}
+
+func (q *searchQuery) withCTEs(body string, params []any) (string, []any) {
+	if len(q.ctes) == 0 {
+		return body, params
+	}
+
+	all := make([]any, 0, len(q.cteParams)+len(params))
+	all = append(all, q.cteParams...)
+	all = append(all, params...)
+	return "WITH " + strings.Join(q.ctes, ",\n") + "\n" + body, all
+}
+
+// facetCountsQuery counts the values of every refdata facet over the events
+// matching the search. Each facet is counted disregarding its own selection
+// (i.e. disjunctive faceting), so that choosing one value doesn't hide the
+// counts for the alternatives.
+func facetCountsQuery(bbox *models.BBox, text string, facets *models.Facets, temporalFilters *models.TemporalFilters) (string, []any) {
+	var q *searchQuery
+	selects := make([]string, 0, len(models.FacetRegistry))
+	params := make([]any, 0)
+
+	for _, facet := range models.FacetRegistry {
+		if !facet.RefData {
+			continue
+		}
+
+		others := make(models.Facets)
+		if facets != nil {
+			for param, filter := range *facets {
+				if param != facet.Param {
+					others[param] = filter
+				}
+			}
+		}
+
+		q = newSearchQuery(temporalFilters).
+			withinBoundingBox(bbox).
+			withinTemporalWindow(temporalFilters).
+			matchingText(text).
+			matchingFacets(&others)
+
+		column := "e." + facet.Column
+		if facet.Table != "" {
+			q.joins = append(q.joins, fmt.Sprintf("INNER JOIN %s fv ON fv.id = e.id", q.children+facet.Table))
+			column = "fv." + facet.Column
+		}
+
+		body, bodyParams := q.buildSelect(
+			fmt.Sprintf("SELECT '%s' AS facet, %s AS value, COUNT(*) AS cnt", facet.Param, column),
+			column)
+		selects = append(selects, body)
+		params = append(params, bodyParams...)
+	}
+
+	return q.withCTEs(strings.Join(selects, "\nUNION ALL\n"), params)
+}
+
+// ftsQuery turns free text into an FTS5 expression where every whitespace
+// separated term must match, the last as a prefix (for type-ahead). Each term
+// is quoted so that FTS5 operators and punctuation in user input are inert.
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
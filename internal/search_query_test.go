@@ -0,0 +1,33 @@
+package internal
+
+import "testing"
+
+func TestGlobPattern(t *testing.T) {
+	tests := map[string]string{
+		"0000218889*": "0000218889*",
+		"*-01":        "*-01",
+		"what?":       "what[?]",
+		"[abc]*":      "[[]abc]*",
+	}
+
+	for value, expected := range tests {
+		if got := globPattern(value); got != expected {
+			t.Errorf("globPattern(%q) = %q, want %q", value, got, expected)
+		}
+	}
+}
+
+func TestFtsQuery(t *testing.T) {
+	tests := map[string]string{
+		"":                    "",
+		"church":              `"church"*`,
+		"  church   street  ": `"church" "street"*`,
+		`say "hello" OR`:      `"say" """hello""" "OR"*`,
+	}
+
+	for text, expected := range tests {
+		if got := ftsQuery(text); got != expected {
+			t.Errorf("ftsQuery(%q) = %q, want %q", text, got, expected)
+		}
+	}
+}
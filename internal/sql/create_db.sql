@@ -1,7 +1,10 @@
 CREATE TABLE IF NOT EXISTS events (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     object_reference TEXT UNIQUE,
+    object_type TEXT,
     event_type TEXT,
+    event_reference INTEGER,
+    event_time TIMESTAMP,
 
     -- Core location and authority info
     usrn TEXT,
@@ -95,6 +98,30 @@ CREATE VIRTUAL TABLE IF NOT EXISTS events_rtree USING rtree(
     maxy
 );
 
+-- Full-text index over descriptive fields and references (rowid matches events.id)
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5(
+    street_name,
+    area_name,
+    town,
+    activity_location_description,
+    permit_conditions,
+    object_reference,
+    work_reference_number,
+    permit_reference_number,
+    activity_reference_number,
+    section_58_reference_number,
+    usrn
+);
+
+-- Permit condition codes parsed from events.permit_conditions
+CREATE TABLE IF NOT EXISTS event_permit_conditions (
+    id INTEGER NOT NULL,    -- matches events.id
+    code TEXT NOT NULL,
+    PRIMARY KEY (id, code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_permit_conditions_code ON event_permit_conditions(code);
+
 CREATE INDEX IF NOT EXISTS idx_events_permit_status ON events(permit_status);
 CREATE INDEX IF NOT EXISTS idx_events_traffic_management_type_ref ON events(traffic_management_type_ref);
 CREATE INDEX IF NOT EXISTS idx_events_work_status_ref ON events(work_status_ref);
@@ -102,3 +129,174 @@ CREATE INDEX IF NOT EXISTS idx_events_work_category_ref ON events(work_category_
 CREATE INDEX IF NOT EXISTS idx_events_road_category ON events(road_category);
 CREATE INDEX IF NOT EXISTS idx_events_highway_authority ON events(highway_authority);
 CREATE INDEX IF NOT EXISTS idx_events_promoter_organisation ON events(promoter_organisation);
+CREATE INDEX IF NOT EXISTS idx_events_event_type ON events(event_type);
+CREATE INDEX IF NOT EXISTS idx_events_activity_type ON events(activity_type);
+CREATE INDEX IF NOT EXISTS idx_events_is_traffic_sensitive ON events(is_traffic_sensitive);
+CREATE INDEX IF NOT EXISTS idx_events_is_ttro_required ON events(is_ttro_required);
+CREATE INDEX IF NOT EXISTS idx_events_close_footway_ref ON events(close_footway_ref);
+CREATE INDEX IF NOT EXISTS idx_events_collaboration_type_ref ON events(collaboration_type_ref);
+CREATE INDEX IF NOT EXISTS idx_events_cancelled ON events(cancelled);
+CREATE INDEX IF NOT EXISTS idx_events_highway_authority_swa_code ON events(highway_authority_swa_code);
+
+-- Lookup indexes
+CREATE INDEX IF NOT EXISTS idx_events_work_reference_number ON events(work_reference_number);
+CREATE INDEX IF NOT EXISTS idx_events_usrn ON events(usrn);
+CREATE INDEX IF NOT EXISTS idx_events_promoter_swa_code ON events(promoter_swa_code);
+
+
+-- Append-only log of every event received, used to answer point-in-time queries
+CREATE TABLE IF NOT EXISTS event_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    object_reference TEXT NOT NULL,
+    object_type TEXT,
+    event_type TEXT,
+    event_reference INTEGER,
+    event_time TIMESTAMP,
+
+    -- Core location and authority info
+    usrn TEXT,
+    street_name TEXT,
+    area_name TEXT,
+    town TEXT,
+    highway_authority TEXT,
+    highway_authority_swa_code TEXT,
+
+    -- Activity / work / permit references
+    activity_reference_number TEXT,
+    work_reference_number TEXT,
+    permit_reference_number TEXT,
+    promoter_swa_code TEXT,
+    promoter_organisation TEXT,
+
+    -- Coordinates & descriptions
+    works_location_coordinates TEXT,
+    activity_coordinates TEXT,
+    works_location_type TEXT,
+    activity_location_type TEXT,
+    activity_location_description TEXT,
+    section_58_coordinates TEXT,
+
+    -- Categories & types
+    work_category TEXT,
+    work_category_ref TEXT,
+    work_status TEXT,
+    work_status_ref TEXT,
+    traffic_management_type TEXT,
+    traffic_management_type_ref TEXT,
+    current_traffic_management_type TEXT,
+    current_traffic_management_type_ref TEXT,
+    road_category TEXT,
+    activity_type TEXT,
+    activity_type_details TEXT,
+    section_58_status TEXT,
+    section_58_duration TEXT,
+    section_58_extent TEXT,
+    section_58_location_type TEXT,
+
+    -- Dates/times
+    proposed_start_date TIMESTAMP,
+    proposed_end_date TIMESTAMP,
+    proposed_start_time TIMESTAMP,
+    proposed_end_time TIMESTAMP,
+    actual_start_date_time TIMESTAMP,
+    actual_end_date_time TIMESTAMP,
+    start_date TIMESTAMP,
+    start_time TIMESTAMP,
+    end_date TIMESTAMP,
+    end_time TIMESTAMP,
+    current_traffic_management_update_date TIMESTAMP,
+
+    -- Flags / booleans stored as text
+    is_ttro_required TEXT,
+    is_covid_19_response TEXT,
+    is_traffic_sensitive TEXT,
+    is_deemed TEXT,
+    collaborative_working TEXT,
+    cancelled TEXT,
+    traffic_management_required TEXT,
+
+    -- Misc attributes
+    permit_conditions TEXT,
+    permit_status TEXT,
+    collaboration_type TEXT,
+    collaboration_type_ref TEXT,
+    close_footway TEXT,
+    close_footway_ref TEXT,
+    section_58_reference_number TEXT,
+
+    UNIQUE(object_reference, event_reference)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_history_object_time
+    ON event_history(object_reference, event_time);
+
+-- R-Tree index table for historic bounding boxes
+CREATE VIRTUAL TABLE IF NOT EXISTS event_history_rtree USING rtree(
+    id,    -- matches event_history.id
+    minx,
+    maxx,
+    miny,
+    maxy
+);
+
+-- Permit condition codes parsed from event_history.permit_conditions
+CREATE TABLE IF NOT EXISTS event_history_permit_conditions (
+    id INTEGER NOT NULL,    -- matches event_history.id
+    code TEXT NOT NULL,
+    PRIMARY KEY (id, code)
+);
+
+
+-- Outbound webhooks, notified of changes within an area matching the facets
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    callback_url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    area TEXT NOT NULL,     -- WKT polygon
+    facets TEXT,            -- JSON object of facet param to values
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    api_key_id INTEGER      -- matches api_keys.id, the owner; null when keys are not required
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_api_key
+    ON webhook_subscriptions(api_key_id);
+
+-- Each change to be sent to a subscriber, and the outcome of the attempts
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,   -- matches webhook_subscriptions.id
+    history_id INTEGER NOT NULL,        -- matches event_history.id
+    object_reference TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_attempt_at TIMESTAMP,
+    response_status INTEGER,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE(subscription_id, history_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending
+    ON webhook_deliveries(status, next_attempt_at);
+
+-- The last event history id matched against the webhook subscriptions
+CREATE TABLE IF NOT EXISTS webhook_cursor (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_history_id INTEGER NOT NULL
+);
+
+-- Keys for the API, of which only a hash is kept
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,                 -- who the key was issued to
+    prefix TEXT NOT NULL,               -- the start of the key, to recognise it by
+    key_hash TEXT NOT NULL UNIQUE,      -- hex SHA-256 of the key
+    rate_per_minute INTEGER NOT NULL,
+    burst INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
@@ -1,7 +1,10 @@
 SELECT
     -- Identifiers
     e.id,
+    e.object_type,
     e.event_type,
+    e.event_reference,
+    e.event_time,
     e.object_reference,
     e.activity_reference_number,
     e.work_reference_number,
@@ -72,22 +75,3 @@ SELECT
     e.collaboration_type_ref,
     e.close_footway,
     e.close_footway_ref
-
-FROM events AS e
-INNER JOIN events_rtree r ON e.id = r.id
-WHERE r.minx <= ? AND r.maxx >= ? AND r.miny <= ? AND r.maxy >= ?
-AND (
-    COALESCE(e.actual_start_date_time, e.start_date, e.start_time, e.proposed_start_date, e.proposed_start_time) <= DATE('now', ?)
-)
-AND (
-    COALESCE(e.actual_end_date_time, e.end_date, e.end_time, e.proposed_end_date, e.proposed_end_time) IS NULL OR
-    COALESCE(e.actual_end_date_time, e.end_date, e.end_time, e.proposed_end_date, e.proposed_end_time) >= DATE('now', ?)
-)
--- Facet filters: empty JSON array means no filter
-AND (? IS NULL OR json_array_length(?) = 0 OR e.permit_status IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.traffic_management_type_ref IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.work_status_ref IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.work_category_ref IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.road_category IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.highway_authority IN (SELECT value FROM json_each(?)))
-AND (? IS NULL OR json_array_length(?) = 0 OR e.promoter_organisation IN (SELECT value FROM json_each(?)))
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- The most recent state of each object known at the given instant
+latest AS (
+    SELECT id FROM (
+        SELECT
+            id,
+            ROW_NUMBER() OVER (PARTITION BY object_reference ORDER BY event_time DESC, id DESC) AS rn
+        FROM event_history
+        WHERE event_time <= ?
+    )
+    WHERE rn = 1
+)
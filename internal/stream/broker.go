@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"log"
+	"sync"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+// Broker fans out changes, as they are committed, to every live subscriber.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	bufferSize  int
+}
+
+// Subscription receives changes on C until it is closed, either by the
+// subscriber or by the broker when the subscriber falls too far behind (in
+// which case it should resume from the event history).
+type Subscription struct {
+	C      <-chan *models.Change
+	ch     chan *models.Change
+	broker *Broker
+}
+
+func NewBroker(bufferSize int) *Broker {
+	return &Broker{
+		subscribers: make(map[*Subscription]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+func (broker *Broker) Subscribe() *Subscription {
+	ch := make(chan *models.Change, broker.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, broker: broker}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Publish never blocks: subscribers whose buffer is full are dropped.
+func (broker *Broker) Publish(changes ...*models.Change) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for sub := range broker.subscribers {
+		if !sub.deliver(changes) {
+			log.Printf("Dropping slow stream subscriber after %d buffered changes", broker.bufferSize)
+			broker.remove(sub)
+		}
+	}
+}
+
+func (sub *Subscription) deliver(changes []*models.Change) bool {
+	for _, change := range changes {
+		select {
+		case sub.ch <- change:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (broker *Broker) Subscribers() int {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	return len(broker.subscribers)
+}
+
+// Close unsubscribes, and is safe to call more than once.
+func (sub *Subscription) Close() {
+	sub.broker.mu.Lock()
+	defer sub.broker.mu.Unlock()
+	sub.broker.remove(sub)
+}
+
+func (broker *Broker) remove(sub *Subscription) {
+	if _, ok := broker.subscribers[sub]; ok {
+		delete(broker.subscribers, sub)
+		close(sub.ch)
+	}
+}
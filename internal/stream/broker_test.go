@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestBrokerPublish(t *testing.T) {
+	broker := NewBroker(2)
+	first := broker.Subscribe()
+	second := broker.Subscribe()
+	defer first.Close()
+	defer second.Close()
+
+	broker.Publish(&models.Change{ID: 1}, &models.Change{ID: 2})
+
+	for _, sub := range []*Subscription{first, second} {
+		for _, expected := range []int64{1, 2} {
+			if change := <-sub.C; change.ID != expected {
+				t.Errorf("got change %d, want %d", change.ID, expected)
+			}
+		}
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := NewBroker(1)
+	slow := broker.Subscribe()
+
+	broker.Publish(&models.Change{ID: 1}, &models.Change{ID: 2})
+
+	if change := <-slow.C; change.ID != 1 {
+		t.Errorf("got change %d, want 1", change.ID)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("expected subscription to be closed")
+	}
+	if n := broker.Subscribers(); n != 0 {
+		t.Errorf("got %d subscribers, want 0", n)
+	}
+
+	// Closing after being dropped is harmless
+	slow.Close()
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	broker := NewBroker(1)
+	sub := broker.Subscribe()
+	sub.Close()
+	sub.Close()
+
+	broker.Publish(&models.Change{ID: 1})
+
+	if _, ok := <-sub.C; ok {
+		t.Error("expected subscription to be closed")
+	}
+}
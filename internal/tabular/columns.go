@@ -0,0 +1,98 @@
+package tabular
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column is a column of a table of T, named after the JSON field it is taken
+// from.
+type Column[T any] struct {
+	Name string
+	// Type is the SQL type of the column: INTEGER, DATETIME or TEXT
+	Type  string
+	Value func(row *T) string
+}
+
+// Columns are the JSON fields of T (including those of embedded structs), in
+// the order they are declared. Fields which are not serialised, and maps, are
+// left out. Values are formatted as text, with timestamps as RFC 3339 in UTC
+// and string slices separated by ';'.
+func Columns[T any]() []Column[T] {
+	return columnsOf[T](reflect.TypeFor[T](), nil)
+}
+
+func columnsOf[T any](t reflect.Type, index []int) []Column[T] {
+	columns := make([]Column[T], 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		fieldIndex := append(slices.Clone(index), i)
+
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			columns = append(columns, columnsOf[T](embedded, fieldIndex)...)
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || field.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		columns = append(columns, Column[T]{
+			Name: name,
+			Type: sqlType(field.Type),
+			Value: func(row *T) string {
+				value, err := reflect.ValueOf(row).Elem().FieldByIndexErr(fieldIndex)
+				if err != nil {
+					return ""
+				}
+				return formatValue(value)
+			},
+		})
+	}
+	return columns
+}
+
+func sqlType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return "DATETIME"
+	case t.Kind() == reflect.Int64:
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch v := value.Interface().(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
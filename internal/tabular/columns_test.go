@@ -0,0 +1,47 @@
+package tabular
+
+import (
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Reference *string `json:"reference,omitempty"`
+	Hidden    string  `json:"-"`
+}
+
+type row struct {
+	*inner
+	Count    int64             `json:"count"`
+	At       *time.Time        `json:"at,omitempty"`
+	Codes    []string          `json:"codes"`
+	Labels   map[string]string `json:"labels"`
+	Untagged string
+}
+
+func TestColumns(t *testing.T) {
+	reference := "P1"
+	at := time.Date(2025, 6, 1, 9, 0, 0, 0, time.FixedZone("BST", 3600))
+	r := &row{inner: &inner{Reference: &reference, Hidden: "x"}, Count: 42, At: &at, Codes: []string{"A", "B"}}
+
+	expected := []struct{ name, sqlType, value string }{
+		{"reference", "TEXT", "P1"},
+		{"count", "INTEGER", "42"},
+		{"at", "DATETIME", "2025-06-01T08:00:00Z"},
+		{"codes", "TEXT", "A;B"},
+	}
+
+	columns := Columns[row]()
+	if len(columns) != len(expected) {
+		t.Fatalf("got %d columns, want %d", len(columns), len(expected))
+	}
+	for i, column := range columns {
+		if column.Name != expected[i].name || column.Type != expected[i].sqlType || column.Value(r) != expected[i].value {
+			t.Errorf("column %d: got %s %s %q, want %+v", i, column.Name, column.Type, column.Value(r), expected[i])
+		}
+	}
+
+	if got := columns[2].Value(&row{inner: &inner{}}); got != "" {
+		t.Errorf("expected nil to be empty, got %q", got)
+	}
+}
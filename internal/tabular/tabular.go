@@ -0,0 +1,70 @@
+// Package tabular streams rows of text as CSV or as an Excel (XLSX)
+// workbook, writing each row as it is given rather than buffering them.
+package tabular
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// flushEvery is how many rows are buffered before they are flushed to the
+// underlying writer.
+const flushEvery = 100
+
+// number matches a plain decimal number, which a spreadsheet reads as such,
+// rather than as a formula, even with a leading sign.
+var number = regexp.MustCompile(`^[-+]?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?$`)
+
+// Writer writes rows, the first of which is usually the header. Close must be
+// called to complete the output.
+type Writer interface {
+	Write(row []string) error
+	Close() error
+}
+
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (writer *csvWriter) Write(row []string) error {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		escaped[i] = escapeFormula(cell)
+	}
+
+	if err := writer.w.Write(escaped); err != nil {
+		return errors.Wrap(err, "failed to write CSV row")
+	}
+
+	writer.rows++
+	if writer.rows%flushEvery == 0 {
+		writer.w.Flush()
+		return writer.w.Error()
+	}
+	return nil
+}
+
+func (writer *csvWriter) Close() error {
+	writer.w.Flush()
+	return writer.w.Error()
+}
+
+// escapeFormula prefixes a cell that a spreadsheet would evaluate as a formula
+// with a quote, so that text from Street Manager, such as a street name
+// starting with '=', is shown as it is rather than run when the CSV is opened.
+// XLSX cells are always strings, so need no such escaping.
+func escapeFormula(cell string) string {
+	if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) || number.MatchString(cell) {
+		return cell
+	}
+	return "'" + cell
+}
@@ -0,0 +1,154 @@
+package tabular
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+var rows = [][]string{
+	{"object_reference", "street_name", "permit_conditions"},
+	{"P1", "High Street, North", `NCT01a "quoted"`},
+	{"P2", "", "<none> & more\nlines"},
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "object_reference,street_name,permit_conditions\n" +
+		"P1,\"High Street, North\",\"NCT01a \"\"quoted\"\"\"\n" +
+		"P2,,\"<none> & more\nlines\"\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		cell     string
+		expected string
+	}{
+		{cell: "=HYPERLINK(\"http://example.com\")", expected: "'=HYPERLINK(\"http://example.com\")"},
+		{cell: "+44 20 7946 0000", expected: "'+44 20 7946 0000"},
+		{cell: "-2+3", expected: "'-2+3"},
+		{cell: "@SUM(A1:A2)", expected: "'@SUM(A1:A2)"},
+		{cell: "\t=1", expected: "'\t=1"},
+		{cell: "-0.1278", expected: "-0.1278"},
+		{cell: "+1.5e3", expected: "+1.5e3"},
+		{cell: "High Street = A1", expected: "High Street = A1"},
+		{cell: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cell, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewCSVWriter(&buf)
+			if err := w.Write([]string{"P1", tt.cell}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := records[0][1]; got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf, "Search & results")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a valid zip: %v", err)
+	}
+
+	parts := make(map[string]string)
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		parts[file.Name] = string(content)
+
+		// Every part must be well-formed XML
+		dec := xml.NewDecoder(strings.NewReader(string(content)))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %v", file.Name, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Search &amp; results"`) {
+		t.Errorf("expected escaped sheet name, got %s", parts["xl/workbook.xml"])
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Style string `xml:"s,attr"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/worksheets/sheet1.xml"]), &sheet); err != nil {
+		t.Fatalf("failed to parse sheet: %v", err)
+	}
+
+	if len(sheet.Rows) != len(rows) {
+		t.Fatalf("got %d rows, want %d", len(sheet.Rows), len(rows))
+	}
+	for r, row := range rows {
+		for c, value := range row {
+			cell := sheet.Rows[r].Cells[c]
+			if cell.Text != value {
+				t.Errorf("cell %d,%d: got %q, want %q", r, c, cell.Text, value)
+			}
+			if isHeader := cell.Style == "1"; isHeader != (r == 0 && value != "") {
+				t.Errorf("cell %d,%d: unexpected style %q", r, c, cell.Style)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tabular
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// The minimal set of parts for a single-sheet SpreadsheetML workbook, per
+// ECMA-376. Cells are written as inline strings, so no shared string table
+// (which would require every row to be held until the end) is needed.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font/><font><b/></font></fonts>` +
+		`<fills count="1"><fill/></fills>` +
+		`<borders count="1"><border/></borders>` +
+		`<cellStyleXfs count="1"><xf/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf/><xf fontId="1" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+const (
+	sheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`
+	sheetEnd = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// NewXLSXWriter starts a workbook with a single sheet, in which the first row
+// written is styled and frozen as a header.
+func NewXLSXWriter(w io.Writer, sheetName string) (Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		if err := writePart(zw, part.name, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	workbook := xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + escape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	if err := writePart(zw, "xl/workbook.xml", workbook); err != nil {
+		return nil, err
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create worksheet")
+	}
+
+	writer := &xlsxWriter{zw: zw, sheet: bufio.NewWriter(sheet)}
+	if _, err := writer.sheet.WriteString(sheetStart); err != nil {
+		return nil, errors.Wrap(err, "failed to write worksheet")
+	}
+	return writer, nil
+}
+
+func (writer *xlsxWriter) Write(row []string) error {
+	style := ""
+	if writer.rows == 0 {
+		style = ` s="1"`
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<row>")
+	for _, value := range row {
+		if value == "" {
+			sb.WriteString("<c/>")
+			continue
+		}
+		sb.WriteString(`<c t="inlineStr"` + style + `><is><t xml:space="preserve">`)
+		sb.WriteString(escape(value))
+		sb.WriteString("</t></is></c>")
+	}
+	sb.WriteString("</row>")
+
+	if _, err := writer.sheet.WriteString(sb.String()); err != nil {
+		return errors.Wrap(err, "failed to write XLSX row")
+	}
+
+	writer.rows++
+	if writer.rows%flushEvery == 0 {
+		if err := writer.sheet.Flush(); err != nil {
+			return errors.Wrap(err, "failed to write XLSX row")
+		}
+		return errors.Wrap(writer.zw.Flush(), "failed to write XLSX row")
+	}
+	return nil
+}
+
+func (writer *xlsxWriter) Close() error {
+	if _, err := writer.sheet.WriteString(sheetEnd); err != nil {
+		return errors.Wrap(err, "failed to write worksheet")
+	}
+	if err := writer.sheet.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write worksheet")
+	}
+	return errors.Wrap(writer.zw.Close(), "failed to complete workbook")
+}
+
+func writePart(zw *zip.Writer, name string, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", name)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+// escape makes text safe for XML, replacing any characters which XML cannot
+// represent.
+func escape(text string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(text))
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestTemporalWindowAgreesWithIncludes(t *testing.T) {
+	repo := newTestRepo(t)
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	filters := &models.TemporalFilters{MaxDaysAhead: 7, MaxDaysBehind: 2}
+
+	events := map[string]*models.Event{
+		"Starts just before the end": {ProposedStartDate: ptr(today.AddDate(0, 0, 7).Add(-time.Minute))},
+		"Starts at the end":          {ProposedStartDate: ptr(today.AddDate(0, 0, 7))},
+		"Ends at the start":          {ProposedStartDate: ptr(today.AddDate(0, 0, -5)), ProposedEndDate: ptr(today.AddDate(0, 0, -2))},
+		"Ends just before the start": {ProposedStartDate: ptr(today.AddDate(0, 0, -5)), ProposedEndDate: ptr(today.AddDate(0, 0, -2).Add(-time.Minute))},
+	}
+	all := make([]*models.Event, 0, len(events))
+	for name, event := range events {
+		event.ObjectReference, event.EventType = name, "PERMIT_GRANTED"
+		event.WorksLocationCoordinates = ptr("POINT(530100 180100)")
+		all = append(all, event)
+	}
+	upsert(t, repo, all...)
+
+	found, err := repo.Search(&models.BBox{MinX: 530000, MinY: 180000, MaxX: 531000, MaxY: 181000}, "", nil, filters)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("got %d events, want those starting just before the end and ending at the start", len(found))
+	}
+	searched := make(map[string]bool)
+	for _, event := range found {
+		searched[event.ObjectReference] = true
+	}
+
+	for name, event := range events {
+		t.Run(name, func(t *testing.T) {
+			if includes := filters.Includes(event, now); includes != searched[name] {
+				t.Errorf("got Includes %v, but searched %v", includes, searched[name])
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestTextSearchFollowsUpserts(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	end := start.Add(24 * time.Hour)
+	event := func(ref string, eventReference int64, street string, town string) *models.Event {
+		eventTime := start.Add(time.Duration(eventReference) * time.Minute)
+		return &models.Event{
+			ObjectReference: ref, EventType: "PERMIT_GRANTED", EventReference: ptr(eventReference), EventTime: &eventTime,
+			StreetName: ptr(street), Town: ptr(town), PermitReferenceNumber: ptr(ref),
+			WorksLocationCoordinates: ptr("POINT(530100 180100)"), ProposedStartDate: &start, ProposedEndDate: &end,
+		}
+	}
+
+	search := func(t *testing.T, text string) []string {
+		t.Helper()
+		events, err := repo.Search(nil, text, nil, &models.TemporalFilters{MaxDaysAhead: 7})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		refs := make([]string, len(events))
+		for idx, event := range events {
+			refs[idx] = event.ObjectReference
+		}
+		slices.Sort(refs)
+		return refs
+	}
+
+	upsert(t, repo,
+		event("W1-01", 1, "HIGH STREET", "Barnet"),
+		event("W2-01", 2, "STATION ROAD", "Barnet"),
+	)
+	// The street of the first is corrected by a later event
+	upsert(t, repo, event("W1-01", 3, "CHURCH LANE", "Barnet"))
+
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "church", expected: []string{"W1-01"}},
+		{text: "chur", expected: []string{"W1-01"}},
+		{text: "church lane", expected: []string{"W1-01"}},
+		{text: "high", expected: []string{}},
+		{text: "station road", expected: []string{"W2-01"}},
+		{text: "church road", expected: []string{}},
+		{text: "barnet", expected: []string{"W1-01", "W2-01"}},
+		{text: "W2-01", expected: []string{"W2-01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if refs := search(t, tt.text); !slices.Equal(refs, tt.expected) {
+				t.Errorf("got %v, want %v", refs, tt.expected)
+			}
+		})
+	}
+}
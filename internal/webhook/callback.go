@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	// Carrier-grade NAT, which some clouds also use for metadata services
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	thisNetwork        = netip.MustParsePrefix("0.0.0.0/8")
+)
+
+// lookupHost resolves the host of a callback URL, replaced by the tests.
+var lookupHost = net.DefaultResolver.LookupNetIP
+
+// disallowed reports whether callbacks must not be sent to an address: i.e.
+// the server itself, a private network, or a link-local address such as a
+// cloud metadata service (169.254.169.254), any of which would let
+// subscribers probe the network the relay runs in.
+func disallowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr) ||
+		thisNetwork.Contains(addr)
+}
+
+// CheckCallbackURL parses a callback URL, which must be an absolute http(s)
+// URL whose host only resolves to public addresses.
+func CheckCallbackURL(ctx context.Context, rawURL string) (*url.URL, error) {
+	callbackURL, err := url.Parse(rawURL)
+	if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Hostname() == "" {
+		return nil, errors.New("callback_url must be an absolute http or https URL")
+	}
+
+	addrs, err := lookupHost(ctx, "ip", callbackURL.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return nil, errors.Newf("callback_url host %s could not be resolved", callbackURL.Hostname())
+	}
+	for _, addr := range addrs {
+		if disallowed(addr) {
+			return nil, errors.New("callback_url must not resolve to a loopback, private or link-local address")
+		}
+	}
+	return callbackURL, nil
+}
+
+// newClient creates the client callbacks are posted with, which checks every
+// address it connects to (including after redirects), as the host may resolve
+// differently than when the subscription was registered. Proxies are not
+// used, as the check would then only apply to the proxy.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func checkDial(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "unexpected address %s", address)
+	}
+	if disallowed(addrPort.Addr()) {
+		return errors.Newf("callback address %s is not allowed", addrPort.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+func TestCheckCallbackURL(t *testing.T) {
+	hosts := map[string][]netip.Addr{
+		"example.com":      {netip.MustParseAddr("93.184.215.14")},
+		"rebind.test":      {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.1")},
+		"metadata.test":    {netip.MustParseAddr("169.254.169.254")},
+		"mapped.test":      {netip.MustParseAddr("::ffff:127.0.0.1")},
+		"ipv6.test":        {netip.MustParseAddr("2606:2800:21f:cb07:6820:80da:af6b:8b2c")},
+		"unique-v6.test":   {netip.MustParseAddr("fd00:ec2::254")},
+		"cgnat.test":       {netip.MustParseAddr("100.100.100.200")},
+		"unspecified.test": {netip.MustParseAddr("0.0.0.0")},
+	}
+	lookup := lookupHost
+	lookupHost = func(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			return []netip.Addr{addr}, nil
+		}
+		if addrs, ok := hosts[host]; ok {
+			return addrs, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	t.Cleanup(func() { lookupHost = lookup })
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{url: "https://example.com/roadworks", allowed: true},
+		{url: "http://ipv6.test:8080/", allowed: true},
+		{url: "https://93.184.215.14/", allowed: true},
+		{url: "ftp://example.com/", allowed: false},
+		{url: "/roadworks", allowed: false},
+		{url: "https://unknown.test/", allowed: false},
+		{url: "http://127.0.0.1:8080/", allowed: false},
+		{url: "http://[::1]/", allowed: false},
+		{url: "http://192.168.1.10/", allowed: false},
+		{url: "http://169.254.169.254/latest/meta-data/", allowed: false},
+		{url: "http://metadata.test/", allowed: false},
+		{url: "http://rebind.test/", allowed: false},
+		{url: "http://mapped.test/", allowed: false},
+		{url: "http://unique-v6.test/", allowed: false},
+		{url: "http://cgnat.test/", allowed: false},
+		{url: "http://unspecified.test/", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := CheckCallbackURL(context.Background(), tt.url)
+			if tt.allowed && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestClientRefusesDisallowedAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}))
+	t.Cleanup(receiver.Close)
+
+	_, err := newClient(time.Second).Post(receiver.URL, "application/json", strings.NewReader("{}"))
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("expected the address to be refused, got %v", err)
+	}
+}
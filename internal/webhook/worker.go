@@ -0,0 +1,197 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal/stream"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const (
+	SignatureHeader = "X-Signature-256"
+	DeliveryHeader  = "X-Delivery-ID"
+	KindHeader      = "X-Change-Kind"
+
+	batchSize = 100
+)
+
+// Store persists the subscriptions and their deliveries.
+type Store interface {
+	EnqueueWebhookDeliveries(limit int) (int, error)
+	PendingWebhookDeliveries(now time.Time, limit int) ([]*models.PendingDelivery, error)
+	RecordWebhookAttempt(delivery *models.WebhookDelivery) error
+}
+
+// Worker matches changes against the webhook subscriptions and delivers them,
+// retrying failed deliveries with exponential backoff.
+type Worker struct {
+	store        Store
+	client       *http.Client
+	pollInterval time.Duration
+	maxAttempts  int
+	backoff      func(attempts int) time.Duration
+	now          func() time.Time
+}
+
+func NewWorker(store Store) *Worker {
+	return &Worker{
+		store:        store,
+		client:       newClient(10 * time.Second),
+		pollInterval: 10 * time.Second,
+		maxAttempts:  8,
+		backoff:      ExponentialBackoff(30*time.Second, 6*time.Hour),
+		now:          time.Now,
+	}
+}
+
+// ExponentialBackoff doubles the delay after each failed attempt, up to a maximum.
+func ExponentialBackoff(initial time.Duration, maximum time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		delay := initial
+		for i := 1; i < attempts && delay < maximum; i++ {
+			delay *= 2
+		}
+		return min(delay, maximum)
+	}
+}
+
+// Sign computes the signature of a payload, sent as "sha256=<hex digest>" in
+// the X-Signature-256 header, which receivers should verify using the secret
+// returned when subscribing.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run processes deliveries until the context is cancelled, both periodically
+// (for retries) and as soon as changes are published.
+func (worker *Worker) Run(ctx context.Context, broker *stream.Broker) {
+	ticker := time.NewTicker(worker.pollInterval)
+	defer ticker.Stop()
+
+	sub := broker.Subscribe()
+	defer func() { sub.Close() }()
+
+	for {
+		if err := worker.RunOnce(ctx); err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case _, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, which is harmless as changes are read from the history
+				sub = broker.Subscribe()
+			}
+		}
+	}
+}
+
+// RunOnce queues deliveries for any new changes, and attempts those that are due.
+func (worker *Worker) RunOnce(ctx context.Context) error {
+	for {
+		processed, err := worker.store.EnqueueWebhookDeliveries(batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to enqueue webhook deliveries")
+		}
+		if processed < batchSize {
+			break
+		}
+	}
+
+	for {
+		pending, err := worker.store.PendingWebhookDeliveries(worker.now(), batchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to read pending webhook deliveries")
+		}
+
+		for _, delivery := range pending {
+			if ctx.Err() != nil {
+				return nil
+			}
+			worker.attempt(ctx, delivery)
+			if err := worker.store.RecordWebhookAttempt(delivery.WebhookDelivery); err != nil {
+				return errors.Wrap(err, "failed to record webhook attempt")
+			}
+		}
+
+		if len(pending) < batchSize {
+			return nil
+		}
+	}
+}
+
+// attempt posts the payload, updating the delivery with the outcome.
+func (worker *Worker) attempt(ctx context.Context, delivery *models.PendingDelivery) {
+	statusCode, err := worker.post(ctx, delivery)
+
+	now := worker.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = nil
+	delivery.Error = nil
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+	}
+
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	message := err.Error()
+	delivery.Error = &message
+	if delivery.Attempts >= worker.maxAttempts {
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	next := now.Add(worker.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+func (worker *Worker) post(ctx context.Context, delivery *models.PendingDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "street-manager-relay")
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, payload))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(KindHeader, delivery.Kind)
+
+	resp, err := worker.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to send request")
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("error closing response body: %v", err)
+		}
+	}()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Newf("callback responded with HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+type fakeStore struct {
+	deliveries []*models.PendingDelivery
+	recorded   int
+}
+
+func (store *fakeStore) EnqueueWebhookDeliveries(limit int) (int, error) {
+	return 0, nil
+}
+
+func (store *fakeStore) PendingWebhookDeliveries(now time.Time, limit int) ([]*models.PendingDelivery, error) {
+	pending := make([]*models.PendingDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			pending = append(pending, delivery)
+		}
+	}
+	return pending, nil
+}
+
+func (store *fakeStore) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	store.recorded++
+	return nil
+}
+
+func newFixture(t *testing.T, handler http.HandlerFunc) (*Worker, *fakeStore, *time.Time) {
+	receiver := httptest.NewServer(handler)
+	t.Cleanup(receiver.Close)
+
+	now := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	store := &fakeStore{deliveries: []*models.PendingDelivery{{
+		WebhookDelivery: &models.WebhookDelivery{
+			ID:            42,
+			Kind:          models.ChangeCreated,
+			Payload:       `{"kind":"create"}`,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+		},
+		CallbackURL: receiver.URL,
+		Secret:      "s3cret",
+	}}}
+
+	worker := NewWorker(store)
+	// The receiver is on loopback, which the default client refuses
+	worker.client = receiver.Client()
+	worker.maxAttempts = 3
+	worker.backoff = ExponentialBackoff(time.Minute, time.Hour)
+	worker.now = func() time.Time { return now }
+	return worker, store, &now
+}
+
+func TestWorkerDeliversSignedPayload(t *testing.T) {
+	worker, store, _ := newFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, expected := r.Header.Get(SignatureHeader), Sign("s3cret", body); got != expected {
+			t.Errorf("got signature %s, want %s", got, expected)
+		}
+		if got := r.Header.Get(DeliveryHeader); got != "42" {
+			t.Errorf("got delivery id %s, want 42", got)
+		}
+		if got := r.Header.Get(KindHeader); got != models.ChangeCreated {
+			t.Errorf("got kind %s, want %s", got, models.ChangeCreated)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	delivery := store.deliveries[0]
+	if delivery.Status != models.DeliveryDelivered {
+		t.Errorf("got status %s, want %s", delivery.Status, models.DeliveryDelivered)
+	}
+	if delivery.Attempts != 1 || store.recorded != 1 {
+		t.Errorf("got %d attempts and %d recorded, want 1", delivery.Attempts, store.recorded)
+	}
+	if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("got response status %v, want %d", delivery.ResponseStatus, http.StatusNoContent)
+	}
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	worker, store, now := newFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	delivery := store.deliveries[0]
+
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.Error == nil {
+		t.Fatalf("expected a pending retry after the first failure, got %+v", delivery.WebhookDelivery)
+	}
+	if expected := now.Add(time.Minute); !delivery.NextAttemptAt.Equal(expected) {
+		t.Errorf("got next attempt at %v, want %v", delivery.NextAttemptAt, expected)
+	}
+
+	// Not yet due
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delivery.Attempts != 1 {
+		t.Errorf("got %d attempts before the backoff elapsed, want 1", delivery.Attempts)
+	}
+
+	*now = now.Add(time.Minute)
+	failing.Store(false)
+	if err := worker.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 2 || delivery.Error != nil {
+		t.Errorf("expected delivery on the second attempt, got %+v", delivery.WebhookDelivery)
+	}
+}
+
+func TestWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	worker, store, now := newFixture(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	delivery := store.deliveries[0]
+
+	for range worker.maxAttempts {
+		if err := worker.RunOnce(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		*now = now.Add(time.Hour)
+	}
+
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != worker.maxAttempts || delivery.NextAttemptAt != nil {
+		t.Errorf("expected delivery to have failed, got %+v", delivery.WebhookDelivery)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(30*time.Second, 10*time.Minute)
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 3, expected: 2 * time.Minute},
+		{attempts: 5, expected: 8 * time.Minute},
+		{attempts: 6, expected: 10 * time.Minute},
+		{attempts: 50, expected: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.expected {
+			t.Errorf("attempt %d: got %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
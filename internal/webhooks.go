@@ -0,0 +1,407 @@
+package internal
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+const subscriptionColumns = `id, callback_url, area, facets, created_at, updated_at, api_key_id`
+
+const deliveryColumns = `d.id, d.subscription_id, d.history_id, d.object_reference, d.kind, d.payload, d.status,
+	d.attempts, d.next_attempt_at, d.last_attempt_at, d.response_status, d.error, d.created_at`
+
+// CreateWebhookSubscription stores a new subscription, owned by its API key,
+// which is matched against the changes recorded from then on.
+func (repo *DbRepository) CreateWebhookSubscription(sub *models.WebhookSubscription) error {
+	facets, err := facetsJSON(sub.Facets)
+	if err != nil {
+		return err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	// Changes are matched from when the first subscription is created
+	_, err = tx.Exec(`INSERT OR IGNORE INTO webhook_cursor (id, last_history_id) SELECT 1, COALESCE(MAX(id), 0) FROM event_history`)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialise webhook cursor")
+	}
+
+	now := time.Now().UTC()
+	err = tx.QueryRow(`
+		INSERT INTO webhook_subscriptions (callback_url, secret, area, facets, created_at, updated_at, api_key_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		sub.CallbackURL, sub.Secret, sub.Area, facets, now, now, sub.APIKeyID,
+	).Scan(&sub.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert webhook subscription")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	sub.CreatedAt, sub.UpdatedAt = now, now
+	return nil
+}
+
+// WebhookSubscriptions lists the subscriptions owned by an API key (or those
+// without an owner, given nil), without their secrets.
+func (repo *DbRepository) WebhookSubscriptions(apiKeyID *int64) ([]*models.WebhookSubscription, error) {
+	return repo.webhookSubscriptions(`WHERE api_key_id IS ?`, apiKeyID)
+}
+
+func (repo *DbRepository) webhookSubscriptions(where string, params ...any) ([]*models.WebhookSubscription, error) {
+	rows, err := repo.db.Query(`SELECT `+subscriptionColumns+` FROM webhook_subscriptions `+where+` ORDER BY id`, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query webhook subscriptions")
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	subs := make([]*models.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if errors.Is(err, errInvalidSubscription) {
+			// One bad row mustn't stop the rest from being listed or matched
+			log.Printf("Skipping webhook subscription: %v", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over rows")
+	}
+	return subs, nil
+}
+
+// FindWebhookSubscription returns a subscription owned by the API key without
+// its secret, or nil if it does not exist or has another owner.
+func (repo *DbRepository) FindWebhookSubscription(id int64, apiKeyID *int64) (*models.WebhookSubscription, error) {
+	row := repo.db.QueryRow(`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = ? AND api_key_id IS ?`, id, apiKeyID)
+	sub, err := scanWebhookSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// UpdateWebhookSubscription replaces the callback URL, area and facets of a
+// subscription (but not its secret or owner), returning false if it does not
+// exist or is not owned by the subscription's API key.
+func (repo *DbRepository) UpdateWebhookSubscription(sub *models.WebhookSubscription) (bool, error) {
+	facets, err := facetsJSON(sub.Facets)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	err = repo.db.QueryRow(`
+		UPDATE webhook_subscriptions SET callback_url = ?, area = ?, facets = ?, updated_at = ?
+		WHERE id = ? AND api_key_id IS ?
+		RETURNING created_at`,
+		sub.CallbackURL, sub.Area, facets, now, sub.ID, sub.APIKeyID,
+	).Scan(&sub.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to update webhook subscription")
+	}
+
+	sub.UpdatedAt = now
+	return true, nil
+}
+
+// DeleteWebhookSubscription deletes a subscription owned by the API key and
+// its delivery log, returning false if it does not exist or has another owner.
+func (repo *DbRepository) DeleteWebhookSubscription(id int64, apiKeyID *int64) (bool, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	result, err := tx.Exec(`DELETE FROM webhook_subscriptions WHERE id = ? AND api_key_id IS ?`, id, apiKeyID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to delete webhook subscription")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to count deleted rows")
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE subscription_id = ?`, id); err != nil {
+		return false, errors.Wrap(err, "failed to delete webhook deliveries")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "failed to commit transaction")
+	}
+	return true, nil
+}
+
+// WebhookDeliveries returns the most recent deliveries for a subscription.
+func (repo *DbRepository) WebhookDeliveries(subscriptionID int64, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := repo.db.Query(`SELECT `+deliveryColumns+` FROM webhook_deliveries d WHERE d.subscription_id = ? ORDER BY d.id DESC LIMIT ?`, subscriptionID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query webhook deliveries")
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over rows")
+	}
+	return deliveries, nil
+}
+
+// EnqueueWebhookDeliveries matches up to limit of the changes recorded since
+// it was last run against the subscriptions, queueing a delivery for each
+// match. It returns the number of changes processed.
+func (repo *DbRepository) EnqueueWebhookDeliveries(limit int) (int, error) {
+	var cursor int64
+	err := repo.db.QueryRow(`SELECT last_history_id FROM webhook_cursor WHERE id = 1`).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		// No subscription has been created yet
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read webhook cursor")
+	}
+
+	changes, err := repo.ChangesSince(cursor, nil, nil, limit)
+	if err != nil || len(changes) == 0 {
+		return 0, err
+	}
+
+	matchers, err := repo.webhookMatchers()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	now := time.Now().UTC()
+	for _, change := range changes {
+		for _, matcher := range matchers {
+			if !matcher.area.IntersectsEvent(change.Event) || !matcher.facets.Matches(change.Event) {
+				continue
+			}
+
+			payload, err := json.Marshal(models.WebhookPayload{
+				SubscriptionID:  matcher.id,
+				HistoryID:       change.ID,
+				Kind:            change.Kind,
+				ObjectReference: change.Event.ObjectReference,
+				Event:           change.Event,
+			})
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to marshal webhook payload")
+			}
+
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO webhook_deliveries
+					(subscription_id, history_id, object_reference, kind, payload, status, next_attempt_at, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				matcher.id, change.ID, change.Event.ObjectReference, change.Kind, string(payload), models.DeliveryPending, now, now)
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to insert webhook delivery")
+			}
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE webhook_cursor SET last_history_id = ? WHERE id = 1`, changes[len(changes)-1].ID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to update webhook cursor")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit transaction")
+	}
+	return len(changes), nil
+}
+
+// PendingWebhookDeliveries returns up to limit of the deliveries due to be
+// attempted by now, oldest first.
+func (repo *DbRepository) PendingWebhookDeliveries(now time.Time, limit int) ([]*models.PendingDelivery, error) {
+	rows, err := repo.db.Query(`
+		SELECT `+deliveryColumns+`, s.callback_url, s.secret
+		FROM webhook_deliveries d
+		INNER JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`,
+		models.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query pending webhook deliveries")
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}()
+
+	pending := make([]*models.PendingDelivery, 0)
+	for rows.Next() {
+		var p models.PendingDelivery
+		if p.WebhookDelivery, err = scanWebhookDelivery(rows, &p.CallbackURL, &p.Secret); err != nil {
+			return nil, err
+		}
+		pending = append(pending, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error iterating over rows")
+	}
+	return pending, nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt to deliver a change.
+func (repo *DbRepository) RecordWebhookAttempt(delivery *models.WebhookDelivery) error {
+	_, err := repo.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, response_status = ?, error = ?
+		WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt,
+		delivery.ResponseStatus, delivery.Error, delivery.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to record webhook attempt")
+	}
+	return nil
+}
+
+type webhookMatcher struct {
+	id     int64
+	area   *models.Area
+	facets models.Facets
+}
+
+func (repo *DbRepository) webhookMatchers() ([]*webhookMatcher, error) {
+	subs, err := repo.webhookSubscriptions("")
+	if err != nil {
+		return nil, err
+	}
+
+	// A subscription that was valid when stored may no longer be, e.g. if one
+	// of its facets has since been removed, but the others must still be
+	// matched, or the cursor would never advance for anyone
+	matchers := make([]*webhookMatcher, 0, len(subs))
+	for _, sub := range subs {
+		area, err := models.AreaFromWKT(sub.Area)
+		if err != nil {
+			log.Printf("Skipping webhook subscription %d with an invalid area: %v", sub.ID, err)
+			continue
+		}
+		facets, err := models.FacetsFromMap(sub.Facets)
+		if err != nil {
+			log.Printf("Skipping webhook subscription %d with invalid facets: %v", sub.ID, err)
+			continue
+		}
+		matchers = append(matchers, &webhookMatcher{id: sub.ID, area: area, facets: facets})
+	}
+	return matchers, nil
+}
+
+// errInvalidSubscription marks a stored subscription that can't be read.
+var errInvalidSubscription = errors.New("invalid webhook subscription")
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhookSubscription(row scanner) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	var facets sql.NullString
+	if err := row.Scan(&sub.ID, &sub.CallbackURL, &sub.Area, &facets, &sub.CreatedAt, &sub.UpdatedAt, &sub.APIKeyID); err != nil {
+		return nil, errors.Wrap(err, "failed to scan webhook subscription")
+	}
+
+	if facets.Valid {
+		if err := json.Unmarshal([]byte(facets.String), &sub.Facets); err != nil {
+			return nil, errors.Mark(errors.Wrapf(err, "failed to unmarshal facets of webhook subscription %d", sub.ID), errInvalidSubscription)
+		}
+	}
+	return &sub, nil
+}
+
+func scanWebhookDelivery(row scanner, extra ...any) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	dest := []any{
+		&delivery.ID,
+		&delivery.SubscriptionID,
+		&delivery.HistoryID,
+		&delivery.ObjectReference,
+		&delivery.Kind,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.Error,
+		&delivery.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, errors.Wrap(err, "failed to scan webhook delivery")
+	}
+	return &delivery, nil
+}
+
+func facetsJSON(facets map[string][]string) (any, error) {
+	if len(facets) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(facets)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal facets")
+	}
+	return string(data), nil
+}
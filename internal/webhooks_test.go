@@ -0,0 +1,132 @@
+//go:build sqlite_rtree && sqlite_fts5
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rm-hull/street-manager-relay/models"
+)
+
+func TestWebhookSubscriptionsAreScopedToTheirKey(t *testing.T) {
+	repo := newTestRepo(t)
+	alice, bob := ptr(int64(1)), ptr(int64(2))
+
+	subs := map[string]*models.WebhookSubscription{
+		"alice":   {CallbackURL: "https://alice.example.com", Secret: "a", Area: "POLYGON((0 0, 1 0, 1 1, 0 0))", APIKeyID: alice},
+		"bob":     {CallbackURL: "https://bob.example.com", Secret: "b", Area: "POLYGON((0 0, 1 0, 1 1, 0 0))", APIKeyID: bob},
+		"unowned": {CallbackURL: "https://open.example.com", Secret: "c", Area: "POLYGON((0 0, 1 0, 1 1, 0 0))"},
+	}
+	for _, name := range []string{"alice", "bob", "unowned"} {
+		if err := repo.CreateWebhookSubscription(subs[name]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		apiKeyID *int64
+		expected string
+	}{
+		{name: "Alice", apiKeyID: alice, expected: "https://alice.example.com"},
+		{name: "Bob", apiKeyID: bob, expected: "https://bob.example.com"},
+		{name: "No key", apiKeyID: nil, expected: "https://open.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, err := repo.WebhookSubscriptions(tt.apiKeyID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(listed) != 1 || listed[0].CallbackURL != tt.expected {
+				t.Errorf("got %+v, want only %s", listed, tt.expected)
+			}
+		})
+	}
+
+	t.Run("Others' subscriptions", func(t *testing.T) {
+		id := subs["alice"].ID
+		if sub, err := repo.FindWebhookSubscription(id, bob); err != nil || sub != nil {
+			t.Errorf("expected no subscription, got %+v, %v", sub, err)
+		}
+
+		update := *subs["alice"]
+		update.CallbackURL, update.APIKeyID = "https://bob.example.com/stolen", bob
+		if found, err := repo.UpdateWebhookSubscription(&update); err != nil || found {
+			t.Errorf("expected no update, got %v, %v", found, err)
+		}
+
+		if found, err := repo.DeleteWebhookSubscription(id, bob); err != nil || found {
+			t.Errorf("expected no delete, got %v, %v", found, err)
+		}
+
+		sub, err := repo.FindWebhookSubscription(id, alice)
+		if err != nil || sub == nil || sub.CallbackURL != "https://alice.example.com" {
+			t.Errorf("expected the subscription to be unchanged, got %+v, %v", sub, err)
+		}
+	})
+
+	t.Run("Own subscription", func(t *testing.T) {
+		if found, err := repo.DeleteWebhookSubscription(subs["bob"].ID, bob); err != nil || !found {
+			t.Errorf("expected a delete, got %v, %v", found, err)
+		}
+	})
+}
+
+func TestEnqueueWebhookDeliveriesSkipsInvalidSubscriptions(t *testing.T) {
+	repo := newTestRepo(t)
+	area := "POLYGON((530000 180000, 531000 180000, 531000 181000, 530000 181000, 530000 180000))"
+
+	subs := make(map[string]*models.WebhookSubscription)
+	for _, name := range []string{"valid", "removed facet", "malformed facets", "invalid area"} {
+		subs[name] = &models.WebhookSubscription{CallbackURL: "https://" + strings.ReplaceAll(name, " ", "-") + ".example.com", Secret: "s", Area: area}
+		if err := repo.CreateWebhookSubscription(subs[name]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// As if stored before the facet was removed, or by hand
+	for name, update := range map[string]string{
+		"removed facet":    `UPDATE webhook_subscriptions SET facets = '{"work_status":["planned"]}' WHERE id = ?`,
+		"malformed facets": `UPDATE webhook_subscriptions SET facets = '{' WHERE id = ?`,
+		"invalid area":     `UPDATE webhook_subscriptions SET area = 'POINT(530100 180100)' WHERE id = ?`,
+	} {
+		if _, err := repo.db.Exec(update, subs[name].ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	upsert(t, repo, &models.Event{
+		ObjectReference: "OBJ-A", EventType: "WORK_START", WorksLocationCoordinates: ptr("POINT(530100 180100)"),
+	})
+
+	processed, err := repo.EnqueueWebhookDeliveries(10)
+	if err != nil || processed != 1 {
+		t.Fatalf("got %d processed, %v, want 1", processed, err)
+	}
+
+	for name, sub := range subs {
+		deliveries, err := repo.WebhookDeliveries(sub.ID, 10)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected := map[bool]int{true: 1, false: 0}[name == "valid"]; len(deliveries) != expected {
+			t.Errorf("%s: got %d deliveries, want %d", name, len(deliveries), expected)
+		}
+	}
+
+	// The cursor has moved on past the change
+	if processed, err := repo.EnqueueWebhookDeliveries(10); err != nil || processed != 0 {
+		t.Errorf("got %d processed, %v, want none", processed, err)
+	}
+
+	listed, err := repo.WebhookSubscriptions(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(listed) != 3 {
+		t.Errorf("got %d subscriptions, want all but the one with malformed facets", len(listed))
+	}
+}
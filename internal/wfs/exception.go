@@ -0,0 +1,47 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Exception codes, as per OWS Common and the WFS 2.0 standard
+const (
+	MissingParameterValue     = "MissingParameterValue"
+	InvalidParameterValue     = "InvalidParameterValue"
+	OperationNotSupported     = "OperationNotSupported"
+	VersionNegotiationFailed  = "VersionNegotiationFailed"
+	OperationProcessingFailed = "OperationProcessingFailed"
+)
+
+type exceptionReport struct {
+	XMLName   xml.Name  `xml:"ows:ExceptionReport"`
+	Namespace string    `xml:"xmlns:ows,attr"`
+	Version   string    `xml:"version,attr"`
+	Lang      string    `xml:"xml:lang,attr"`
+	Exception exception `xml:"ows:Exception"`
+}
+
+type exception struct {
+	Code    string `xml:"exceptionCode,attr"`
+	Locator string `xml:"locator,attr,omitempty"`
+	Text    string `xml:"ows:ExceptionText"`
+}
+
+// WriteException writes an exception report, where the locator is usually
+// the name of the offending parameter.
+func WriteException(w io.Writer, code string, locator string, text string) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write exception report")
+	}
+
+	report := &exceptionReport{
+		Namespace: OWSNamespace,
+		Version:   Version,
+		Lang:      "en",
+		Exception: exception{Code: code, Locator: locator, Text: text},
+	}
+	return errors.Wrap(xml.NewEncoder(w).Encode(report), "failed to write exception report")
+}
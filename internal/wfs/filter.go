@@ -0,0 +1,190 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Filter is a parsed Filter Encoding 2.0 filter. Only the subset advertised
+// in the capabilities is supported: PropertyIsEqualTo and BBOX, either alone
+// or combined with And.
+type Filter struct {
+	Equals []*PropertyIsEqualTo
+	BBox   *Envelope
+}
+
+type PropertyIsEqualTo struct {
+	// ValueReference is the property name, without any prefix or path
+	ValueReference string
+	Literal        string
+	MatchCase      bool
+}
+
+// Matches reports whether a property value is equal to the literal.
+func (equals *PropertyIsEqualTo) Matches(value string) bool {
+	if equals.MatchCase {
+		return value == equals.Literal
+	}
+	return strings.EqualFold(value, equals.Literal)
+}
+
+// Envelope is a bounding box in the CRS given by SRSName, which is empty
+// if not specified.
+type Envelope struct {
+	SRSName string
+	MinX    float64
+	MinY    float64
+	MaxX    float64
+	MaxY    float64
+}
+
+// node is any XML element, for walking a filter without a schema.
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []*node    `xml:",any"`
+}
+
+func (n *node) attr(name string) (string, bool) {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func (n *node) child(names ...string) *node {
+	for _, child := range n.Children {
+		for _, name := range names {
+			if child.XMLName.Local == name {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// ParseFilter parses the FILTER parameter of a GetFeature request.
+func ParseFilter(text string) (*Filter, error) {
+	var root node
+	if err := xml.Unmarshal([]byte(text), &root); err != nil {
+		return nil, errors.Wrap(err, "malformed filter")
+	}
+	if root.XMLName.Local != "Filter" {
+		return nil, errors.Newf("expected a Filter, got %s", root.XMLName.Local)
+	}
+	if len(root.Children) != 1 {
+		return nil, errors.New("a Filter must have exactly one operator")
+	}
+
+	operators := root.Children
+	if and := root.Children[0]; and.XMLName.Local == "And" {
+		if len(and.Children) < 2 {
+			return nil, errors.New("And must have at least two operators")
+		}
+		operators = and.Children
+	}
+
+	filter := &Filter{}
+	for _, operator := range operators {
+		switch operator.XMLName.Local {
+		case "PropertyIsEqualTo":
+			equals, err := parsePropertyIsEqualTo(operator)
+			if err != nil {
+				return nil, err
+			}
+			filter.Equals = append(filter.Equals, equals)
+
+		case "BBOX":
+			if filter.BBox != nil {
+				return nil, errors.New("only one BBOX is supported")
+			}
+			envelope, err := parseBBox(operator)
+			if err != nil {
+				return nil, err
+			}
+			filter.BBox = envelope
+
+		default:
+			return nil, errors.Newf("unsupported filter operator %s", operator.XMLName.Local)
+		}
+	}
+	return filter, nil
+}
+
+func parsePropertyIsEqualTo(operator *node) (*PropertyIsEqualTo, error) {
+	// PropertyName is the FES 1.1 equivalent of ValueReference
+	reference := operator.child("ValueReference", "PropertyName")
+	literal := operator.child("Literal")
+	if reference == nil || literal == nil {
+		return nil, errors.New("PropertyIsEqualTo must have a ValueReference and a Literal")
+	}
+
+	equals := &PropertyIsEqualTo{
+		ValueReference: propertyName(reference.Content),
+		Literal:        literal.Content,
+		MatchCase:      true,
+	}
+	if matchCase, ok := operator.attr("matchCase"); ok {
+		var err error
+		if equals.MatchCase, err = strconv.ParseBool(matchCase); err != nil {
+			return nil, errors.Newf("invalid matchCase '%s'", matchCase)
+		}
+	}
+	return equals, nil
+}
+
+func parseBBox(operator *node) (*Envelope, error) {
+	envelope := operator.child("Envelope")
+	if envelope == nil {
+		return nil, errors.New("BBOX must have a gml:Envelope")
+	}
+
+	lower, upper := envelope.child("lowerCorner"), envelope.child("upperCorner")
+	if lower == nil || upper == nil {
+		return nil, errors.New("Envelope must have a lowerCorner and an upperCorner")
+	}
+
+	minX, minY, err := parseCorner(lower.Content)
+	if err != nil {
+		return nil, err
+	}
+	maxX, maxY, err := parseCorner(upper.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	srsName, _ := envelope.attr("srsName")
+	return &Envelope{SRSName: srsName, MinX: minX, MinY: minY, MaxX: maxX, MaxY: maxY}, nil
+}
+
+func parseCorner(text string) (float64, float64, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return 0, 0, errors.Newf("invalid corner '%s'", text)
+	}
+	x, errX := strconv.ParseFloat(fields[0], 64)
+	y, errY := strconv.ParseFloat(fields[1], 64)
+	if errX != nil || errY != nil {
+		return 0, 0, errors.Newf("invalid corner '%s'", text)
+	}
+	return x, y, nil
+}
+
+// propertyName strips any path and prefix from a value reference, e.g.
+// "smr:events/smr:usrn" is "usrn".
+func propertyName(reference string) string {
+	reference = strings.TrimSpace(reference)
+	if idx := strings.LastIndex(reference, "/"); idx >= 0 {
+		reference = reference[idx+1:]
+	}
+	if idx := strings.LastIndex(reference, ":"); idx >= 0 {
+		reference = reference[idx+1:]
+	}
+	return reference
+}
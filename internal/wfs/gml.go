@@ -0,0 +1,236 @@
+package wfs
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/twpayne/go-geom"
+)
+
+// Feature is a feature to be written, with its values in the same order as
+// the properties of its type. Empty values are left out, and a nil geometry
+// is written as nil.
+type Feature struct {
+	ID       string
+	Geometry geom.T
+	Values   []string
+}
+
+// FeatureCollection describes a GetFeature response.
+type FeatureCollection struct {
+	FeatureType *FeatureType
+	// SchemaURL is where the feature type schema can be retrieved, i.e. the
+	// DescribeFeatureType request
+	SchemaURL      string
+	NumberMatched  int
+	NumberReturned int
+	TimeStamp      time.Time
+}
+
+// FeatureCollectionWriter writes a GML 3.2 feature collection, one feature
+// at a time. Geometries are written in British National Grid, in the order
+// of their coordinates (easting, northing), which is also the EPSG axis order.
+type FeatureCollectionWriter struct {
+	enc         *xml.Encoder
+	featureType *FeatureType
+}
+
+// NewFeatureCollectionWriter starts a feature collection. When writing a
+// response to resultType=hits, it should be closed without any features.
+func NewFeatureCollectionWriter(w io.Writer, collection *FeatureCollection) (*FeatureCollectionWriter, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, errors.Wrap(err, "failed to write feature collection")
+	}
+
+	featureType := collection.FeatureType
+	enc := xml.NewEncoder(w)
+	start := element("wfs:FeatureCollection",
+		"xmlns:wfs", WFSNamespace,
+		"xmlns:gml", GMLNamespace,
+		"xmlns:xsi", "http://www.w3.org/2001/XMLSchema-instance",
+		"xmlns:"+featureType.Prefix, featureType.Namespace,
+		"xsi:schemaLocation", strings.Join([]string{
+			WFSNamespace, "http://schemas.opengis.net/wfs/2.0/wfs.xsd",
+			GMLNamespace, "http://schemas.opengis.net/gml/3.2.1/gml.xsd",
+			featureType.Namespace, collection.SchemaURL,
+		}, " "),
+		"timeStamp", collection.TimeStamp.UTC().Format(time.RFC3339),
+		"numberMatched", strconv.Itoa(collection.NumberMatched),
+		"numberReturned", strconv.Itoa(collection.NumberReturned),
+	)
+	if err := enc.EncodeToken(start); err != nil {
+		return nil, errors.Wrap(err, "failed to write feature collection")
+	}
+	return &FeatureCollectionWriter{enc: enc, featureType: featureType}, nil
+}
+
+func (writer *FeatureCollectionWriter) WriteFeature(feature *Feature) error {
+	featureType := writer.featureType
+	if len(feature.Values) != len(featureType.Properties) {
+		return errors.Newf("expected %d values, got %d", len(featureType.Properties), len(feature.Values))
+	}
+
+	id := NCName(featureType.Name + "." + feature.ID)
+	typeName := featureType.QualifiedName()
+	t := &tokens{}
+	t.start("wfs:member")
+	t.start(typeName, "gml:id", id)
+
+	geometryName := featureType.Prefix + ":" + featureType.GeometryName
+	if feature.Geometry == nil {
+		t.start(geometryName, "xsi:nil", "true")
+		t.end(geometryName)
+	} else {
+		t.start(geometryName)
+		if err := t.geometry(feature.Geometry, id+".geom", SRSName); err != nil {
+			return err
+		}
+		t.end(geometryName)
+	}
+
+	for idx, property := range featureType.Properties {
+		if value := feature.Values[idx]; value != "" {
+			t.text(featureType.Prefix+":"+property.Name, value)
+		}
+	}
+
+	t.end(typeName)
+	t.end("wfs:member")
+	return writer.encode(t)
+}
+
+func (writer *FeatureCollectionWriter) Close() error {
+	if err := writer.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "wfs:FeatureCollection"}}); err != nil {
+		return errors.Wrap(err, "failed to complete feature collection")
+	}
+	return errors.Wrap(writer.enc.Close(), "failed to complete feature collection")
+}
+
+func (writer *FeatureCollectionWriter) encode(t *tokens) error {
+	for _, token := range t.tokens {
+		if err := writer.enc.EncodeToken(token); err != nil {
+			return errors.Wrap(err, "failed to write feature")
+		}
+	}
+	return nil
+}
+
+// NCName replaces any characters not allowed in an XML identifier, such as a
+// gml:id, with underscores.
+func NCName(name string) string {
+	var sb strings.Builder
+	for idx, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r == '_':
+		case idx > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-'):
+		default:
+			r = '_'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// tokens accumulates the tokens of an element, so that a feature is either
+// written completely or not at all. Names are written with their prefixes,
+// which are declared on the feature collection.
+type tokens struct {
+	tokens []xml.Token
+}
+
+func (t *tokens) start(name string, attrs ...string) {
+	t.tokens = append(t.tokens, element(name, attrs...))
+}
+
+func (t *tokens) end(name string) {
+	t.tokens = append(t.tokens, xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (t *tokens) text(name string, value string) {
+	t.start(name)
+	t.tokens = append(t.tokens, xml.CharData(value))
+	t.end(name)
+}
+
+// geometry appends a GML 3.2 geometry, in which every geometry has a gml:id,
+// and only the outermost has the srsName. Only the first two dimensions of
+// the coordinates are written.
+func (t *tokens) geometry(g geom.T, id string, srsName string) error {
+	attrs := []string{"gml:id", id}
+	if srsName != "" {
+		attrs = append(attrs, "srsName", srsName)
+	}
+
+	switch g := g.(type) {
+	case *geom.Point:
+		if g.Empty() {
+			return errors.New("empty points cannot be written as GML")
+		}
+		t.start("gml:Point", attrs...)
+		t.text("gml:pos", positions(g.FlatCoords(), g.Stride()))
+		t.end("gml:Point")
+	case *geom.LineString:
+		t.start("gml:LineString", attrs...)
+		t.text("gml:posList", positions(g.FlatCoords(), g.Stride()))
+		t.end("gml:LineString")
+	case *geom.Polygon:
+		t.start("gml:Polygon", attrs...)
+		for i := range g.NumLinearRings() {
+			boundary := "gml:interior"
+			if i == 0 {
+				boundary = "gml:exterior"
+			}
+			ring := g.LinearRing(i)
+			t.start(boundary)
+			t.start("gml:LinearRing")
+			t.text("gml:posList", positions(ring.FlatCoords(), ring.Stride()))
+			t.end("gml:LinearRing")
+			t.end(boundary)
+		}
+		t.end("gml:Polygon")
+	case *geom.MultiPoint:
+		return t.multi("gml:MultiPoint", "gml:pointMember", attrs, id, g.NumPoints(), func(i int) geom.T { return g.Point(i) })
+	case *geom.MultiLineString:
+		return t.multi("gml:MultiCurve", "gml:curveMember", attrs, id, g.NumLineStrings(), func(i int) geom.T { return g.LineString(i) })
+	case *geom.MultiPolygon:
+		return t.multi("gml:MultiSurface", "gml:surfaceMember", attrs, id, g.NumPolygons(), func(i int) geom.T { return g.Polygon(i) })
+	case *geom.GeometryCollection:
+		return t.multi("gml:MultiGeometry", "gml:geometryMember", attrs, id, g.NumGeoms(), g.Geom)
+	default:
+		return errors.Newf("unsupported geometry type %T", g)
+	}
+	return nil
+}
+
+func (t *tokens) multi(name string, memberName string, attrs []string, id string, n int, member func(i int) geom.T) error {
+	t.start(name, attrs...)
+	for i := range n {
+		t.start(memberName)
+		if err := t.geometry(member(i), id+"."+strconv.Itoa(i+1), ""); err != nil {
+			return err
+		}
+		t.end(memberName)
+	}
+	t.end(name)
+	return nil
+}
+
+func positions(coords []float64, stride int) string {
+	parts := make([]string, 0, len(coords)/stride*2)
+	for i := 0; i+1 < len(coords); i += stride {
+		parts = append(parts, formatCoord(coords[i]), formatCoord(coords[i+1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func element(name string, attrs ...string) xml.StartElement {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	return start
+}
@@ -0,0 +1,143 @@
+// Package wfs implements the encodings needed for a minimal WFS 2.0 service:
+// the capabilities document, feature type schemas, GML 3.2 feature
+// collections, Filter Encoding 2.0 filters and OWS exception reports.
+package wfs
+
+import (
+	"embed"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	Version = "2.0.0"
+
+	WFSNamespace = "http://www.opengis.net/wfs/2.0"
+	GMLNamespace = "http://www.opengis.net/gml/3.2"
+	FESNamespace = "http://www.opengis.net/fes/2.0"
+	OWSNamespace = "http://www.opengis.net/ows/1.1"
+
+	// OutputFormat is the only format features are served in
+	OutputFormat = "application/gml+xml; version=3.2"
+
+	// SRSName is British National Grid, the only CRS features are served in
+	SRSName = "urn:ogc:def:crs:EPSG::27700"
+)
+
+// srsNames are the ways clients refer to British National Grid.
+var srsNames = []string{
+	SRSName,
+	"EPSG:27700",
+	"http://www.opengis.net/def/crs/EPSG/0/27700",
+	"http://www.opengis.net/gml/srs/epsg.xml#27700",
+	"urn:x-ogc:def:crs:EPSG:27700",
+}
+
+// IsSRSName reports whether a CRS identifier refers to British National Grid.
+func IsSRSName(name string) bool {
+	for _, srsName := range srsNames {
+		if strings.EqualFold(name, srsName) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOutputFormat reports whether an output format refers to GML 3.2.
+func IsOutputFormat(format string) bool {
+	switch strings.ReplaceAll(strings.ToLower(format), " ", "") {
+	case "application/gml+xml;version=3.2", "text/xml;subtype=gml/3.2", "text/xml;subtype=gml/3.2.1", "gml32":
+		return true
+	default:
+		return false
+	}
+}
+
+// FeatureType describes a type of feature: a geometry and a flat set of
+// optional, simple-typed properties.
+type FeatureType struct {
+	Prefix    string
+	Namespace string
+	Name      string
+	Title     string
+	Abstract  string
+	// GeometryName is the name of the geometry property
+	GeometryName string
+	Properties   []Property
+	// WGS84BoundingBox is the extent, as minLon, minLat, maxLon, maxLat
+	WGS84BoundingBox [4]float64
+}
+
+// Property is a feature property, with an XML Schema built-in type such as
+// "string", "integer" or "dateTime".
+type Property struct {
+	Name string
+	Type string
+}
+
+// QualifiedName is the name of the feature type, with its prefix.
+func (featureType *FeatureType) QualifiedName() string {
+	return featureType.Prefix + ":" + featureType.Name
+}
+
+// Matches reports whether a type name given by a client, with or without a
+// prefix, refers to the feature type.
+func (featureType *FeatureType) Matches(typeName string) bool {
+	_, local, found := strings.Cut(typeName, ":")
+	if !found {
+		local = typeName
+	} else if !strings.HasPrefix(typeName, featureType.Prefix+":") {
+		return false
+	}
+	return local == featureType.Name
+}
+
+// Service describes the service in its capabilities document.
+type Service struct {
+	Title             string
+	Abstract          string
+	AccessConstraints string
+	ProviderName      string
+	// URL is where each operation is requested, using the KVP encoding
+	URL          string
+	CountDefault int
+	FeatureTypes []*FeatureType
+}
+
+//go:embed templates
+var templates embed.FS
+
+var funcs = map[string]any{
+	"xml": func(s string) string {
+		var sb strings.Builder
+		_ = xml.EscapeText(&sb, []byte(s))
+		return sb.String()
+	},
+	"coord": formatCoord,
+	"list":  func(values ...string) []string { return values },
+}
+
+var (
+	capabilitiesTemplate = template.Must(template.New("capabilities.xml.tmpl").Funcs(funcs).ParseFS(templates, "templates/capabilities.xml.tmpl"))
+	schemaTemplate       = template.Must(template.New("schema.xsd.tmpl").Funcs(funcs).ParseFS(templates, "templates/schema.xsd.tmpl"))
+)
+
+// WriteCapabilities writes the GetCapabilities response.
+func WriteCapabilities(w io.Writer, service *Service) error {
+	return errors.Wrap(capabilitiesTemplate.Execute(w, service), "failed to write capabilities")
+}
+
+// WriteSchema writes the DescribeFeatureType response: an XML schema for the
+// feature type, as a GML application schema.
+func WriteSchema(w io.Writer, featureType *FeatureType) error {
+	return errors.Wrap(schemaTemplate.Execute(w, featureType), "failed to write schema")
+}
+
+func formatCoord(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
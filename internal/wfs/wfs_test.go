@@ -0,0 +1,199 @@
+package wfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+var testFeatureType = &FeatureType{
+	Prefix:           "smr",
+	Namespace:        "https://example.com/smr",
+	Name:             "events",
+	Title:            "Events",
+	GeometryName:     "geometry",
+	Properties:       []Property{{Name: "usrn", Type: "string"}, {Name: "event_time", Type: "dateTime"}},
+	WGS84BoundingBox: [4]float64{-8.82, 49.79, 1.92, 60.94},
+}
+
+// wellFormed reads every token, failing on any XML syntax error.
+func wellFormed(t *testing.T, doc string) {
+	t.Helper()
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("malformed XML: %v\n%s", err, doc)
+		}
+	}
+}
+
+func TestWriteCapabilitiesAndSchema(t *testing.T) {
+	var capabilities bytes.Buffer
+	err := WriteCapabilities(&capabilities, &Service{
+		Title:        "Street works & more",
+		URL:          "https://example.com/wfs?",
+		CountDefault: 1000,
+		FeatureTypes: []*FeatureType{testFeatureType},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wellFormed(t, capabilities.String())
+	for _, expected := range []string{
+		"<ows:Title>Street works &amp; more</ows:Title>",
+		`<ows:Operation name="GetFeature">`,
+		"<wfs:Name>smr:events</wfs:Name>",
+		"<ows:LowerCorner>-8.82 49.79</ows:LowerCorner>",
+	} {
+		if !strings.Contains(capabilities.String(), expected) {
+			t.Errorf("expected capabilities to contain %s", expected)
+		}
+	}
+
+	var schema bytes.Buffer
+	if err := WriteSchema(&schema, testFeatureType); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wellFormed(t, schema.String())
+	if !strings.Contains(schema.String(), `<xsd:element name="event_time" type="xsd:dateTime" minOccurs="0" maxOccurs="1"/>`) {
+		t.Errorf("unexpected schema:\n%s", schema.String())
+	}
+}
+
+func TestFeatureCollectionWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewFeatureCollectionWriter(&buf, &FeatureCollection{
+		FeatureType:    testFeatureType,
+		SchemaURL:      "https://example.com/wfs?request=DescribeFeatureType",
+		NumberMatched:  3,
+		NumberReturned: 2,
+		TimeStamp:      time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	multi, _ := wkt.Unmarshal("MULTIPOLYGON(((0 0, 10 0, 10 10, 0 0)), ((20 20, 30 20, 30 30, 20 20)))")
+	for _, feature := range []*Feature{
+		{ID: "TSR01/2", Geometry: multi, Values: []string{"1001", "2025-06-01T09:00:00Z"}},
+		{ID: "P2", Values: []string{"", "2025-06-01T09:00:00Z"}},
+	} {
+		if err := writer.WriteFeature(feature); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := writer.WriteFeature(&Feature{ID: "P3"}); err == nil {
+		t.Error("expected an error for missing values")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc := buf.String()
+	wellFormed(t, doc)
+	for _, expected := range []string{
+		`numberMatched="3" numberReturned="2"`,
+		`<smr:events gml:id="events.TSR01_2">`,
+		`<gml:MultiSurface gml:id="events.TSR01_2.geom" srsName="urn:ogc:def:crs:EPSG::27700"><gml:surfaceMember><gml:Polygon gml:id="events.TSR01_2.geom.1">`,
+		`<gml:exterior><gml:LinearRing><gml:posList>0 0 10 0 10 10 0 0</gml:posList></gml:LinearRing></gml:exterior>`,
+		`<smr:usrn>1001</smr:usrn>`,
+		`<smr:geometry xsi:nil="true"></smr:geometry>`,
+	} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("expected feature collection to contain %s\n%s", expected, doc)
+		}
+	}
+	if strings.Count(doc, "<smr:usrn>") != 1 {
+		t.Error("expected empty values to be left out")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		expected *Filter
+		err      string
+	}{
+		{
+			name:   "PropertyIsEqualTo",
+			filter: `<fes:Filter xmlns:fes="http://www.opengis.net/fes/2.0"><fes:PropertyIsEqualTo><fes:ValueReference>smr:usrn</fes:ValueReference><fes:Literal>1001</fes:Literal></fes:PropertyIsEqualTo></fes:Filter>`,
+			expected: &Filter{Equals: []*PropertyIsEqualTo{
+				{ValueReference: "usrn", Literal: "1001", MatchCase: true},
+			}},
+		},
+		{
+			name: "And with BBOX",
+			filter: `<Filter><And>
+				<PropertyIsEqualTo matchCase="false"><PropertyName>events/event_type</PropertyName><Literal>work_start</Literal></PropertyIsEqualTo>
+				<BBOX><ValueReference>geometry</ValueReference><gml:Envelope xmlns:gml="http://www.opengis.net/gml/3.2" srsName="EPSG:27700"><gml:lowerCorner>1 2</gml:lowerCorner><gml:upperCorner>3 4</gml:upperCorner></gml:Envelope></BBOX>
+			</And></Filter>`,
+			expected: &Filter{
+				Equals: []*PropertyIsEqualTo{{ValueReference: "event_type", Literal: "work_start", MatchCase: false}},
+				BBox:   &Envelope{SRSName: "EPSG:27700", MinX: 1, MinY: 2, MaxX: 3, MaxY: 4},
+			},
+		},
+		{
+			name:   "Unsupported operator",
+			filter: `<Filter><PropertyIsLike><ValueReference>usrn</ValueReference><Literal>1*</Literal></PropertyIsLike></Filter>`,
+			err:    "unsupported filter operator PropertyIsLike",
+		},
+		{
+			name:   "Missing literal",
+			filter: `<Filter><PropertyIsEqualTo><ValueReference>usrn</ValueReference></PropertyIsEqualTo></Filter>`,
+			err:    "PropertyIsEqualTo must have a ValueReference and a Literal",
+		},
+		{
+			name:   "Malformed",
+			filter: `<Filter><PropertyIsEqualTo>`,
+			err:    "malformed filter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.filter)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(filter.Equals) != len(tt.expected.Equals) {
+				t.Fatalf("got %d PropertyIsEqualTo, want %d", len(filter.Equals), len(tt.expected.Equals))
+			}
+			for idx, equals := range filter.Equals {
+				if *equals != *tt.expected.Equals[idx] {
+					t.Errorf("got %+v, want %+v", equals, tt.expected.Equals[idx])
+				}
+			}
+			if (filter.BBox == nil) != (tt.expected.BBox == nil) || (filter.BBox != nil && *filter.BBox != *tt.expected.BBox) {
+				t.Errorf("got bbox %+v, want %+v", filter.BBox, tt.expected.BBox)
+			}
+		})
+	}
+}
+
+func TestWriteException(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteException(&buf, MissingParameterValue, "typeNames", "typeNames is required"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wellFormed(t, buf.String())
+
+	expected := `<ows:ExceptionReport xmlns:ows="http://www.opengis.net/ows/1.1" version="2.0.0" xml:lang="en"><ows:Exception exceptionCode="MissingParameterValue" locator="typeNames"><ows:ExceptionText>typeNames is required</ows:ExceptionText></ows:Exception></ows:ExceptionReport>`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("got %s", buf.String())
+	}
+}
@@ -0,0 +1,327 @@
+// Package wzdx maps events to a Work Zone Data Exchange (WZDx) v4.2 feed,
+// the GeoJSON format for sharing roadworks with navigation and traffic
+// management systems.
+package wzdx
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/internal/osgb"
+	"github.com/rm-hull/street-manager-relay/models"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+)
+
+const (
+	Version      = "4.2"
+	ContentType  = "application/geo+json"
+	DataSourceID = "street-manager"
+
+	// coordinateDigits is enough for WGS84 degrees to within about 1cm
+	coordinateDigits = 7
+)
+
+// Vehicle impacts, lane statuses and lane types used by the mapping.
+const (
+	AllLanesClosed         = "all-lanes-closed"
+	SomeLanesClosed        = "some-lanes-closed"
+	AllLanesOpen           = "all-lanes-open"
+	AlternatingOneWay      = "alternating-one-way"
+	Flagging               = "flagging"
+	TemporaryTrafficSignal = "temporary-traffic-signal"
+	UnknownImpact          = "unknown"
+
+	LaneClosed   = "closed"
+	LaneSidewalk = "sidewalk"
+)
+
+// vehicleImpacts maps each traffic_management_type_ref to the nearest WZDx
+// vehicle impact. Footway closures leave the carriageway open.
+var vehicleImpacts = map[string]string{
+	"road_closure":               AllLanesClosed,
+	"lane_closure":               SomeLanesClosed,
+	"contraflow":                 SomeLanesClosed,
+	"multi_way_signals":          TemporaryTrafficSignal,
+	"two_way_signals":            TemporaryTrafficSignal,
+	"convoy_workings":            AlternatingOneWay,
+	"stop_go_boards":             Flagging,
+	"priority_working":           AlternatingOneWay,
+	"give_and_take":              AlternatingOneWay,
+	"some_carriageway_incursion": SomeLanesClosed,
+	"no_carriageway_incursion":   AllLanesOpen,
+	"footway_closure":            AllLanesOpen,
+}
+
+type FeedInfo struct {
+	Publisher   string        `json:"publisher"`
+	Version     string        `json:"version"`
+	DataSources []*DataSource `json:"data_sources"`
+	UpdateDate  time.Time     `json:"update_date"`
+}
+
+type DataSource struct {
+	DataSourceID     string     `json:"data_source_id"`
+	OrganizationName string     `json:"organization_name"`
+	UpdateDate       *time.Time `json:"update_date,omitempty"`
+}
+
+// NewFeedInfo describes a feed published from Street Manager, as the single
+// data source, last updated at the given time.
+func NewFeedInfo(publisher string, updated time.Time) *FeedInfo {
+	updated = updated.UTC()
+	return &FeedInfo{
+		Publisher:   publisher,
+		Version:     Version,
+		DataSources: []*DataSource{{DataSourceID: DataSourceID, OrganizationName: "GOV.UK Street Manager", UpdateDate: &updated}},
+		UpdateDate:  updated,
+	}
+}
+
+type RoadEventFeature struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	Properties *WorkZoneRoadEvent `json:"properties"`
+	Geometry   *geojson.Geometry  `json:"geometry"`
+}
+
+type WorkZoneRoadEvent struct {
+	CoreDetails             *CoreDetails `json:"core_details"`
+	StartDate               time.Time    `json:"start_date"`
+	EndDate                 time.Time    `json:"end_date"`
+	IsStartDateVerified     bool         `json:"is_start_date_verified"`
+	IsEndDateVerified       bool         `json:"is_end_date_verified"`
+	IsStartPositionVerified bool         `json:"is_start_position_verified"`
+	IsEndPositionVerified   bool         `json:"is_end_position_verified"`
+	LocationMethod          string       `json:"location_method"`
+	WorkZoneType            string       `json:"work_zone_type"`
+	VehicleImpact           string       `json:"vehicle_impact"`
+	Lanes                   []*Lane      `json:"lanes,omitempty"`
+}
+
+type CoreDetails struct {
+	EventType    string     `json:"event_type"`
+	DataSourceID string     `json:"data_source_id"`
+	RoadNames    []string   `json:"road_names"`
+	Direction    string     `json:"direction"`
+	Name         string     `json:"name,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	UpdateDate   *time.Time `json:"update_date,omitempty"`
+}
+
+type Lane struct {
+	Order  int    `json:"order"`
+	Status string `json:"status"`
+	Type   string `json:"type"`
+}
+
+// NewRoadEvent maps a permit or activity to a work zone road event, or nil if
+// it cannot be represented: section 58s (which restrict future works rather
+// than being works), cancellations, and events without both a start and an
+// end date or without a location.
+//
+// Street Manager records neither the direction of travel nor the individual
+// lanes, so the direction is "unknown", and the only lane given is a closed
+// sidewalk when the footway is closed. Positions are as planned, not verified.
+func NewRoadEvent(event *models.Event) *RoadEventFeature {
+	if deref(event.ObjectType) == "SECTION_58" || deref(event.Cancelled) == "Yes" {
+		return nil
+	}
+
+	startsAt, endsAt := event.StartsAt(), event.EndsAt()
+	if startsAt == nil || endsAt == nil {
+		return nil
+	}
+
+	g := geometry(event)
+	if g == nil {
+		return nil
+	}
+	encoded, err := geojson.Encode(g, geojson.EncodeGeometryWithMaxDecimalDigits(coordinateDigits))
+	if err != nil {
+		return nil
+	}
+
+	roadNames := make([]string, 0, 1)
+	if street := deref(event.StreetName); street != "" {
+		roadNames = append(roadNames, street)
+	}
+
+	properties := &WorkZoneRoadEvent{
+		CoreDetails: &CoreDetails{
+			EventType:    "work-zone",
+			DataSourceID: DataSourceID,
+			RoadNames:    roadNames,
+			Direction:    "unknown",
+			Name:         name(event),
+			Description:  description(event),
+			UpdateDate:   utc(event.EventTime),
+		},
+		StartDate:           startsAt.UTC(),
+		EndDate:             endsAt.UTC(),
+		IsStartDateVerified: event.ActualStartDateTime != nil,
+		IsEndDateVerified:   event.ActualEndDateTime != nil,
+		LocationMethod:      "other",
+		WorkZoneType:        "static",
+		VehicleImpact:       VehicleImpact(event),
+	}
+	if FootwayClosed(event) {
+		properties.Lanes = []*Lane{{Order: 1, Status: LaneClosed, Type: LaneSidewalk}}
+	}
+
+	return &RoadEventFeature{
+		ID:         event.ObjectReference,
+		Type:       "Feature",
+		Properties: properties,
+		Geometry:   encoded,
+	}
+}
+
+// VehicleImpact is the impact of the event's traffic management, preferring
+// the current traffic management over that originally planned.
+func VehicleImpact(event *models.Event) string {
+	ref := event.CurrentTrafficManagementTypeRef
+	if ref == nil {
+		ref = event.TrafficManagementTypeRef
+	}
+	if impact, ok := vehicleImpacts[deref(ref)]; ok {
+		return impact
+	}
+	return UnknownImpact
+}
+
+// FootwayClosed reports whether the event closes the footway, either as its
+// traffic management or with a close_footway_ref other than "no".
+func FootwayClosed(event *models.Event) bool {
+	return deref(event.CurrentTrafficManagementTypeRef) == "footway_closure" ||
+		deref(event.TrafficManagementTypeRef) == "footway_closure" ||
+		strings.HasPrefix(deref(event.CloseFootwayRef), "yes")
+}
+
+// geometry is the event's location in WGS84, as one of the geometry types
+// that WZDx allows: a LineString along the road, or a MultiPoint. Points
+// become a MultiPoint of one, and polygons their outline.
+func geometry(event *models.Event) geom.T {
+	g, err := event.Geometry()
+	if err != nil {
+		return nil
+	}
+	if g, err = osgb.Reproject(g); err != nil {
+		return nil
+	}
+
+	switch g := g.(type) {
+	case *geom.Point:
+		return geom.NewMultiPointFlat(g.Layout(), g.FlatCoords())
+	case *geom.LineString, *geom.MultiPoint:
+		return g
+	case *geom.Polygon:
+		if g.NumLinearRings() > 0 {
+			ring := g.LinearRing(0)
+			return geom.NewLineStringFlat(ring.Layout(), ring.FlatCoords())
+		}
+	case *geom.MultiLineString:
+		if g.NumLineStrings() == 1 {
+			return g.LineString(0)
+		}
+	}
+	return nil
+}
+
+func name(event *models.Event) string {
+	for _, reference := range []*string{event.PermitReferenceNumber, event.ActivityReferenceNumber, event.WorkReferenceNumber} {
+		if reference != nil && *reference != "" {
+			return *reference
+		}
+	}
+	return event.ObjectReference
+}
+
+func description(event *models.Event) string {
+	var lines []string
+	add := func(label string, value *string) {
+		if value != nil && *value != "" {
+			lines = append(lines, label+": "+*value)
+		}
+	}
+
+	add("Location", event.ActivityLocationDescription)
+	add("Promoter", event.PromoterOrganisation)
+	add("Activity", event.ActivityType)
+	add("Traffic management", firstNonEmpty(event.CurrentTrafficManagementType, event.TrafficManagementType))
+	add("Footway closed", event.CloseFootway)
+	add("Work status", event.WorkStatus)
+	return strings.Join(lines, "\n")
+}
+
+// Writer streams a feed, one road event at a time.
+type Writer struct {
+	w     io.Writer
+	count int
+}
+
+// NewWriter starts a feed. The attribution is added as a foreign member of
+// the feature collection, as GeoJSON allows.
+func NewWriter(w io.Writer, info *FeedInfo, attribution []string) (*Writer, error) {
+	feedInfo, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode feed info")
+	}
+	attributions, err := json.Marshal(attribution)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode attribution")
+	}
+
+	header := `{"feed_info":` + string(feedInfo) + `,"type":"FeatureCollection","attribution":` + string(attributions) + `,"features":[`
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, errors.Wrap(err, "failed to write feed")
+	}
+	return &Writer{w: w}, nil
+}
+
+func (writer *Writer) WriteRoadEvent(feature *RoadEventFeature) error {
+	data, err := json.Marshal(feature)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode road event %s", feature.ID)
+	}
+	if writer.count > 0 {
+		data = append([]byte{','}, data...)
+	}
+	if _, err := writer.w.Write(data); err != nil {
+		return errors.Wrap(err, "failed to write road event")
+	}
+	writer.count++
+	return nil
+}
+
+func (writer *Writer) Close() error {
+	_, err := io.WriteString(writer.w, "]}")
+	return errors.Wrap(err, "failed to complete feed")
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func firstNonEmpty(values ...*string) *string {
+	for _, value := range values {
+		if value != nil && *value != "" {
+			return value
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,192 @@
+package wzdx
+
+import (
+	"bytes"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/rm-hull/street-manager-relay/models"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// schemaURL is the upstream WZDx 4.2 schema, at its release tag, which is
+// committed unmodified in schemaDir (see `make wzdx-schema`).
+const (
+	schemaURL = "https://raw.githubusercontent.com/usdot-jpo-ode/wzdx/v4.2/schemas/4.2/WorkZoneFeed.json"
+	schemaDir = "schema/4.2"
+)
+
+// bundledLoader loads the upstream schemas from those bundled in a directory,
+// so that they, and any references between them, resolve without fetching.
+type bundledLoader string
+
+func (dir bundledLoader) Load(rawURL string) (any, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(string(dir), path.Base(u.Path)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return jsonschema.UnmarshalJSON(f)
+}
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(schemaDir, path.Base(schemaURL))); errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("the WZDx schema is missing from %s: run `make wzdx-schema` and commit it", schemaDir)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{"https": bundledLoader(schemaDir)})
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		t.Fatalf("failed to compile schema: %v", err)
+	}
+	return schema
+}
+
+func validate(schema *jsonschema.Schema, feed string) error {
+	instance, err := jsonschema.UnmarshalJSON(strings.NewReader(feed))
+	if err != nil {
+		return err
+	}
+	return schema.Validate(instance)
+}
+
+func TestFeedConformsToSchema(t *testing.T) {
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(72 * time.Hour)
+	events := []*models.Event{
+		{
+			ObjectReference:          "TSR01-01",
+			ObjectType:               ptr("PERMIT"),
+			PermitReferenceNumber:    ptr("TSR01-01"),
+			StreetName:               ptr("High Street"),
+			EventTime:                &start,
+			WorksLocationCoordinates: ptr("LINESTRING(530000 180000, 530100 180050)"),
+			TrafficManagementTypeRef: ptr("road_closure"),
+			TrafficManagementType:    ptr("Road closure"),
+			CloseFootwayRef:          ptr("yes_provide_pedestrian_walkway"),
+			ActualStartDateTime:      &start,
+			ProposedEndDate:          &end,
+		},
+		{
+			ObjectReference:          "TSR02-01",
+			ObjectType:               ptr("PERMIT"),
+			WorksLocationCoordinates: ptr("POINT(530000 180000)"),
+			ProposedStartDate:        &start,
+			ProposedEndDate:          &end,
+		},
+		{
+			ObjectReference:     "ACT03",
+			ObjectType:          ptr("ACTIVITY"),
+			ActivityCoordinates: ptr("POLYGON((530000 180000, 530010 180000, 530010 180010, 530000 180000))"),
+			StartDate:           &start,
+			EndDate:             &end,
+		},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, NewFeedInfo("Street Manager Relay", start), []string{"Contains public sector information"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, event := range events {
+		feature := NewRoadEvent(event)
+		if feature == nil {
+			t.Fatalf("expected %s to be mapped", event.ObjectReference)
+		}
+		if err := w.WriteRoadEvent(feature); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schema := compileSchema(t)
+	if err := validate(schema, buf.String()); err != nil {
+		t.Fatalf("feed does not conform to the schema: %v\n%s", err, buf.String())
+	}
+	for _, expected := range []string{
+		`"vehicle_impact":"all-lanes-closed"`,
+		`"lanes":[{"order":1,"status":"closed","type":"sidewalk"}]`,
+		`"is_start_date_verified":true,"is_end_date_verified":false`,
+		`"geometry":{"type":"MultiPoint"`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected feed to contain %s\n%s", expected, buf.String())
+		}
+	}
+
+	// The schema must reject geometries that WZDx doesn't allow
+	invalid := strings.Replace(buf.String(), `"type":"MultiPoint"`, `"type":"Polygon"`, 1)
+	if err := validate(schema, invalid); err == nil {
+		t.Error("expected a Polygon geometry to be rejected")
+	}
+}
+
+func TestNewRoadEvent(t *testing.T) {
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		modify   func(event *models.Event)
+		expected string
+	}{
+		{name: "Signals", modify: func(e *models.Event) { e.TrafficManagementTypeRef = ptr("two_way_signals") }, expected: TemporaryTrafficSignal},
+		{name: "Current traffic management", modify: func(e *models.Event) {
+			e.TrafficManagementTypeRef, e.CurrentTrafficManagementTypeRef = ptr("road_closure"), ptr("stop_go_boards")
+		}, expected: Flagging},
+		{name: "Unknown traffic management", modify: func(e *models.Event) { e.TrafficManagementTypeRef = ptr("something_else") }, expected: UnknownImpact},
+		{name: "Section 58", modify: func(e *models.Event) { e.ObjectType = ptr("SECTION_58") }},
+		{name: "Cancelled", modify: func(e *models.Event) { e.Cancelled = ptr("Yes") }},
+		{name: "Open-ended", modify: func(e *models.Event) { e.ProposedEndDate = nil }},
+		{name: "Multipolygon", modify: func(e *models.Event) {
+			e.WorksLocationCoordinates = ptr("MULTIPOLYGON(((0 0, 1 0, 1 1, 0 0)), ((2 2, 3 2, 3 3, 2 2)))")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.Event{
+				ObjectReference:          "REF",
+				ObjectType:               ptr("PERMIT"),
+				WorksLocationCoordinates: ptr("POINT(530000 180000)"),
+				ProposedStartDate:        &start,
+				ProposedEndDate:          &end,
+			}
+			tt.modify(event)
+
+			feature := NewRoadEvent(event)
+			if tt.expected == "" {
+				if feature != nil {
+					t.Errorf("expected the event to be left out, got %+v", feature.Properties)
+				}
+				return
+			}
+			if feature == nil {
+				t.Fatal("expected a road event")
+			}
+			if feature.Properties.VehicleImpact != tt.expected {
+				t.Errorf("got %s, want %s", feature.Properties.VehicleImpact, tt.expected)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"math"
+	"strconv"
 
 	"github.com/joho/godotenv"
 	"github.com/rm-hull/godx"
@@ -15,8 +16,18 @@ func main() {
 	var dbPath string
 	var port int
 	var debug bool
+	var requireAPIKey bool
+	var allowedOrigins []string
+	var trustedProxies []string
 	var maxFiles int
 	var filePath string
+	var watchListPath string
+	var digestAt string
+	var dryRun bool
+	var exportFilters cmd.ExportFilters
+	var keyName string
+	var keyRate int
+	var keyBurst int
 
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
@@ -34,15 +45,18 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "./data/street-manager.db", "Path to street-manager SQLite database")
 
 	apiServerCmd := &cobra.Command{
-		Use:   "api-server [--db <path>] [--port <port>] [--debug]",
+		Use:   "api-server [--db <path>] [--port <port>] [--debug] [--require-api-key=false] [--allowed-origins <origins>] [--trusted-proxies <addresses>]",
 		Short: "Start HTTP API server",
 		Run: func(_ *cobra.Command, _ []string) {
-			cmd.ApiServer(dbPath, port, debug)
+			cmd.ApiServer(dbPath, port, debug, requireAPIKey, allowedOrigins, trustedProxies)
 		},
 	}
 
 	apiServerCmd.Flags().IntVar(&port, "port", 8080, "Port to run HTTP server on")
 	apiServerCmd.Flags().BoolVar(&debug, "debug", false, "Enable debugging (pprof) - WARING: do not enable in production")
+	apiServerCmd.Flags().BoolVar(&requireAPIKey, "require-api-key", true, "Require an API key for every endpoint other than SNS and the API docs")
+	apiServerCmd.Flags().StringSliceVar(&allowedOrigins, "allowed-origins", nil, "Origins allowed to call the API from a browser, comma-separated (default any)")
+	apiServerCmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxies", nil, "Addresses or CIDR ranges of proxies whose X-Forwarded-* headers are trusted, comma-separated")
 
 	bulkLoaderCmd := &cobra.Command{
 		Use:   "bulk-loader [--db <path>] [--max-files <n>] <folder>",
@@ -78,10 +92,86 @@ func main() {
 	}
 	updateFaviconsCmd.Flags().StringVar(&filePath, "file", "./internal/promoter/organisations.csv", "Path to promoter orgs CSV file")
 
+	digestCmd := &cobra.Command{
+		Use:   "digest [--db <path>] [--watch-list <path>] [--at <HH:MM>] [--dry-run]",
+		Short: "Send digests of new and changed works on watched streets and areas",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := cmd.Digest(dbPath, watchListPath, digestAt, dryRun); err != nil {
+				log.Fatalf("Digest failed: %v", err)
+			}
+		},
+	}
+	digestCmd.Flags().StringVar(&watchListPath, "watch-list", "./data/watch-list.json", "Path to watch-list JSON file")
+	digestCmd.Flags().StringVar(&digestAt, "at", "", "Time of day (HH:MM) to send daily; sends once immediately if omitted")
+	digestCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Write digests to stdout instead of sending them")
+
+	exportCmd := &cobra.Command{
+		Use:   "export [--db <path>] [--bbox <bbox>] [--facet <facet=value>]... [--from <date>] [--to <date>] <file.gpkg>",
+		Short: "Export events to a GeoPackage",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			if err := cmd.Export(dbPath, args[0], exportFilters); err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+		},
+	}
+	exportCmd.Flags().StringVar(&exportFilters.BBox, "bbox", "", "Only export events within this bounding box (as per the search bbox parameter)")
+	exportCmd.Flags().StringArrayVar(&exportFilters.Facets, "facet", nil, "Only export events matching this facet, as facet=value (repeatable)")
+	exportCmd.Flags().StringVar(&exportFilters.From, "from", "", "Only export events active on or after this ISO-8601 date or date-time")
+	exportCmd.Flags().StringVar(&exportFilters.To, "to", "", "Only export events active on or before this ISO-8601 date or date-time")
+
+	apiKeysCmd := &cobra.Command{
+		Use:   "api-keys",
+		Short: "Manage API keys",
+	}
+
+	createAPIKeyCmd := &cobra.Command{
+		Use:   "create [--db <path>] --name <name> [--rate <n>] [--burst <n>]",
+		Short: "Issue an API key, printing it",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := cmd.CreateAPIKey(dbPath, keyName, keyRate, keyBurst); err != nil {
+				log.Fatalf("Failed to create API key: %v", err)
+			}
+		},
+	}
+	createAPIKeyCmd.Flags().StringVar(&keyName, "name", "", "Who the key is issued to")
+	createAPIKeyCmd.Flags().IntVar(&keyRate, "rate", 60, "Requests allowed a minute, on average")
+	createAPIKeyCmd.Flags().IntVar(&keyBurst, "burst", 60, "Requests allowed in a burst")
+
+	listAPIKeysCmd := &cobra.Command{
+		Use:   "list [--db <path>]",
+		Short: "List API keys",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := cmd.ListAPIKeys(dbPath); err != nil {
+				log.Fatalf("Failed to list API keys: %v", err)
+			}
+		},
+	}
+
+	revokeAPIKeyCmd := &cobra.Command{
+		Use:   "revoke [--db <path>] <id>",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid API key id: %s", args[0])
+			}
+			if err := cmd.RevokeAPIKey(dbPath, id); err != nil {
+				log.Fatalf("Failed to revoke API key: %v", err)
+			}
+		},
+	}
+
+	apiKeysCmd.AddCommand(createAPIKeyCmd, listAPIKeysCmd, revokeAPIKeyCmd)
+
 	rootCmd.AddCommand(apiServerCmd)
 	rootCmd.AddCommand(bulkLoaderCmd)
 	rootCmd.AddCommand(regenCmd)
 	rootCmd.AddCommand(updateFaviconsCmd)
+	rootCmd.AddCommand(digestCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(apiKeysCmd)
 	if err = rootCmd.Execute(); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// APIKey grants access to the API, at up to RatePerMinute requests a minute
+// on average, in bursts of up to Burst requests.
+type APIKey struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, to recognise it by, as the key itself
+	// is only stored hashed
+	Prefix        string     `json:"prefix"`
+	RatePerMinute int        `json:"rate_per_minute"`
+	Burst         int        `json:"burst"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkt"
+	"github.com/twpayne/go-geom/xy"
+	"github.com/twpayne/go-geom/xy/lineintersector"
+	"github.com/twpayne/go-geom/xy/location"
+)
+
+// Area is a polygon of interest, in the same British National Grid
+// coordinates (EPSG:27700) as the events.
+type Area struct {
+	polygon *geom.Polygon
+}
+
+func AreaFromWKT(wktStr string) (*Area, error) {
+	g, err := wkt.Unmarshal(wktStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse WKT")
+	}
+
+	polygon, ok := g.(*geom.Polygon)
+	if !ok || polygon.Empty() {
+		return nil, errors.New("area must be a non-empty POLYGON")
+	}
+	return &Area{polygon: polygon}, nil
+}
+
+func AreaFromBBox(bbox BBox) *Area {
+	return &Area{polygon: geom.NewPolygon(geom.XY).MustSetCoords([][]geom.Coord{{
+		{bbox.MinX, bbox.MinY},
+		{bbox.MaxX, bbox.MinY},
+		{bbox.MaxX, bbox.MaxY},
+		{bbox.MinX, bbox.MaxY},
+		{bbox.MinX, bbox.MinY},
+	}})}
+}
+
+func (area *Area) WKT() (string, error) {
+	return wkt.Marshal(area.polygon)
+}
+
+func (area *Area) BoundingBox() BBox {
+	return boundsToBBox(area.polygon.Bounds())
+}
+
+// Intersects reports whether the geometry touches or overlaps the area: i.e.
+// whether any of its vertices are within the area, any of its edges cross the
+// area's boundary, or - for polygons - it encloses the area. A collection
+// intersects if any of its members do.
+func (area *Area) Intersects(g geom.T) bool {
+	// Checked first, as go-geom can't find the bounds of nested collections
+	if collection, ok := g.(*geom.GeometryCollection); ok {
+		for _, child := range collection.Geoms() {
+			if area.Intersects(child) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if g.Empty() || !area.BoundingBox().Intersects(boundsToBBox(g.Bounds())) {
+		return false
+	}
+
+	flatCoords, stride := g.FlatCoords(), g.Stride()
+	for i := 0; i+1 < len(flatCoords); i += stride {
+		if polygonContains(area.polygon, geom.Coord{flatCoords[i], flatCoords[i+1]}) {
+			return true
+		}
+	}
+
+	areaLines := lines(area.polygon)
+	for _, line := range lines(g) {
+		for _, areaLine := range areaLines {
+			if linesCross(line, stride, areaLine, area.polygon.Stride()) {
+				return true
+			}
+		}
+	}
+
+	vertex := area.polygon.Coord(0)
+	for _, polygon := range polygons(g) {
+		if polygonContains(polygon, vertex) {
+			return true
+		}
+	}
+	return false
+}
+
+// IntersectsEvent reports whether the event's location intersects the area.
+func (area *Area) IntersectsEvent(event *Event) bool {
+	g, err := event.Geometry()
+	return err == nil && area.Intersects(g)
+}
+
+func boundsToBBox(bounds *geom.Bounds) BBox {
+	return BBox{MinX: bounds.Min(0), MaxX: bounds.Max(0), MinY: bounds.Min(1), MaxY: bounds.Max(1)}
+}
+
+// polygonContains reports whether the point is within the polygon or on its boundary.
+func polygonContains(polygon *geom.Polygon, point geom.Coord) bool {
+	layout := polygon.Layout()
+	if xy.LocatePointInRing(layout, point, polygon.LinearRing(0).FlatCoords()) == location.Exterior {
+		return false
+	}
+	for i := 1; i < polygon.NumLinearRings(); i++ {
+		if xy.LocatePointInRing(layout, point, polygon.LinearRing(i).FlatCoords()) == location.Interior {
+			return false
+		}
+	}
+	return true
+}
+
+func linesCross(line1 []float64, stride1 int, line2 []float64, stride2 int) bool {
+	for i := stride1; i+1 < len(line1); i += stride1 {
+		start1 := geom.Coord{line1[i-stride1], line1[i-stride1+1]}
+		end1 := geom.Coord{line1[i], line1[i+1]}
+		for j := stride2; j+1 < len(line2); j += stride2 {
+			start2 := geom.Coord{line2[j-stride2], line2[j-stride2+1]}
+			end2 := geom.Coord{line2[j], line2[j+1]}
+			result := lineintersector.LineIntersectsLine(lineintersector.RobustLineIntersector{}, start1, end1, start2, end2)
+			if result.HasIntersection() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lines splits a geometry into the flat coordinates of each of its line
+// strings or rings.
+func lines(g geom.T) [][]float64 {
+	switch g := g.(type) {
+	case *geom.LineString:
+		return [][]float64{g.FlatCoords()}
+	case *geom.Polygon, *geom.MultiLineString:
+		return split(g.FlatCoords(), g.Ends())
+	case *geom.MultiPolygon:
+		var result [][]float64
+		for i := 0; i < g.NumPolygons(); i++ {
+			result = append(result, lines(g.Polygon(i))...)
+		}
+		return result
+	case *geom.GeometryCollection:
+		var result [][]float64
+		for _, child := range g.Geoms() {
+			result = append(result, lines(child)...)
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func split(flatCoords []float64, ends []int) [][]float64 {
+	result := make([][]float64, 0, len(ends))
+	start := 0
+	for _, end := range ends {
+		result = append(result, flatCoords[start:end])
+		start = end
+	}
+	return result
+}
+
+func polygons(g geom.T) []*geom.Polygon {
+	switch g := g.(type) {
+	case *geom.Polygon:
+		return []*geom.Polygon{g}
+	case *geom.MultiPolygon:
+		result := make([]*geom.Polygon, g.NumPolygons())
+		for i := range result {
+			result[i] = g.Polygon(i)
+		}
+		return result
+	case *geom.GeometryCollection:
+		var result []*geom.Polygon
+		for _, child := range g.Geoms() {
+			result = append(result, polygons(child)...)
+		}
+		return result
+	default:
+		return nil
+	}
+}
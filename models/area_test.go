@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/twpayne/go-geom/encoding/wkt"
+)
+
+func TestAreaIntersects(t *testing.T) {
+	// A square with a square hole in the middle
+	area, err := AreaFromWKT("POLYGON((0 0, 10 0, 10 10, 0 10, 0 0), (4 4, 6 4, 6 6, 4 6, 4 4))")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		wkt      string
+		expected bool
+	}{
+		{name: "Point inside", wkt: "POINT(2 2)", expected: true},
+		{name: "Point on boundary", wkt: "POINT(10 5)", expected: true},
+		{name: "Point outside", wkt: "POINT(12 5)", expected: false},
+		{name: "Point in hole", wkt: "POINT(5 5)", expected: false},
+		{name: "Point Z inside", wkt: "POINT Z (2 2 0)", expected: true},
+		{name: "Line crossing without vertices inside", wkt: "LINESTRING(-5 2, 15 2)", expected: true},
+		{name: "Line outside", wkt: "LINESTRING(-5 -2, 15 -2)", expected: false},
+		{name: "Line within hole", wkt: "LINESTRING(4.5 5, 5.5 5)", expected: false},
+		{name: "Polygon overlapping", wkt: "POLYGON((8 8, 12 8, 12 12, 8 12, 8 8))", expected: true},
+		{name: "Polygon enclosing", wkt: "POLYGON((-1 -1, 11 -1, 11 11, -1 11, -1 -1))", expected: true},
+		{name: "Polygon in hole", wkt: "POLYGON((4.5 4.5, 5.5 4.5, 5.5 5.5, 4.5 5.5, 4.5 4.5))", expected: false},
+		{name: "Polygon within bounds but outside", wkt: "POLYGON((11 11, 12 11, 12 12, 11 12, 11 11))", expected: false},
+		{name: "Collection with a member inside", wkt: "GEOMETRYCOLLECTION(POINT(12 5), LINESTRING(-5 2, 15 2))", expected: true},
+		{name: "Collection outside", wkt: "GEOMETRYCOLLECTION(POINT(12 5), POLYGON((4.5 4.5, 5.5 4.5, 5.5 5.5, 4.5 5.5, 4.5 4.5)))", expected: false},
+		{name: "Nested collection", wkt: "GEOMETRYCOLLECTION(GEOMETRYCOLLECTION(POINT(2 2)))", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := wkt.Unmarshal(tt.wkt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := area.Intersects(g); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAreaFromWKT(t *testing.T) {
+	for _, invalid := range []string{"POINT(1 1)", "POLYGON EMPTY", "not wkt"} {
+		if _, err := AreaFromWKT(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestAreaFromBBox(t *testing.T) {
+	area := AreaFromBBox(BBox{MinX: 1, MaxX: 3, MinY: 2, MaxY: 4})
+
+	got, err := area.WKT()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "POLYGON ((1 2, 3 2, 3 4, 1 4, 1 2))"; got != expected {
+		t.Errorf("got %s, want %s", got, expected)
+	}
+}
@@ -27,6 +27,13 @@ func (bbox BBox) Equals(other BBox, tolerance float64) bool {
 		almostEqual(bbox.MaxY, other.MaxY, tolerance)
 }
 
+// Intersects reports whether the boxes overlap, including touching at an edge,
+// in the same way as an R-tree range query.
+func (bbox BBox) Intersects(other BBox) bool {
+	return bbox.MinX <= other.MaxX && bbox.MaxX >= other.MinX &&
+		bbox.MinY <= other.MaxY && bbox.MaxY >= other.MinY
+}
+
 func BoundingBoxFromWKT(wktStr string) (*BBox, error) {
 	g, err := wkt.Unmarshal(wktStr)
 	if err != nil {
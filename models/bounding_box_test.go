@@ -59,3 +59,27 @@ func TestBoundingBoxFromWKT(t *testing.T) {
 		})
 	}
 }
+
+func TestBoundingBoxIntersects(t *testing.T) {
+	bbox := BBox{MinX: 0, MaxX: 10, MinY: 0, MaxY: 10}
+
+	tests := []struct {
+		name     string
+		other    BBox
+		expected bool
+	}{
+		{name: "Inside", other: BBox{MinX: 2, MaxX: 3, MinY: 2, MaxY: 3}, expected: true},
+		{name: "Overlapping", other: BBox{MinX: 5, MaxX: 15, MinY: -5, MaxY: 5}, expected: true},
+		{name: "Touching", other: BBox{MinX: 10, MaxX: 20, MinY: 10, MaxY: 20}, expected: true},
+		{name: "Enclosing", other: BBox{MinX: -5, MaxX: 15, MinY: -5, MaxY: 15}, expected: true},
+		{name: "Disjoint", other: BBox{MinX: 11, MaxX: 20, MinY: 0, MaxY: 10}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bbox.Intersects(tt.other); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+const (
+	ChangeCreated = "create"
+	ChangeUpdated = "update"
+)
+
+// Change is an event as recorded in the event history, in the order received.
+type Change struct {
+	// ID is the event history id, which increases with each change recorded
+	ID int64
+	// Kind is ChangeCreated for the first event recorded for an object, and
+	// ChangeUpdated thereafter
+	Kind  string
+	Event *Event
+}
@@ -0,0 +1,27 @@
+package models
+
+import "github.com/cockroachdb/errors"
+
+// CodeLabel gives a human-readable label and description for a facet value
+type CodeLabel struct {
+	Facet       string  `json:"-"`
+	Code        string  `json:"-"`
+	Label       string  `json:"label"`
+	Description *string `json:"description,omitempty"`
+}
+
+func CodeLabelFromCSV(record, headers []string) (*CodeLabel, error) {
+	if len(record) < 3 {
+		return nil, errors.Newf("expected at least 3 fields, got %d", len(record))
+	}
+
+	label := &CodeLabel{
+		Facet: record[0],
+		Code:  record[1],
+		Label: record[2],
+	}
+	if len(record) >= 4 && record[3] != "" {
+		label.Description = &record[3]
+	}
+	return label, nil
+}
@@ -1,16 +1,22 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/rm-hull/street-manager-relay/generated"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkt"
 )
 
 type Event struct {
-	ID              int64  `json:"-"`
-	ObjectReference string `json:"-"`
-	EventType       string `json:"event_type"`
+	ID              int64      `json:"-"`
+	ObjectReference string     `json:"-"`
+	ObjectType      *string    `json:"object_type,omitempty"`
+	EventType       string     `json:"event_type"`
+	EventReference  *int64     `json:"event_reference,omitempty"`
+	EventTime       *time.Time `json:"event_time,omitempty"`
 
 	// Core location and authority info
 	USRN                    *string `json:"usrn,omitempty"`
@@ -76,15 +82,38 @@ type Event struct {
 	TrafficManagementRequired *string `json:"traffic_management_required,omitempty"`
 
 	// Misc attributes
-	PermitConditions     *string `json:"permit_conditions,omitempty"`
-	PermitStatus         *string `json:"permit_status,omitempty"`
-	CollaborationType    *string `json:"collaboration_type,omitempty"`
-	CollaborationTypeRef *string `json:"collaboration_type_ref,omitempty"`
-	CloseFootway         *string `json:"close_footway,omitempty"`
-	CloseFootwayRef      *string `json:"close_footway_ref,omitempty"`
+	PermitConditions     *string  `json:"permit_conditions,omitempty"`
+	PermitConditionCodes []string `json:"permit_condition_codes,omitempty"`
+	PermitStatus         *string  `json:"permit_status,omitempty"`
+	CollaborationType    *string  `json:"collaboration_type,omitempty"`
+	CollaborationTypeRef *string  `json:"collaboration_type_ref,omitempty"`
+	CloseFootway         *string  `json:"close_footway,omitempty"`
+	CloseFootwayRef      *string  `json:"close_footway_ref,omitempty"`
 }
 
 func (event *Event) BoundingBox() (*BBox, error) {
+	coords := event.coordinates()
+	if coords == nil {
+		return nil, errors.New("no coordinates found for bounding box calculation")
+	}
+	return BoundingBoxFromWKT(*coords)
+}
+
+// Geometry parses the location of the works, activity or section 58.
+func (event *Event) Geometry() (geom.T, error) {
+	coords := event.coordinates()
+	if coords == nil {
+		return nil, errors.New("no coordinates found")
+	}
+
+	g, err := wkt.Unmarshal(*coords)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse WKT")
+	}
+	return g, nil
+}
+
+func (event *Event) coordinates() *string {
 	fields := []*string{
 		event.WorksLocationCoordinates,
 		event.ActivityCoordinates,
@@ -93,19 +122,63 @@ func (event *Event) BoundingBox() (*BBox, error) {
 
 	for _, coords := range fields {
 		if coords != nil && *coords != "" {
-			return BoundingBoxFromWKT(*coords)
+			return coords
 		}
 	}
+	return nil
+}
+
+// StartsAt is the best known start of the event, preferring actual over planned
+// or proposed dates, in the same order of precedence as the search temporal window.
+func (event *Event) StartsAt() *time.Time {
+	return firstNonNil(event.ActualStartDateTime, event.StartDate, event.StartTime, event.ProposedStartDate, event.ProposedStartTime)
+}
 
-	return nil, errors.New("no coordinates found for bounding box calculation")
+// EndsAt is the best known end of the event, or nil if it is open-ended.
+func (event *Event) EndsAt() *time.Time {
+	return firstNonNil(event.ActualEndDateTime, event.EndDate, event.EndTime, event.ProposedEndDate, event.ProposedEndTime)
+}
+
+func firstNonNil(times ...*time.Time) *time.Time {
+	for _, t := range times {
+		if t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// ParsePermitConditions splits a comma-separated list of condition codes,
+// e.g. "NCT01a, NCT01b, NCT11a", ignoring blanks and duplicates.
+func ParsePermitConditions(conditions *string) []string {
+	if conditions == nil {
+		return nil
+	}
+
+	codes := make([]string, 0)
+	seen := make(map[string]bool)
+	for part := range strings.SplitSeq(*conditions, ",") {
+		code := strings.TrimSpace(part)
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
 }
 
 func NewEventFrom(event generated.EventNotifierMessage) *Event {
 	objectData := event.ObjectData
+	objectType := string(event.ObjectType)
+	eventReference := int64(event.EventReference)
+	eventTime := event.EventTime
 	// Convert the generated EventNotifierMessage to our event model
 	return &Event{
 		ObjectReference: event.ObjectReference,
+		ObjectType:      &objectType,
 		EventType:       string(event.EventType),
+		EventReference:  &eventReference,
+		EventTime:       &eventTime,
 
 		// Core location and authority info
 		USRN:                    &objectData.Usrn,
@@ -172,6 +245,7 @@ func NewEventFrom(event generated.EventNotifierMessage) *Event {
 
 		// Misc attributes
 		PermitConditions:     objectData.PermitConditions,
+		PermitConditionCodes: ParsePermitConditions(objectData.PermitConditions),
 		PermitStatus:         (*string)(objectData.PermitStatus),
 		CollaborationType:    (*string)(objectData.CollaborationType),
 		CollaborationTypeRef: (*string)(objectData.CollaborationTypeRef),
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePermitConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions *string
+		expected   []string
+	}{
+		{name: "Nil", conditions: nil, expected: nil},
+		{name: "Empty", conditions: ptr(""), expected: []string{}},
+		{name: "Single", conditions: ptr("NCT01a"), expected: []string{"NCT01a"}},
+		{name: "Spaced", conditions: ptr("NCT01a, NCT01b, NCT11a"), expected: []string{"NCT01a", "NCT01b", "NCT11a"}},
+		{name: "Blanks and duplicates", conditions: ptr("NCT01a,, NCT01a ,NCT02b,"), expected: []string{"NCT01a", "NCT02b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParsePermitConditions(tt.conditions)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
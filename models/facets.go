@@ -1,18 +1,226 @@
 package models
 
-type Facets struct {
-	PermitStatus             []string
-	TrafficManagementTypeRef []string
-	WorkStatusRef            []string
-	WorkCategoryRef          []string
-	RoadCategory             []string
-	HighwayAuthority         []string
-	PromoterOrganisation     []string
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// FacetDefinition describes a filterable attribute of an event.
+type FacetDefinition struct {
+	// Param is the query-string parameter, and the key used in refdata
+	Param string
+	// Column is the events table column the facet filters on
+	Column string
+	// Table, if set, names a child table holding several values per event, in
+	// which case Column is the value column of that table. Child tables exist
+	// for both current and historic events, as event_<Table> and
+	// event_history_<Table> respectively, and are keyed on id.
+	Table string
+	// RefData indicates whether value counts are included in refdata
+	RefData bool
+	// Value reads the value of a single-valued facet from an event
+	Value func(event *Event) *string
+	// Values reads the values of a multi-valued facet (i.e. with a Table)
+	Values func(event *Event) []string
+}
+
+// ValuesOf reads the facet's value(s) from an event, whether single or multi-valued.
+func (facet FacetDefinition) ValuesOf(event *Event) []string {
+	if facet.Values != nil {
+		return facet.Values(event)
+	}
+	if value := facet.Value(event); value != nil {
+		return []string{*value}
+	}
+	return nil
+}
+
+// FacetRegistry is the single source of truth for which facets are
+// supported by search, and which are summarised in refdata.
+var FacetRegistry = []FacetDefinition{
+	{Param: "permit_status", Column: "permit_status", RefData: true, Value: func(e *Event) *string { return e.PermitStatus }},
+	{Param: "traffic_management_type_ref", Column: "traffic_management_type_ref", RefData: true, Value: func(e *Event) *string { return e.TrafficManagementTypeRef }},
+	{Param: "work_status_ref", Column: "work_status_ref", RefData: true, Value: func(e *Event) *string { return e.WorkStatusRef }},
+	{Param: "work_category_ref", Column: "work_category_ref", RefData: true, Value: func(e *Event) *string { return e.WorkCategoryRef }},
+	{Param: "road_category", Column: "road_category", RefData: true, Value: func(e *Event) *string { return e.RoadCategory }},
+	{Param: "highway_authority", Column: "highway_authority", RefData: true, Value: func(e *Event) *string { return e.HighwayAuthority }},
+	{Param: "promoter_organisation", Column: "promoter_organisation", RefData: true, Value: func(e *Event) *string { return e.PromoterOrganisation }},
+	{Param: "event_type", Column: "event_type", RefData: true, Value: func(e *Event) *string { return &e.EventType }},
+	{Param: "activity_type", Column: "activity_type", RefData: true, Value: func(e *Event) *string { return e.ActivityType }},
+	{Param: "is_traffic_sensitive", Column: "is_traffic_sensitive", RefData: true, Value: func(e *Event) *string { return e.IsTrafficSensitive }},
+	{Param: "is_ttro_required", Column: "is_ttro_required", RefData: true, Value: func(e *Event) *string { return e.IsTTRORequired }},
+	{Param: "close_footway_ref", Column: "close_footway_ref", RefData: true, Value: func(e *Event) *string { return e.CloseFootwayRef }},
+	{Param: "collaboration_type_ref", Column: "collaboration_type_ref", RefData: true, Value: func(e *Event) *string { return e.CollaborationTypeRef }},
+	{Param: "cancelled", Column: "cancelled", RefData: true, Value: func(e *Event) *string { return e.Cancelled }},
+	// Already summarised by name under highway_authority
+	{Param: "highway_authority_swa_code", Column: "highway_authority_swa_code", RefData: false, Value: func(e *Event) *string { return e.HighwayAuthoritySWACode }},
+	{Param: "permit_condition", Column: "code", Table: "permit_conditions", RefData: true, Values: func(e *Event) []string { return e.PermitConditionCodes }},
+	// Too many distinct values to summarise, but useful for prefix matching
+	{Param: "work_reference_number", Column: "work_reference_number", RefData: false, Value: func(e *Event) *string { return e.WorkReferenceNumber }},
+}
+
+// FacetFilter holds the selected values for a single facet. Values may use '*'
+// as a wildcard, e.g. "0000218889*" to match on a prefix.
+type FacetFilter struct {
+	// Include matches events with any of these values (or all, if empty)
+	Include []string `json:"include,omitempty"`
+	// Exclude rejects events with any of these values
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Facets holds the selected values for each facet, keyed by FacetDefinition.Param
+type Facets map[string]*FacetFilter
+
+// Add selects a value for a facet, which is treated as an exclusion when it
+// is prefixed with '!'.
+func (facets Facets) Add(param string, value string) {
+	if excluded, ok := strings.CutPrefix(value, "!"); ok {
+		facets.Exclude(param, excluded)
+		return
+	}
+	if value != "" {
+		facets.filter(param).Include = append(facets.filter(param).Include, value)
+	}
+}
+
+// FacetsFromMap selects the values given for each facet, as used in JSON
+// request bodies, where values may be prefixed with '!' to exclude them.
+func FacetsFromMap(values map[string][]string) (Facets, error) {
+	facets := make(Facets)
+	for param, paramValues := range values {
+		if !slices.ContainsFunc(FacetRegistry, func(facet FacetDefinition) bool { return facet.Param == param }) {
+			return nil, errors.Newf("unknown facet '%s'", param)
+		}
+		for _, value := range paramValues {
+			facets.Add(param, value)
+		}
+	}
+	return facets, nil
+}
+
+func (facets Facets) Exclude(param string, values ...string) {
+	for _, value := range values {
+		if value != "" {
+			facets.filter(param).Exclude = append(facets.filter(param).Exclude, value)
+		}
+	}
+}
+
+func (facets Facets) filter(param string) *FacetFilter {
+	filter, ok := facets[param]
+	if !ok {
+		filter = &FacetFilter{}
+		facets[param] = filter
+	}
+	return filter
+}
+
+// Matches reports whether an event satisfies every facet filter, with the same
+// semantics as a search: at least one included value (if any) and none of the
+// excluded values must match, and events without a value are never excluded.
+func (facets Facets) Matches(event *Event) bool {
+	for _, facet := range FacetRegistry {
+		filter, ok := facets[facet.Param]
+		if !ok {
+			continue
+		}
+
+		values := facet.ValuesOf(event)
+		if len(filter.Include) > 0 && !anyValueMatches(values, filter.Include) {
+			return false
+		}
+		if anyValueMatches(values, filter.Exclude) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyValueMatches(values []string, selected []string) bool {
+	for _, value := range values {
+		for _, pattern := range selected {
+			if wildcardMatch(pattern, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches a value against a facet value where '*' matches any
+// sequence of characters (case-sensitively, as per the GLOB used in searches).
+func wildcardMatch(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	last := len(parts) - 1
+	if !strings.HasPrefix(value, parts[0]) || !strings.HasSuffix(value[len(parts[0]):], parts[last]) {
+		return false
+	}
+
+	remaining := value[len(parts[0]) : len(value)-len(parts[last])]
+	for _, part := range parts[1:last] {
+		idx := strings.Index(remaining, part)
+		if idx < 0 {
+			return false
+		}
+		remaining = remaining[idx+len(part):]
+	}
+	return true
+}
+
+// IsWildcard reports whether a facet value contains a '*' wildcard.
+func IsWildcard(value string) bool {
+	return strings.Contains(value, "*")
 }
 
+// MaxWindowDays caps MaxDaysAhead and MaxDaysBehind, so that a window can't
+// span the entire history.
+const MaxWindowDays = 366
+
 type TemporalFilters struct {
 	MaxDaysAhead  int
 	MaxDaysBehind int
+
+	// AsAt, when set, evaluates the search against the state of each object as
+	// it was known at that instant, rather than its current state.
+	AsAt *time.Time
+
+	// From and To, when either is set, replace the window relative to now with
+	// events active at some point between them; an unset end is left open.
+	From *time.Time
+	To   *time.Time
+}
+
+// Includes reports whether an event is active within the window relative to
+// now, with the same whole-day bounds as a search, or between From and To if
+// set. Events with no known start are never included.
+func (filters TemporalFilters) Includes(event *Event, now time.Time) bool {
+	startsAt := event.StartsAt()
+	if startsAt == nil {
+		return false
+	}
+
+	if filters.From != nil || filters.To != nil {
+		endsAt := event.EndsAt()
+		return (filters.To == nil || !startsAt.After(*filters.To)) &&
+			(filters.From == nil || endsAt == nil || !endsAt.Before(*filters.From))
+	}
+
+	// A search compares the start with the bare date, which sorts before any
+	// time on that day, so the end of the window is exclusive
+	today := now.UTC().Truncate(24 * time.Hour)
+	if !startsAt.Before(today.AddDate(0, 0, filters.MaxDaysAhead)) {
+		return false
+	}
+
+	endsAt := event.EndsAt()
+	return endsAt == nil || !endsAt.Before(today.AddDate(0, 0, -filters.MaxDaysBehind))
 }
 
 type RefData map[string]map[string]int
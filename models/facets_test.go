@@ -0,0 +1,135 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFacetRegistry(t *testing.T) {
+	// Columns are interpolated into generated SQL, so must be plain identifiers
+	identifier := regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	seen := make(map[string]bool)
+
+	for _, facet := range FacetRegistry {
+		if seen[facet.Param] {
+			t.Errorf("duplicate facet param: %s", facet.Param)
+		}
+		seen[facet.Param] = true
+
+		if !identifier.MatchString(facet.Column) {
+			t.Errorf("facet %s has invalid column name: %q", facet.Param, facet.Column)
+		}
+	}
+}
+
+func TestFacetsMatches(t *testing.T) {
+	event := &Event{
+		EventType:            "PERMIT_GRANTED",
+		WorkReferenceNumber:  ptr("0000218889274"),
+		Cancelled:            ptr("No"),
+		PermitConditionCodes: []string{"NCT01a", "NCT11a"},
+	}
+
+	tests := []struct {
+		name     string
+		facets   Facets
+		expected bool
+	}{
+		{name: "No facets", facets: Facets{}, expected: true},
+		{name: "Included", facets: Facets{"event_type": {Include: []string{"WORK_START", "PERMIT_GRANTED"}}}, expected: true},
+		{name: "Not included", facets: Facets{"event_type": {Include: []string{"WORK_START"}}}, expected: false},
+		{name: "Excluded", facets: Facets{"cancelled": {Exclude: []string{"No"}}}, expected: false},
+		{name: "Not excluded", facets: Facets{"cancelled": {Exclude: []string{"Yes"}}}, expected: true},
+		{name: "Missing value not excluded", facets: Facets{"permit_status": {Exclude: []string{"granted"}}}, expected: true},
+		{name: "Missing value not included", facets: Facets{"permit_status": {Include: []string{"granted"}}}, expected: false},
+		{name: "Prefix wildcard", facets: Facets{"work_reference_number": {Include: []string{"0000218889*"}}}, expected: true},
+		{name: "Infix wildcard", facets: Facets{"work_reference_number": {Include: []string{"0000*88*74"}}}, expected: true},
+		{name: "Wildcard mismatch", facets: Facets{"work_reference_number": {Include: []string{"*275"}}}, expected: false},
+		{name: "Any child value", facets: Facets{"permit_condition": {Include: []string{"NCT11a"}}}, expected: true},
+		{name: "Child value excluded", facets: Facets{"permit_condition": {Exclude: []string{"NCT01*"}}}, expected: false},
+		{name: "Every facet must match", facets: Facets{"event_type": {Include: []string{"PERMIT_GRANTED"}}, "cancelled": {Include: []string{"Yes"}}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.facets.Matches(event); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTemporalFiltersIncludes(t *testing.T) {
+	now := time.Date(2025, 6, 10, 14, 30, 0, 0, time.UTC)
+	filters := TemporalFilters{MaxDaysAhead: 7, MaxDaysBehind: 2}
+
+	tests := []struct {
+		name     string
+		event    *Event
+		expected bool
+	}{
+		{name: "No start", event: &Event{}, expected: false},
+		{name: "In progress", event: &Event{ActualStartDateTime: ptr(time.Date(2025, 6, 9, 8, 0, 0, 0, time.UTC))}, expected: true},
+		{name: "Starts within window", event: &Event{ProposedStartDate: ptr(time.Date(2025, 6, 16, 23, 59, 0, 0, time.UTC))}, expected: true},
+		{name: "Starts at the end of the window", event: &Event{ProposedStartDate: ptr(time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC))}, expected: false},
+		{name: "Starts after window", event: &Event{ProposedStartDate: ptr(time.Date(2025, 6, 17, 9, 0, 0, 0, time.UTC))}, expected: false},
+		{name: "Ended within window", event: &Event{
+			StartDate: ptr(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+			EndDate:   ptr(time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)),
+		}, expected: true},
+		{name: "Ended before window", event: &Event{
+			StartDate: ptr(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+			EndDate:   ptr(time.Date(2025, 6, 7, 23, 59, 0, 0, time.UTC)),
+		}, expected: false},
+		{name: "Actual end takes precedence", event: &Event{
+			StartDate:         ptr(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+			EndDate:           ptr(time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC)),
+			ActualEndDateTime: ptr(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)),
+		}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filters.Includes(tt.event, now); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTemporalFiltersIncludesBetween(t *testing.T) {
+	now := time.Date(2025, 6, 10, 14, 30, 0, 0, time.UTC)
+	from := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filters  TemporalFilters
+		event    *Event
+		expected bool
+	}{
+		{name: "Overlaps", filters: TemporalFilters{From: &from, To: &to}, event: &Event{
+			StartDate: ptr(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)),
+			EndDate:   ptr(time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)),
+		}, expected: true},
+		{name: "Starts after", filters: TemporalFilters{From: &from, To: &to}, event: &Event{
+			StartDate: ptr(time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC)),
+		}, expected: false},
+		{name: "Ends before", filters: TemporalFilters{From: &from, To: &to}, event: &Event{
+			StartDate: ptr(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+			EndDate:   ptr(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)),
+		}, expected: false},
+		{name: "Open end ignores the relative window", filters: TemporalFilters{From: &from}, event: &Event{
+			StartDate: ptr(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filters.Includes(tt.event, now); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// timestampLayouts lists the accepted formats for user-supplied timestamps, from
+// most to least precise. Values without a zone are interpreted as UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func ParseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.Newf("invalid timestamp '%s': expected an ISO-8601 date or date-time", value)
+}
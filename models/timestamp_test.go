@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "RFC3339",
+			value:    "2025-06-01T09:00:00Z",
+			expected: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Minutes precision with zone",
+			value:    "2025-06-01T09:00Z",
+			expected: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Offset is normalised to UTC",
+			value:    "2025-06-01T10:00+01:00",
+			expected: time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "Date only",
+			value:    "2025-06-01",
+			expected: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Garbage",
+			value:   "yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
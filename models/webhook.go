@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription registers a callback URL to be sent changes to events
+// within an area that match the facets.
+type WebhookSubscription struct {
+	ID          int64  `json:"id"`
+	CallbackURL string `json:"callback_url"`
+	// Secret is used to sign payloads, and is only revealed on creation
+	Secret string `json:"secret,omitempty"`
+	// Area is a WKT polygon in British National Grid coordinates (EPSG:27700)
+	Area string `json:"area"`
+	// Facets are keyed by param, where values prefixed with '!' are excluded
+	Facets    map[string][]string `json:"facets,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	// APIKeyID is the key that owns the subscription, which only it can see
+	// or change
+	APIKeyID *int64 `json:"-"`
+}
+
+// WebhookDelivery logs the attempts to send a change to a subscriber.
+type WebhookDelivery struct {
+	ID              int64      `json:"id"`
+	SubscriptionID  int64      `json:"subscription_id"`
+	HistoryID       int64      `json:"history_id"`
+	ObjectReference string     `json:"object_reference"`
+	Kind            string     `json:"kind"`
+	Payload         string     `json:"-"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt   *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus  *int       `json:"response_status,omitempty"`
+	Error           *string    `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// PendingDelivery is a delivery that is due to be attempted, along with where
+// to send it.
+type PendingDelivery struct {
+	*WebhookDelivery
+	CallbackURL string
+	Secret      string
+}
+
+// WebhookPayload is the body posted to the callback URL for each change.
+type WebhookPayload struct {
+	SubscriptionID  int64  `json:"subscription_id"`
+	HistoryID       int64  `json:"history_id"`
+	Kind            string `json:"kind"`
+	ObjectReference string `json:"object_reference"`
+	Event           *Event `json:"event"`
+}
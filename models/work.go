@@ -0,0 +1,139 @@
+package models
+
+import "time"
+
+// Work aggregates the permits (and permit variations, e.g. -01, -02) raised
+// against the same work reference number.
+type Work struct {
+	WorkReferenceNumber  string  `json:"work_reference_number"`
+	PromoterSWACode      *string `json:"promoter_swa_code,omitempty"`
+	PromoterOrganisation *string `json:"promoter_organisation,omitempty"`
+	HighwayAuthority     *string `json:"highway_authority,omitempty"`
+	USRN                 *string `json:"usrn,omitempty"`
+	StreetName           *string `json:"street_name,omitempty"`
+
+	// Status as per the most recently updated permit
+	WorkStatus    *string `json:"work_status,omitempty"`
+	WorkStatusRef *string `json:"work_status_ref,omitempty"`
+	PermitStatus  *string `json:"permit_status,omitempty"`
+
+	// Overall window spanning all permits; ActiveTo is nil when any is open-ended
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	ActiveTo   *time.Time `json:"active_to,omitempty"`
+
+	Permits []*Event `json:"permits"`
+}
+
+// Street groups events which are not part of a work (activities and section
+// 58s) by the street they are on.
+type Street struct {
+	USRN             string   `json:"usrn"`
+	StreetName       *string  `json:"street_name,omitempty"`
+	AreaName         *string  `json:"area_name,omitempty"`
+	Town             *string  `json:"town,omitempty"`
+	HighwayAuthority *string  `json:"highway_authority,omitempty"`
+	Events           []*Event `json:"events"`
+}
+
+// GroupByWork collects events sharing a work reference number into works, in
+// order of first appearance. Events without a work reference are returned as-is.
+func GroupByWork(events []*Event) ([]*Work, []*Event) {
+	works := make([]*Work, 0, len(events))
+	byRef := make(map[string]*Work)
+	ungrouped := make([]*Event, 0)
+
+	for _, event := range events {
+		if event.WorkReferenceNumber == nil || *event.WorkReferenceNumber == "" {
+			ungrouped = append(ungrouped, event)
+			continue
+		}
+
+		work, ok := byRef[*event.WorkReferenceNumber]
+		if !ok {
+			work = &Work{WorkReferenceNumber: *event.WorkReferenceNumber}
+			byRef[work.WorkReferenceNumber] = work
+			works = append(works, work)
+		}
+		work.Permits = append(work.Permits, event)
+	}
+
+	for _, work := range works {
+		work.summarise()
+	}
+	return works, ungrouped
+}
+
+func (work *Work) summarise() {
+	var current *Event
+	openEnded := false
+
+	for _, permit := range work.Permits {
+		if current == nil || isMoreRecent(permit, current) {
+			current = permit
+		}
+
+		if start := permit.StartsAt(); start != nil && (work.ActiveFrom == nil || start.Before(*work.ActiveFrom)) {
+			work.ActiveFrom = start
+		}
+
+		end := permit.EndsAt()
+		if end == nil {
+			openEnded = true
+		} else if work.ActiveTo == nil || end.After(*work.ActiveTo) {
+			work.ActiveTo = end
+		}
+	}
+
+	if openEnded {
+		work.ActiveTo = nil
+	}
+
+	work.PromoterSWACode = current.PromoterSWACode
+	work.PromoterOrganisation = current.PromoterOrganisation
+	work.HighwayAuthority = current.HighwayAuthority
+	work.USRN = current.USRN
+	work.StreetName = current.StreetName
+	work.WorkStatus = current.WorkStatus
+	work.WorkStatusRef = current.WorkStatusRef
+	work.PermitStatus = current.PermitStatus
+}
+
+// isMoreRecent orders by event time, falling back on the object reference so
+// that later permit variations win when times are unknown or equal.
+func isMoreRecent(a, b *Event) bool {
+	if a.EventTime != nil && b.EventTime != nil && !a.EventTime.Equal(*b.EventTime) {
+		return a.EventTime.After(*b.EventTime)
+	}
+	if (a.EventTime == nil) != (b.EventTime == nil) {
+		return a.EventTime != nil
+	}
+	return a.ObjectReference > b.ObjectReference
+}
+
+// GroupByStreet collects events by USRN, in order of first appearance.
+func GroupByStreet(events []*Event) []*Street {
+	streets := make([]*Street, 0)
+	byUSRN := make(map[string]*Street)
+
+	for _, event := range events {
+		usrn := ""
+		if event.USRN != nil {
+			usrn = *event.USRN
+		}
+
+		street, ok := byUSRN[usrn]
+		if !ok {
+			street = &Street{
+				USRN:             usrn,
+				StreetName:       event.StreetName,
+				AreaName:         event.AreaName,
+				Town:             event.Town,
+				HighwayAuthority: event.HighwayAuthority,
+			}
+			byUSRN[usrn] = street
+			streets = append(streets, street)
+		}
+		street.Events = append(street.Events, event)
+	}
+	return streets
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestGroupByWork(t *testing.T) {
+	day := func(d int) *time.Time {
+		return ptr(time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC))
+	}
+
+	events := []*Event{
+		{
+			ObjectReference:     "W1-01",
+			WorkReferenceNumber: ptr("W1"),
+			EventTime:           day(1),
+			WorkStatusRef:       ptr("planned"),
+			ProposedStartDate:   day(3),
+			ProposedEndDate:     day(5),
+		},
+		{
+			ObjectReference: "ARN-1",
+			USRN:            ptr("8400794"),
+		},
+		{
+			ObjectReference:     "W1-02",
+			WorkReferenceNumber: ptr("W1"),
+			EventTime:           day(2),
+			WorkStatusRef:       ptr("in_progress"),
+			ActualStartDateTime: day(4),
+			ProposedEndDate:     day(9),
+		},
+		{
+			ObjectReference:     "W2-01",
+			WorkReferenceNumber: ptr("W2"),
+			ProposedStartDate:   day(7),
+		},
+	}
+
+	works, ungrouped := GroupByWork(events)
+
+	if len(works) != 2 {
+		t.Fatalf("expected 2 works, got %d", len(works))
+	}
+	if len(ungrouped) != 1 || ungrouped[0].ObjectReference != "ARN-1" {
+		t.Fatalf("expected activity to be ungrouped, got %+v", ungrouped)
+	}
+
+	w1 := works[0]
+	if w1.WorkReferenceNumber != "W1" || len(w1.Permits) != 2 {
+		t.Fatalf("unexpected first work: %+v", w1)
+	}
+	if *w1.WorkStatusRef != "in_progress" {
+		t.Errorf("expected status of latest permit, got %s", *w1.WorkStatusRef)
+	}
+	if !w1.ActiveFrom.Equal(*day(3)) || !w1.ActiveTo.Equal(*day(9)) {
+		t.Errorf("unexpected active window: %v - %v", w1.ActiveFrom, w1.ActiveTo)
+	}
+
+	w2 := works[1]
+	if w2.ActiveTo != nil {
+		t.Errorf("expected open-ended work, got %v", w2.ActiveTo)
+	}
+}